@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+)
+
+const authUsage = "usage: auth login [-headless] | auth add <name> [-headless] | auth list | auth remove <name>"
+
+const headlessUsage = "Print the consent URL and paste the redirected URL instead of using a local listener"
+
+// runAuth handles the auth subcommands; only the Google client config is needed
+func runAuth(args []string) error {
+	globals, args := splitGlobalArgs(args)
+	if len(args) == 0 || args[0] == "-h" || args[0] == "-help" || args[0] == "--help" {
+		fs, _ := newCommandFlagSet("auth")
+		fs.Usage()
+		if len(args) == 0 {
+			return errors.New(authUsage)
+		}
+		return flag.ErrHelp
+	}
+	sub, args := args[0], args[1:]
+
+	// auth add and auth remove take the account name before the flags
+	var name string
+	if sub == "add" || sub == "remove" {
+		if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+			if len(args) == 0 || (args[0] != "-h" && args[0] != "-help" && args[0] != "--help") {
+				return fmt.Errorf("usage: auth %s <name>", sub)
+			}
+		} else {
+			name, args = args[0], args[1:]
+		}
+	}
+
+	args = append(globals, args...)
+
+	var fs *flag.FlagSet
+	var global *globalOptions
+	var headless *bool
+	switch sub {
+	case "login":
+		fs, global = newFlagSet("auth login", "[flags]", "Authorize the default Google account")
+		headless = fs.Bool("headless", false, headlessUsage)
+	case "add":
+		fs, global = newFlagSet("auth add", "<name> [flags]", "Authorize a named Google account")
+		headless = fs.Bool("headless", false, headlessUsage)
+	case "list":
+		fs, global = newFlagSet("auth list", "[flags]", "List Google accounts and their email addresses")
+	case "remove":
+		fs, global = newFlagSet("auth remove", "<name> [flags]", "Delete the stored token of a Google account")
+	default:
+		return errors.New(authUsage)
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := global.loadConfig(false); err != nil {
+		return err
+	}
+	manager := newAuthManager(logger)
+
+	switch sub {
+	case "login":
+		if err := manager.Login(context.Background(), *headless); err != nil {
+			return fmt.Errorf("Google login failed: %w", err)
+		}
+		fmt.Println("Google Drive authorization saved.")
+	case "add":
+		if err := manager.AddAccount(context.Background(), name, *headless); err != nil {
+			return fmt.Errorf("Google login failed: %w", err)
+		}
+		fmt.Printf("Google Drive authorization saved for account %s.\n", name)
+	case "list":
+		accounts, err := manager.Accounts()
+		if err != nil {
+			return fmt.Errorf("failed to list accounts: %w", err)
+		}
+		if len(accounts) == 0 {
+			fmt.Println("No Google accounts configured; run auth login or auth add <name>.")
+			return nil
+		}
+		for _, name := range accounts {
+			email, err := manager.AccountEmail(name)
+			if err != nil {
+				email = fmt.Sprintf("(unavailable: %v)", err)
+			}
+			fmt.Printf("%-20s %s\n", name, email)
+		}
+	case "remove":
+		if err := manager.RemoveAccount(name); err != nil {
+			return fmt.Errorf("failed to remove account: %w", err)
+		}
+		fmt.Printf("Account %s removed.\n", name)
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/vincent119/s3syncgoogledrive/internal/configs"
+)
+
+const configUsage = "usage: config validate | config env"
+
+// runConfig handles "config validate", failing when the config has problems,
+// and "config env", listing the environment variables that override config keys
+func runConfig(args []string) error {
+	globals, args := splitGlobalArgs(args)
+	if len(args) == 0 || args[0] == "-h" || args[0] == "-help" || args[0] == "--help" {
+		fs, _ := newCommandFlagSet("config")
+		fs.Usage()
+		if len(args) == 0 {
+			return errors.New(configUsage)
+		}
+		return flag.ErrHelp
+	}
+
+	sub, args := args[0], append(globals, args[1:]...)
+	switch sub {
+	case "validate":
+		fs, global := newFlagSet("config validate", "[flags]", "Report every problem in the config; exits non-zero when there are any")
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+		if err := global.loadConfig(false); err != nil {
+			return err
+		}
+		if err := configs.Validate(); err != nil {
+			return err
+		}
+		fmt.Println("Configuration is valid.")
+	case "env":
+		fs, _ := newFlagSet("config env", "", "List the environment variables that override config keys")
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+		for _, key := range configs.EnvKeys() {
+			fmt.Printf("%-45s %s\n", configs.EnvVarName(key), key)
+		}
+	default:
+		return errors.New(configUsage)
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/vincent119/s3syncgoogledrive/internal/configs"
+	"github.com/vincent119/s3syncgoogledrive/internal/googlesdk/drive"
+)
+
+// runDoctor checks the config, S3 access and Google Drive access, reporting each result
+func runDoctor(args []string) error {
+	fs, global := newCommandFlagSet("doctor")
+	account := fs.String("account", "", "Named Google account to check (default Drive.account)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	ctx, stop := signalContext()
+	defer stop()
+	failed := 0
+	check := func(name string, err error, ok string) {
+		if err != nil {
+			failed++
+			fmt.Printf("❌ %s: %v\n", name, err)
+			return
+		}
+		fmt.Printf("✅ %s: %s\n", name, ok)
+	}
+
+	if err := global.loadConfig(false); err != nil {
+		check("Config", err, "")
+		return fmt.Errorf("%d checks failed", failed)
+	}
+	check("Config", configs.Validate(), "valid ("+strings.Join(configs.CurrentSource().Files, ", ")+")")
+
+	s3Manager, err := newS3Manager(logger)
+	if err == nil {
+		err = s3Manager.CheckBucket(ctx, configs.Config.S3.BucketName)
+	}
+	check("S3", err, "bucket "+configs.Config.S3.BucketName+" is readable")
+
+	if *account == "" {
+		*account = configs.Config.Drive.Account
+	}
+	manager := newAuthManager(logger)
+	email, err := manager.AccountEmail(*account)
+	check("Google Drive", err, "authorized as "+email)
+
+	if sharedDrive := configs.Config.Drive.SharedDrive; sharedDrive != "" && err == nil {
+		srv, _ := manager.DriveServiceFor(*account)
+		driveID, err := drive.NewDriveManager(srv).ResolveSharedDrive(ctx, sharedDrive)
+		check("Shared drive", err, fmt.Sprintf("%s (ID %s)", sharedDrive, driveID))
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d checks failed", failed)
+	}
+	return nil
+}
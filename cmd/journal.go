@@ -0,0 +1,120 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+
+	"github.com/vincent119/s3syncgoogledrive/internal/configs"
+	"github.com/vincent119/s3syncgoogledrive/internal/pkg/journal"
+	"github.com/vincent119/s3syncgoogledrive/internal/pkg/logging"
+)
+
+// resumeFlags are the sync options read from the journal of a resumed run
+var resumeFlags = []string{"p", "droot", "as-of", "all-versions", "account"}
+
+// checkResume rejects the flags that would change the files of a resumed run
+func checkResume(fs *flag.FlagSet) error {
+	var err error
+	fs.Visit(func(f *flag.Flag) {
+		for _, name := range resumeFlags {
+			if f.Name == name && err == nil {
+				err = fmt.Errorf("-%s cannot be used with -resume, the run's options are read from its journal", name)
+			}
+		}
+	})
+	return err
+}
+
+// restore applies the options of a journaled run
+func (o *syncOptions) restore(run journal.Run) error {
+	o.prefix = run.Prefix
+	o.rootID = run.RootID
+	o.asOf = run.AsOf
+	o.allVersions = run.AllVersions
+	o.account = run.Account
+	return o.parseAsOf()
+}
+
+// openJournal starts the journal of a new run, or continues the journal of a
+// resumed one. It returns nil for a new run when Journal.enabled is off.
+func openJournal(runID string, opts *syncOptions, resume bool) (*journal.Writer, error) {
+	dir := configs.Config.Journal.ResolvedDir()
+	var w *journal.Writer
+	var err error
+	var first journal.Record
+	if resume {
+		w, err = journal.Append(dir, runID)
+		first = journal.Record{State: journal.Resumed}
+	} else {
+		if !configs.Config.Journal.Enabled {
+			return nil, nil
+		}
+		w, err = journal.Create(dir, runID)
+		first = journal.Record{State: journal.Started, Run: &journal.Run{
+			ID:          runID,
+			Prefix:      opts.prefix,
+			RootID:      opts.rootID,
+			AsOf:        opts.asOf,
+			AllVersions: opts.allVersions,
+			Account:     opts.account,
+		}}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := w.Write(first); err != nil {
+		w.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+// closeJournal closes w. A journal missing records only costs Drive lookups
+// on resume, so a write error is logged instead of failing the run.
+func closeJournal(logger *slog.Logger, w *journal.Writer) {
+	if err := w.Close(); err != nil {
+		logger.Warn("Run journal is incomplete", logging.Err(err))
+	}
+}
+
+// queuedRecord journals item as listed, with what is needed to copy it without listing again
+func queuedRecord(item syncItem) journal.Record {
+	return journal.Record{
+		State:        journal.Queued,
+		S3Key:        item.s3Key,
+		VersionID:    item.versionID,
+		ETag:         item.s3ETag,
+		StorageClass: item.storageClass,
+		Size:         item.size,
+		LastModified: item.lastModified,
+	}
+}
+
+// fileRecord journals a state transition of item
+func fileRecord(state journal.State, item syncItem) journal.Record {
+	return journal.Record{State: state, S3Key: item.s3Key, VersionID: item.versionID}
+}
+
+// resumeItems splits the files of a journal into those to copy again, the
+// failed, pending, in-flight and never started ones, and those already done
+func resumeItems(files []journal.Record) (todo, done []syncItem) {
+	for _, f := range files {
+		item := syncItem{
+			s3Key:        f.S3Key,
+			s3ETag:       f.ETag,
+			versionID:    f.VersionID,
+			fileName:     filepath.Base(f.S3Key),
+			storageClass: f.StorageClass,
+			size:         f.Size,
+			lastModified: f.LastModified,
+		}
+		if f.State == journal.Done {
+			done = append(done, item)
+		} else {
+			todo = append(todo, item)
+		}
+	}
+	return todo, done
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+
+	"github.com/vincent119/s3syncgoogledrive/internal/configs"
+	"github.com/vincent119/s3syncgoogledrive/internal/pkg/report"
+)
+
+const driveFolderMimeType = "application/vnd.google-apps.folder"
+
+// runLs lists S3 objects under a prefix, or with -drive the files in a Drive folder
+func runLs(args []string) error {
+	fs, global := newCommandFlagSet("ls")
+	onDrive := fs.Bool("drive", false, "List a Google Drive folder (default: the root, or the shared drive root)")
+	versions := fs.Bool("versions", false, "List every S3 object version")
+	account := fs.String("account", "", "Named Google account to use with -drive (default Drive.account)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 1 {
+		return errors.New("ls takes at most one prefix or folder ID")
+	}
+	if err := global.loadConfig(true); err != nil {
+		return err
+	}
+	ctx, stop := signalContext()
+	defer stop()
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	defer w.Flush()
+
+	if *onDrive {
+		folderID := "root"
+		if fs.NArg() == 1 {
+			folderID = fs.Arg(0)
+		}
+		driveManager, err := newDriveManager(ctx, logger, *account, &folderID)
+		if err != nil {
+			return err
+		}
+		files, err := driveManager.ListFolder(ctx, folderID)
+		if err != nil {
+			return err
+		}
+		for _, f := range files {
+			size := report.FormatBytes(f.Size)
+			name := f.Name
+			if f.MimeType == driveFolderMimeType {
+				size, name = "-", name+"/"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", size, f.ModifiedTime, name, f.Id)
+		}
+		return nil
+	}
+
+	s3Manager, err := newS3Manager(logger)
+	if err != nil {
+		return err
+	}
+	bucket := configs.Config.S3.BucketName
+	prefix := fs.Arg(0)
+	if *versions {
+		objects, markers, err := s3Manager.ListS3ObjectVersions(ctx, bucket, prefix)
+		if err != nil {
+			return err
+		}
+		for _, v := range objects {
+			latest := ""
+			if aws.ToBool(v.IsLatest) {
+				latest = "latest"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", report.FormatBytes(aws.ToInt64(v.Size)), formatTime(aws.ToTime(v.LastModified)),
+				v.StorageClass, aws.ToString(v.Key), aws.ToString(v.VersionId), latest)
+		}
+		for _, m := range markers {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", "-", formatTime(aws.ToTime(m.LastModified)), "DELETED",
+				aws.ToString(m.Key), aws.ToString(m.VersionId), "")
+		}
+		return nil
+	}
+
+	objects, err := s3Manager.ListS3Objects(ctx, bucket, prefix)
+	if err != nil {
+		return err
+	}
+	for _, obj := range objects {
+		key := aws.ToString(obj.Key)
+		if isFolderPlaceholder(key) {
+			continue
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", report.FormatBytes(aws.ToInt64(obj.Size)), formatTime(aws.ToTime(obj.LastModified)), obj.StorageClass, key)
+	}
+	return nil
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
@@ -1,97 +1,289 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/vincent119/s3syncgoogledrive/internal/awsSDK"
 	s3 "github.com/vincent119/s3syncgoogledrive/internal/awsSDK/s3"
 	"github.com/vincent119/s3syncgoogledrive/internal/configs"
 	googlesdk "github.com/vincent119/s3syncgoogledrive/internal/googlesdk"
 	"github.com/vincent119/s3syncgoogledrive/internal/googlesdk/drive"
-	progressReader "github.com/vincent119/s3syncgoogledrive/internal/pkg/progressReader"
-	"flag"
-	"fmt"
-	"log"
-	"path/filepath"
-	"strings"
-	"sync"
+	"github.com/vincent119/s3syncgoogledrive/internal/pkg/errs"
+	"github.com/vincent119/s3syncgoogledrive/internal/pkg/logging"
+	"github.com/vincent119/s3syncgoogledrive/internal/pkg/tracing"
 )
 
+const appName = "s3sync"
+
 var debug bool
 
-func debugLog(format string, v ...any) {
-	if debug {
-		log.Printf(format, v...)
+// logger is replaced by loadConfig with one built from Log and the log flags
+var logger = slog.Default()
+
+// command is a subcommand; run receives the arguments after its name
+type command struct {
+	name  string
+	args  string
+	short string
+	run   func(args []string) error
+}
+
+var commands []command
+
+func init() {
+	// Assigned here because help refers back to the table
+	commands = []command{
+		{"sync", "-p <prefix> [flags]", "Copy S3 objects under a prefix to Google Drive", runSync},
+		{"plan", "-p <prefix> [flags]", "Show what sync would upload, skip or wait for, without changing anything", runPlan},
+		{"verify", "-p <prefix> [flags]", "Check that every S3 object under a prefix exists in Drive with the same ETag", runVerify},
+		{"ls", "[-drive] [flags] <prefix|folder-id>", "List S3 objects under a prefix, or the files in a Drive folder", runLs},
+		{"auth", "<login|add|list|remove> [flags]", "Authorize and manage Google accounts", runAuth},
+		{"config", "<validate|env> [flags]", "Validate the config or list its environment variables", runConfig},
+		{"doctor", "[flags]", "Check config, S3 access and Google Drive access", runDoctor},
+		{"help", "[command]", "Show help for a command", runHelp},
 	}
 }
 
 func main() {
-	if err := configs.Init("config"); err != nil {
-		log.Fatalf("❌ Config initialization failed: %v", err)
+	globals, args := splitGlobalArgs(os.Args[1:])
+
+	if len(args) == 0 && len(globals) == 0 {
+		printUsage()
+		os.Exit(2)
+	}
+	name, args := commandName(args)
+	cmd, ok := findCommand(name)
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n\n", name)
+		printUsage()
+		os.Exit(2)
 	}
-	// Initialize S3 Manager
-	s3Manager := s3.NewDefaultManager()
 
-	// Initialize Drive Manager
-	driveManager := drive.NewDriveManager(googlesdk.GetDriveService())
+	if err := cmd.run(append(globals, args...)); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return
+		}
+		logger.Error("❌ "+name+" failed", logging.Err(err))
+		if errors.Is(err, errs.ErrAuth) {
+			logger.Info(fmt.Sprintf("Check the AWS credentials, or run '%s auth login' to authorize Google Drive again", appName))
+		}
+		os.Exit(1)
+	}
+}
 
-	s3Prefix := flag.String("p", "", "Enter S3 prefix path (e.g.: test999)")
-	driveRootID := flag.String("droot", "root", "Google Drive root folder ID")
-	flag.BoolVar(&debug, "d", false, "Enable debug log")
-	flag.Parse()
+// isFatal reports whether err stops the whole run instead of failing one file:
+// rejected credentials fail every later request the same way
+func isFatal(err error) bool {
+	return errors.Is(err, errs.ErrAuth)
+}
 
-	if *s3Prefix == "" {
-		log.Fatal("❌ Please provide S3 prefix path, e.g.: -p=test999")
+// splitGlobalArgs moves -config/-profile given before the command name
+// (s3sync -config c.yaml auth list) behind it, where the command parses them
+func splitGlobalArgs(args []string) (globals, rest []string) {
+	for len(args) > 0 {
+		name, _, hasValue := strings.Cut(strings.TrimLeft(args[0], "-"), "=")
+		if !strings.HasPrefix(args[0], "-") || (name != "config" && name != "profile") {
+			break
+		}
+		n := 2
+		if hasValue || len(args) == 1 {
+			n = 1
+		}
+		globals = append(globals, args[:n]...)
+		args = args[n:]
 	}
+	return globals, args
+}
 
-	prefix := *s3Prefix
-	if !strings.HasSuffix(prefix, "/") {
-		prefix += "/"
+func findCommand(name string) (command, bool) {
+	for _, c := range commands {
+		if c.name == name {
+			return c, true
+		}
 	}
+	return command{}, false
+}
 
-	s3Files, err := s3Manager.ListS3Objects(configs.Config.S3.BucketName, prefix)
-	if err != nil {
-		log.Fatalf("❌ Failed to fetch S3 file list: %v", err)
+// commandName splits the command name off args. A leading -h lists the
+// commands; other flags keep the original flat usage: s3sync -p <prefix>
+func commandName(args []string) (string, []string) {
+	if len(args) == 0 {
+		return "sync", args
+	}
+	switch args[0] {
+	case "-h", "-help", "--help":
+		return "help", args[1:]
+	}
+	if strings.HasPrefix(args[0], "-") {
+		return "sync", args
 	}
-	fmt.Printf("Total S3 files fetched: %d\n", len(s3Files))
+	return args[0], args[1:]
+}
 
-	pm := progressReader.NewProgressManager()
-	semaphore := make(chan struct{}, configs.Config.Drive.MaxConcurrent)
-	var wg sync.WaitGroup
+func printUsage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s <command> [flags]\n\nCommands:\n", appName)
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-8s %s\n", c.name, c.short)
+	}
+	fmt.Fprintf(os.Stderr, "\nRun '%s <command> -h' for the flags of a command.\n", appName)
+}
 
-	for _, obj := range s3Files {
-		s3ETag := strings.Trim(*obj.ETag, "\"")
-		s3Key := *obj.Key
-		fileName := filepath.Base(s3Key)
+func runHelp(args []string) error {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		printUsage()
+		return nil
+	}
+	cmd, ok := findCommand(args[0])
+	if !ok {
+		return fmt.Errorf("unknown command %q", args[0])
+	}
+	return cmd.run([]string{"-h"})
+}
 
-		wg.Add(1)
-		semaphore <- struct{}{}
+// globalOptions are the flags every command accepts
+type globalOptions struct {
+	configPath string
+	profile    string
+	logLevel   string
+	logFormat  string
+}
 
-		go func(s3Key, s3ETag, fileName string, size int64) {
-			defer wg.Done()
-			defer func() { <-semaphore }()
+// newFlagSet creates the flag set of a command with the shared flags and help text.
+// name is the command, optionally followed by its subcommand ("auth add").
+func newFlagSet(name, args, short string) (*flag.FlagSet, *globalOptions) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s %s %s\n\n%s\n\nFlags:\n", appName, name, args, short)
+		fs.PrintDefaults()
+	}
 
-			presignedURL, err := s3Manager.GetPresignedURL(configs.Config.S3.BucketName, s3Key)
-			if err != nil {
-				debugLog("Failed to generate presigned URL %s: %v", s3Key, err)
-				return
-			}
+	opts := &globalOptions{}
+	fs.StringVar(&opts.configPath, "config", envOr("S3SYNC_CONFIG", "config"), "Config file (YAML, TOML or JSON) or directory holding base.yaml")
+	fs.StringVar(&opts.profile, "profile", os.Getenv("S3SYNC_PROFILE"), "Merge the base.<profile> overlay (e.g.: dev, prod)")
+	fs.StringVar(&opts.logLevel, "log-level", "", "Log level: debug, info, warn or error (default Log.level)")
+	fs.StringVar(&opts.logFormat, "log-format", "", "Log format: text or json (default Log.format)")
+	fs.BoolVar(&debug, "d", false, "Enable debug log (same as -log-level debug)")
+	return fs, opts
+}
+
+// newCommandFlagSet creates the flag set of a top-level command from its table entry
+func newCommandFlagSet(name string) (*flag.FlagSet, *globalOptions) {
+	cmd, _ := findCommand(name)
+	return newFlagSet(name, cmd.args, cmd.short)
+}
 
-			parentID := driveManager.SyncS3PathToDrive(s3Key, *driveRootID)
-			debugLog("Drive folder ID: %s (S3Key: %s)", parentID, s3Key)
+// loadConfig loads the config into configs.Config, validating it when validate is set,
+// and sets up logger from Log and the log flags
+func (o *globalOptions) loadConfig(validate bool) error {
+	if err := configs.InitWithOptions(configs.Options{Path: o.configPath, Profile: o.profile}); err != nil {
+		return fmt.Errorf("config initialization failed: %w", err)
+	}
+	if validate {
+		if err := configs.Validate(); err != nil {
+			return err
+		}
+	}
+	if err := o.setupLogger(); err != nil {
+		if validate {
+			return err
+		}
+		// config validate and auth still run and report the problem
+		logger.Warn("Using the default logger", logging.Err(err))
+	}
+	return nil
+}
 
-			debugLog("Checking if ETag exists: %s", s3ETag)
-			if driveManager.FileETagExistsInDrive(s3ETag, parentID) {
-				debugLog("File already exists with the same ETag, skipping upload: %s", s3Key)
-				return
-			}
+// setupLogger builds logger with flags taking precedence over Log, and routes
+// the standard log package and slog.Default through it
+func (o *globalOptions) setupLogger() error {
+	cfg := configs.Config.Log
+	if o.logLevel != "" {
+		cfg.Level = o.logLevel
+	}
+	if o.logFormat != "" {
+		cfg.Format = o.logFormat
+	}
+	if debug {
+		cfg.Level = configs.LogLevelDebug
+	}
+	l, err := logging.New(os.Stderr, cfg.Level, cfg.Format)
+	if err != nil {
+		return err
+	}
+	logger = l
+	slog.SetDefault(l)
+	return nil
+}
 
-			bar := pm.NewBar(size, fileName)
-			err = driveManager.StreamUploadWithProgress(presignedURL, s3Key, *driveRootID, s3ETag, bar)
-			if err != nil {
-				log.Printf("Failed to upload %s: %v", s3Key, err)
-			}
-		}(s3Key, s3ETag, fileName, *obj.Size)
+// envOr returns the environment variable name, or def when it is unset
+func envOr(name, def string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
 	}
+	return def
+}
 
-	wg.Wait()
-	pm.Wait()
-	fmt.Println("All uploads completed.")
+// newS3Manager connects to S3 with the loaded config
+func newS3Manager(logger *slog.Logger) (*s3.S3Manager, error) {
+	s3cfg := configs.Config.S3
+	cfg, err := awsSDK.NewDefaultAWSManager().ConnectWithS3Config(s3cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to S3: %w", err)
+	}
+	if tracing.Enabled(configs.Config.Tracing) && cfg.HTTPClient != nil {
+		// Also covers the presigned downloads, which reuse this client
+		cfg.HTTPClient = tracing.WrapDoer(cfg.HTTPClient)
+	}
+	m := s3.NewManagerFromConfig(cfg, s3cfg)
+	m.Logger = logger
+	return m, nil
+}
+
+// newDriveManager connects to Drive as account (Drive.account when empty) and
+// resolves the configured shared drive. rootID is replaced by the shared drive
+// root when it is "root".
+func newDriveManager(ctx context.Context, logger *slog.Logger, account string, rootID *string) (*drive.DriveManager, error) {
+	if account == "" {
+		account = configs.Config.Drive.Account
+	}
+	srv, err := newAuthManager(logger).DriveServiceFor(account)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Drive service: %w", err)
+	}
+	driveManager := drive.NewDriveManager(srv)
+	driveManager.Logger = logger
+	driveManager.Metadata = configs.Config.Drive.Metadata
+
+	if configs.Config.Drive.SharedDrive != "" {
+		driveID, err := driveManager.ResolveSharedDrive(ctx, configs.Config.Drive.SharedDrive)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve shared drive: %w", err)
+		}
+		driveManager.DriveID = driveID
+		if rootID != nil && *rootID == "root" {
+			*rootID = driveID
+		}
+	}
+	return driveManager, nil
+}
+
+// newAuthManager creates the Google AuthManager logging to logger
+func newAuthManager(logger *slog.Logger) *googlesdk.AuthManager {
+	manager := googlesdk.NewDefaultAuthManager()
+	manager.Logger = logger
+	return manager
+}
+
+// normalizePrefix makes prefix match whole folders
+func normalizePrefix(prefix string) string {
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	return prefix
 }
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestCommandName(t *testing.T) {
+	tests := []struct {
+		args     []string
+		wantName string
+		wantArgs []string
+	}{
+		{nil, "sync", nil},
+		{[]string{"-p", "logs/"}, "sync", []string{"-p", "logs/"}},
+		{[]string{"plan", "-p", "logs/"}, "plan", []string{"-p", "logs/"}},
+		{[]string{"-h"}, "help", []string{}},
+		{[]string{"-help"}, "help", []string{}},
+		{[]string{"--help"}, "help", []string{}},
+	}
+
+	for _, tt := range tests {
+		name, args := commandName(tt.args)
+		if name != tt.wantName || !slices.Equal(args, tt.wantArgs) {
+			t.Errorf("commandName(%q) = %q, %q; want %q, %q", tt.args, name, args, tt.wantName, tt.wantArgs)
+		}
+	}
+}
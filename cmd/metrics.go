@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/vincent119/s3syncgoogledrive/internal/configs"
+	"github.com/vincent119/s3syncgoogledrive/internal/pkg/logging"
+	"github.com/vincent119/s3syncgoogledrive/internal/pkg/metrics"
+)
+
+// metricsPushTimeout bounds the Pushgateway request made when a run ends
+const metricsPushTimeout = 30 * time.Second
+
+// metricsOptions override the Metrics config section
+type metricsOptions struct {
+	listen      string
+	pushGateway string
+}
+
+func addMetricsFlags(fs *flag.FlagSet) *metricsOptions {
+	o := &metricsOptions{}
+	fs.StringVar(&o.listen, "metrics-listen", "", "Serve Prometheus metrics at http://<addr>/metrics while syncing (default Metrics.listen)")
+	fs.StringVar(&o.pushGateway, "metrics-push", "", "Push the metrics to this Pushgateway URL when the run ends (default Metrics.pushGateway)")
+	return o
+}
+
+// config returns the Metrics config with the flags applied
+func (o *metricsOptions) config() configs.MetricsConfig {
+	cfg := configs.Config.Metrics
+	if o.listen != "" {
+		cfg.Listen = o.listen
+	}
+	if o.pushGateway != "" {
+		cfg.PushGateway = o.pushGateway
+	}
+	return cfg
+}
+
+// startMetrics returns the metrics to record into, or nil when neither serving
+// nor pushing is configured, and serves them on cfg.Listen until stop is called
+func startMetrics(logger *slog.Logger, cfg configs.MetricsConfig) (m *metrics.Sync, stop func(), err error) {
+	if cfg.Listen == "" && cfg.PushGateway == "" {
+		return nil, func() {}, nil
+	}
+	m = metrics.NewSync()
+	if cfg.Listen == "" {
+		return m, func() {}, nil
+	}
+
+	// Listen before returning so a port in use fails the run instead of a log line
+	ln, err := net.Listen("tcp", cfg.Listen)
+	if err != nil {
+		return nil, nil, fmt.Errorf("metrics listener: %w", err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", m.Registry.Handler())
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("Metrics server stopped", logging.Err(err))
+		}
+	}()
+	logger.Info("Serving metrics", "addr", "http://"+ln.Addr().String()+"/metrics")
+
+	return m, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(ctx)
+	}, nil
+}
+
+// pushMetrics sends m to the Pushgateway in cfg, if any. A failed push is
+// logged; it does not fail a sync whose files were copied.
+func pushMetrics(logger *slog.Logger, m *metrics.Sync, cfg configs.MetricsConfig) {
+	if m == nil || cfg.PushGateway == "" {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), metricsPushTimeout)
+	defer cancel()
+	if err := m.Registry.Push(ctx, nil, cfg.PushGateway, cfg.ResolvedJob()); err != nil {
+		logger.Warn("Failed to push metrics", logging.Err(err))
+		return
+	}
+	logger.Info("Pushed metrics", "url", cfg.PushGateway, "job", cfg.ResolvedJob())
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/vincent119/s3syncgoogledrive/internal/pkg/logging"
+	"github.com/vincent119/s3syncgoogledrive/internal/pkg/notify"
+	"github.com/vincent119/s3syncgoogledrive/internal/pkg/report"
+)
+
+// notifyTimeout bounds sending one event to every channel
+const notifyTimeout = 30 * time.Second
+
+// sendNotification sends msg to the Notifiers channels. Unreachable channels
+// are logged; they do not fail the sync.
+func sendNotification(logger *slog.Logger, d *notify.Dispatcher, msg notify.Message) {
+	if d.Len() == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+	defer cancel()
+	if err := d.Notify(ctx, msg); err != nil {
+		logger.Warn("Failed to send notification", "event", msg.Event, logging.Err(err))
+	}
+}
+
+// endMessage describes a run that returned err; rep is nil when it stopped before listing files
+func endMessage(runID, prefix string, rep *report.Report, err error) notify.Message {
+	msg := notify.Message{Event: notify.Success, RunID: runID, Prefix: prefix, Report: rep}
+	if err != nil {
+		msg.Event = notify.Failure
+		msg.Error = err.Error()
+	}
+	return msg
+}
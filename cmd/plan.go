@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	s3 "github.com/vincent119/s3syncgoogledrive/internal/awsSDK/s3"
+	"github.com/vincent119/s3syncgoogledrive/internal/configs"
+	"github.com/vincent119/s3syncgoogledrive/internal/googlesdk/drive"
+	"github.com/vincent119/s3syncgoogledrive/internal/pkg/limiter"
+	"github.com/vincent119/s3syncgoogledrive/internal/pkg/report"
+)
+
+// planAction is what sync would do with one item
+type planAction string
+
+const (
+	planUpload  planAction = "UPLOAD"
+	planSkip    planAction = "SKIP"
+	planRestore planAction = "RESTORE"
+	planError   planAction = "ERROR"
+	planExclude planAction = "EXCLUDE"
+)
+
+type planEntry struct {
+	item   syncItem
+	action planAction
+	detail string
+}
+
+// runPlan reports what sync would do without creating folders, uploading or requesting restores
+func runPlan(args []string) error {
+	fs, global := newCommandFlagSet("plan")
+	opts := addSyncFlags(fs, true)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := opts.check(); err != nil {
+		return err
+	}
+	if err := global.loadConfig(true); err != nil {
+		return err
+	}
+	ctx, stop := signalContext()
+	defer stop()
+
+	s3Manager, err := newS3Manager(logger)
+	if err != nil {
+		return err
+	}
+	driveManager, err := newDriveManager(ctx, logger, opts.account, &opts.rootID)
+	if err != nil {
+		return err
+	}
+
+	items, err := listSyncItems(ctx, s3Manager, normalizePrefix(opts.prefix), opts.asOfTime, opts.allVersions)
+	if err != nil {
+		return fmt.Errorf("failed to fetch S3 file list: %w", err)
+	}
+
+	entries := make([]planEntry, len(items))
+	workers := limiter.New(configs.Config.Drive.MaxConcurrent)
+	// An interrupted run stops here instead of printing partial results
+	if err := workers.ForEach(ctx, len(items), func(i int) {
+		entries[i] = planItem(ctx, s3Manager, driveManager, items[i], opts)
+	}); err != nil {
+		return fmt.Errorf("plan interrupted: %w", err)
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].item.s3Key < entries[j].item.s3Key })
+	counts := make(map[planAction]int)
+	var uploadBytes int64
+	for _, e := range entries {
+		counts[e.action]++
+		if e.action == planUpload {
+			uploadBytes += e.item.size
+		}
+		name := e.item.s3Key
+		if opts.allVersions {
+			name += " (" + e.item.versionID + ")"
+		}
+		fmt.Printf("%-8s %s  %s\n", e.action, name, e.detail)
+	}
+	fmt.Printf("\nPlan: %d to upload (%s), %d already in Drive, %d waiting for restore, %d excluded, %d errors\n",
+		counts[planUpload], report.FormatBytes(uploadBytes), counts[planSkip], counts[planRestore], counts[planExclude], counts[planError])
+	return nil
+}
+
+// planItem mirrors the decisions of sync using read-only lookups
+func planItem(ctx context.Context, s3Manager *s3.S3Manager, driveManager *drive.DriveManager, item syncItem, opts *syncOptions) planEntry {
+	if isFolderPlaceholder(item.s3Key) {
+		return planEntry{item: item, action: planExclude, detail: "folder placeholder"}
+	}
+	entry := planEntry{item: item, action: planUpload, detail: report.FormatBytes(item.size)}
+
+	parentID, found, err := driveManager.FindFolderPath(ctx, item.s3Key, opts.rootID)
+	if err != nil {
+		return planEntry{item: item, action: planError, detail: err.Error()}
+	}
+	if found {
+		existing, err := findExisting(ctx, driveManager, item, parentID, opts.allVersions)
+		switch {
+		case err != nil:
+			return planEntry{item: item, action: planError, detail: err.Error()}
+		case existing != nil:
+			return planEntry{item: item, action: planSkip, detail: "already in Drive"}
+		}
+	} else {
+		entry.detail += ", new folder"
+	}
+
+	if s3.IsArchivedStorageClass(item.storageClass) {
+		status, err := s3Manager.GetRestoreStatus(ctx, configs.Config.S3.BucketName, item.s3Key, item.versionID)
+		if err != nil {
+			return planEntry{item: item, action: planError, detail: err.Error()}
+		}
+		if status != s3.RestoreCompleted {
+			return planEntry{item: item, action: planRestore, detail: fmt.Sprintf("%s, restore %s", item.storageClass, status)}
+		}
+	}
+	return entry
+}
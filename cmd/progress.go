@@ -0,0 +1,56 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/vincent119/s3syncgoogledrive/internal/pkg/progressReader"
+)
+
+// progressOptions choose how upload progress is shown
+type progressOptions struct {
+	mode     string
+	quiet    bool
+	interval time.Duration
+}
+
+func addProgressFlags(fs *flag.FlagSet) *progressOptions {
+	o := &progressOptions{}
+	fs.StringVar(&o.mode, "progress", progressReader.ModeAuto, "Progress output: "+strings.Join(progressReader.Modes, " | ")+" (auto draws bars only on a terminal)")
+	fs.BoolVar(&o.quiet, "quiet", false, "Show no upload progress, same as -progress quiet")
+	fs.DurationVar(&o.interval, "progress-interval", progressReader.DefaultInterval, "How often plain and json progress lines are written")
+	return o
+}
+
+func (o *progressOptions) check() error {
+	if o.quiet && o.mode != progressReader.ModeAuto && o.mode != progressReader.ModeQuiet {
+		return errors.New("-quiet and -progress cannot be used together")
+	}
+	if !slices.Contains(progressReader.Modes, o.mode) {
+		return fmt.Errorf("-progress must be one of %s", strings.Join(progressReader.Modes, ", "))
+	}
+	if o.interval <= 0 {
+		return errors.New("-progress-interval must be positive")
+	}
+	return nil
+}
+
+// jsonLines reports whether stdout carries NDJSON progress events, which
+// nothing else may be printed between
+func (o *progressOptions) jsonLines() bool {
+	return o.mode == progressReader.ModeJSON && !o.quiet
+}
+
+// manager returns the progress renderer writing to stdout
+func (o *progressOptions) manager() (*progressReader.ProgressManager, error) {
+	mode := o.mode
+	if o.quiet {
+		mode = progressReader.ModeQuiet
+	}
+	return progressReader.New(mode, os.Stdout, o.interval)
+}
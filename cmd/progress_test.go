@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/vincent119/s3syncgoogledrive/internal/pkg/progressReader"
+	"github.com/vincent119/s3syncgoogledrive/internal/pkg/report"
+)
+
+func TestJSONProgressKeepsStdoutParseable(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	null, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer null.Close()
+	stdout, stderr := os.Stdout, os.Stderr
+	os.Stdout, os.Stderr = w, null
+	defer func() { os.Stdout, os.Stderr = stdout, stderr }()
+
+	opts := &progressOptions{mode: progressReader.ModeJSON, interval: time.Millisecond}
+	pm, err := opts.manager()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pm.SetTotal(2, 8)
+	bar := pm.NewBar(4, "a.txt")
+	bar.IncrBy(4)
+	pm.Done(4, true)
+	pm.Failed()
+	pm.Wait()
+
+	rec := report.NewRecorder("run", "prefix")
+	rec.Add(report.Uploaded, 4)
+	out := textOutput("", opts.jsonLines())
+	if err := writeReport(rec.Finish(), "", out); err != nil {
+		t.Fatal(err)
+	}
+	fmt.Fprintln(out, "Copy the remaining files with: s3sync sync -resume run")
+	w.Close()
+
+	lines := 0
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		lines++
+		var event map[string]any
+		if err := json.Unmarshal(sc.Bytes(), &event); err != nil {
+			t.Errorf("stdout line %q is not JSON: %v", sc.Text(), err)
+		}
+	}
+	if lines == 0 {
+		t.Error("no progress events on stdout")
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// defaultShutdownGrace is how long running uploads may take after the first signal
+const defaultShutdownGrace = time.Minute
+
+// errInterrupted is the cause of a run stopped by SIGINT or SIGTERM
+var errInterrupted = errors.New("interrupted")
+
+// handleShutdown calls drain on the first SIGINT or SIGTERM, so no new files
+// start, and kill on a second one or once grace has passed, so running
+// transfers are cancelled. After kill the signals get their default
+// behaviour back, and a third one ends the process. stop releases the signals.
+func handleShutdown(logger *slog.Logger, grace time.Duration, drain, kill func(cause error)) (stop func()) {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	done := make(chan struct{})
+
+	go func() {
+		select {
+		case sig := <-sigs:
+			logger.Warn("Stopping after the running uploads, signal again to abort", "signal", sig.String(), "grace", grace)
+			drain(fmt.Errorf("%w by %s", errInterrupted, sig))
+		case <-done:
+			return
+		}
+
+		timer := time.NewTimer(grace)
+		defer timer.Stop()
+		select {
+		case sig := <-sigs:
+			logger.Warn("Aborting the running uploads", "signal", sig.String())
+			kill(fmt.Errorf("%w by a second %s", errInterrupted, sig))
+		case <-timer.C:
+			logger.Warn("Aborting the running uploads, shutdown grace period is over", "grace", grace)
+			kill(fmt.Errorf("%w: uploads still running after %s", errInterrupted, grace))
+		case <-done:
+			return
+		}
+		signal.Stop(sigs)
+	}()
+
+	return func() {
+		signal.Stop(sigs)
+		close(done)
+	}
+}
+
+// signalContext is cancelled by SIGINT or SIGTERM, for commands without
+// transfers to drain. stop releases the signals.
+func signalContext() (ctx context.Context, stop context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+}
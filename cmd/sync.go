@@ -0,0 +1,554 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+
+	s3 "github.com/vincent119/s3syncgoogledrive/internal/awsSDK/s3"
+	"github.com/vincent119/s3syncgoogledrive/internal/configs"
+	"github.com/vincent119/s3syncgoogledrive/internal/googlesdk/drive"
+	"github.com/vincent119/s3syncgoogledrive/internal/pkg/journal"
+	"github.com/vincent119/s3syncgoogledrive/internal/pkg/limiter"
+	"github.com/vincent119/s3syncgoogledrive/internal/pkg/logging"
+	"github.com/vincent119/s3syncgoogledrive/internal/pkg/notify"
+	"github.com/vincent119/s3syncgoogledrive/internal/pkg/report"
+	"github.com/vincent119/s3syncgoogledrive/internal/pkg/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	gdrive "google.golang.org/api/drive/v3"
+)
+
+// syncItem is a single S3 object (or object version) to copy to Drive
+type syncItem struct {
+	s3Key        string
+	s3ETag       string
+	versionID    string
+	fileName     string
+	storageClass string
+	size         int64
+	lastModified time.Time
+}
+
+// syncOptions are the flags shared by sync, plan and verify
+type syncOptions struct {
+	prefix      string
+	rootID      string
+	asOf        string
+	asOfTime    time.Time // asOf parsed by check, zero without -as-of
+	allVersions bool
+	account     string
+}
+
+func addSyncFlags(fs *flag.FlagSet, versions bool) *syncOptions {
+	o := &syncOptions{}
+	fs.StringVar(&o.prefix, "p", "", "Enter S3 prefix path (e.g.: test999)")
+	fs.StringVar(&o.rootID, "droot", "root", "Google Drive root folder ID")
+	fs.StringVar(&o.asOf, "as-of", "", "Use the prefix as it was at this time (RFC3339, e.g.: 2024-01-31T00:00:00Z)")
+	if versions {
+		fs.BoolVar(&o.allVersions, "all-versions", false, "Sync every S3 object version as a separate Drive file")
+	}
+	fs.StringVar(&o.account, "account", "", "Named Google account to use (default Drive.account, see auth list)")
+	return o
+}
+
+func (o *syncOptions) check() error {
+	if o.prefix == "" {
+		return errors.New("please provide S3 prefix path, e.g.: -p=test999")
+	}
+	if o.asOf != "" && o.allVersions {
+		return errors.New("-as-of and -all-versions cannot be used together")
+	}
+	return o.parseAsOf()
+}
+
+// parseAsOf sets asOfTime, so a mistyped -as-of fails before any listing
+func (o *syncOptions) parseAsOf() error {
+	o.asOfTime = time.Time{}
+	if o.asOf == "" {
+		return nil
+	}
+	t, err := time.Parse(time.RFC3339, o.asOf)
+	if err != nil {
+		return fmt.Errorf("invalid -as-of time %q: %w", o.asOf, err)
+	}
+	o.asOfTime = t
+	return nil
+}
+
+func runSync(args []string) (err error) {
+	fs, global := newCommandFlagSet("sync")
+	opts := addSyncFlags(fs, true)
+	watch := fs.Bool("watch", false, "Reload config changes (concurrency, metadata, restore) while syncing")
+	reportPath := fs.String("report", "", "Also write the run report as JSON to this file (- for stdout)")
+	resumeID := fs.String("resume", "", "Continue the run with this ID from its journal: finished files are skipped, the rest copied again")
+	grace := fs.Duration("shutdown-grace", defaultShutdownGrace, "After SIGINT/SIGTERM, how long running uploads may take before they are aborted")
+	metricsOpts := addMetricsFlags(fs)
+	progressOpts := addProgressFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := progressOpts.check(); err != nil {
+		return err
+	}
+	if progressOpts.jsonLines() && *reportPath == "-" {
+		return errors.New("-report - and -progress json cannot both write to stdout")
+	}
+	if *resumeID != "" {
+		if err := checkResume(fs); err != nil {
+			return err
+		}
+	} else if err := opts.check(); err != nil {
+		return err
+	}
+	if err := global.loadConfig(true); err != nil {
+		return err
+	}
+
+	runID := logging.NewRunID()
+	var replay *journal.Replay
+	if *resumeID != "" {
+		if replay, err = journal.Load(configs.Config.Journal.ResolvedDir(), *resumeID); err != nil {
+			return err
+		}
+		runID = *resumeID
+		if err := opts.restore(replay.Run); err != nil {
+			return err
+		}
+	}
+	runLog := logger.With(logging.KeyRunID, runID)
+	runLog.Info("Sync started", "prefix", opts.prefix, "drive_root", opts.rootID, "resume", replay != nil)
+
+	jw, err := openJournal(runID, opts, replay != nil)
+	if err != nil {
+		return err
+	}
+	defer closeJournal(runLog, jw)
+
+	stopTracing, err := startTracing(runLog)
+	if err != nil {
+		return err
+	}
+	defer stopTracing()
+	runCtx, runSpan := tracing.Start(context.Background(), "sync",
+		tracing.KeyRunID.String(runID), attribute.String("s3.prefix", opts.prefix))
+	defer func() { tracing.End(runSpan, err) }()
+
+	// kill cancels every call of the run. abort only stops new files from
+	// starting, on a fatal error or the first signal: running uploads finish.
+	runCtx, kill := context.WithCancelCause(runCtx)
+	defer kill(nil)
+	ctx, abort := context.WithCancelCause(runCtx)
+	defer abort(nil)
+	stopSignals := handleShutdown(runLog, *grace, abort, kill)
+	defer stopSignals()
+
+	notifier, err := notify.New(configs.Config.Notifiers, nil)
+	if err != nil {
+		return err
+	}
+	sendNotification(runLog, notifier, notify.Message{Event: notify.Start, RunID: runID, Prefix: opts.prefix})
+	var rep *report.Report
+	defer func() { sendNotification(runLog, notifier, endMessage(runID, opts.prefix, rep, err)) }()
+
+	s3Manager, err := newS3Manager(runLog)
+	if err != nil {
+		return err
+	}
+	driveManager, err := newDriveManager(ctx, runLog, opts.account, &opts.rootID)
+	if err != nil {
+		return err
+	}
+	if s3Manager.HTTPClient != nil {
+		driveManager.DownloadClient = s3Manager.HTTPClient
+	}
+
+	metricsCfg := metricsOpts.config()
+	met, stopMetrics, err := startMetrics(runLog, metricsCfg)
+	if err != nil {
+		return err
+	}
+	defer stopMetrics()
+	defer pushMetrics(runLog, met, metricsCfg)
+	s3Manager.Metrics = met
+	driveManager.Metrics = met
+
+	workers := limiter.New(configs.Config.Drive.MaxConcurrent)
+	watcher := configs.NewWatcher(configs.CurrentSource())
+	watcher.Logger = runLog
+	watcher.OnReload = func(old, new configs.BaseConfig) {
+		for _, key := range configs.ChangedKeys(old, new) {
+			if configs.Reloadable(key) {
+				runLog.Info("Config reloaded", "key", key)
+			} else {
+				runLog.Warn("Config changed, takes effect after a restart", "key", key)
+			}
+		}
+		workers.SetLimit(new.Drive.MaxConcurrent)
+		driveManager.SetMetadata(new.Drive.Metadata)
+	}
+	if *watch {
+		watchCtx, stopWatch := context.WithCancel(context.Background())
+		defer stopWatch()
+		go func() {
+			if err := watcher.Run(watchCtx); err != nil {
+				runLog.Error("Config hot reload disabled", logging.Err(err))
+			}
+		}()
+	}
+
+	// A resumed run copies what its journal has not marked done, without listing S3 again
+	var items, finished []syncItem
+	if replay != nil {
+		items, finished = resumeItems(replay.Files)
+		runLog.Info("Resuming run from its journal", "done", len(finished), "remaining", len(items))
+	} else {
+		items, err = listSyncItems(ctx, s3Manager, normalizePrefix(opts.prefix), opts.asOfTime, opts.allVersions)
+		if err != nil {
+			if cause := context.Cause(ctx); cause != nil {
+				return fmt.Errorf("sync aborted: %w", cause)
+			}
+			return fmt.Errorf("failed to fetch S3 file list: %w", err)
+		}
+		runLog.Info("Fetched S3 file list", "count", len(items))
+
+		queued := make([]journal.Record, 0, len(items))
+		for _, item := range items {
+			if !isFolderPlaceholder(item.s3Key) {
+				queued = append(queued, queuedRecord(item))
+			}
+		}
+		jw.Write(queued...)
+	}
+
+	rec := report.NewRecorder(runID, opts.prefix)
+	pm, err := progressOpts.manager()
+	if err != nil {
+		return err
+	}
+	pm.SetTotal(countFiles(items, finished))
+	var wg sync.WaitGroup
+	done := func(ctx context.Context, status report.Status, item syncItem) {
+		if status != report.Excluded {
+			pm.Done(item.size, status == report.Uploaded)
+		}
+		rec.Add(status, item.size)
+		met.File(string(status), item.size)
+		trace.SpanFromContext(ctx).SetAttributes(tracing.KeyStatus.String(string(status)))
+	}
+	pend := func(ctx context.Context, item syncItem, reason string) {
+		r := fileRecord(journal.Pending, item)
+		r.Error = reason
+		jw.Write(r)
+		pm.Done(item.size, false)
+		rec.Pend(item.s3Key, item.versionID, item.size, reason)
+		met.File(string(report.Pending), item.size)
+		trace.SpanFromContext(ctx).SetAttributes(tracing.KeyStatus.String(string(report.Pending)))
+	}
+	recordFailure := func(item syncItem, err error) {
+		rec.Fail(item.s3Key, item.versionID, item.size, err)
+		met.File(string(report.Failed), item.size)
+		met.Failure(err)
+		pm.Failed()
+	}
+	fail := func(ctx context.Context, item syncItem, err error) {
+		if errors.Is(err, context.Canceled) && runCtx.Err() != nil {
+			err = fmt.Errorf("aborted: %w", context.Cause(runCtx))
+		}
+		runLog.Error("Sync failed", logging.KeyS3Key, item.s3Key, logging.Err(err))
+		recordFailure(item, err)
+		r := fileRecord(journal.Failed, item)
+		r.Error = err.Error()
+		jw.Write(r)
+		span := trace.SpanFromContext(ctx)
+		span.SetAttributes(tracing.KeyStatus.String(string(report.Failed)))
+		tracing.SetError(span, err)
+		if isFatal(err) {
+			abort(err)
+		}
+	}
+
+	for _, item := range finished {
+		done(ctx, report.Skipped, item)
+	}
+	for i, item := range items {
+		if isFolderPlaceholder(item.s3Key) {
+			done(ctx, report.Excluded, item)
+			continue
+		}
+
+		// The file span starts before waiting for a worker, so time spent
+		// throttled by Drive.maxConcurrent shows up in the trace
+		fileCtx, fileSpan := tracing.Start(runCtx, "sync.file", fileAttributes(item)...)
+		_, waitSpan := tracing.Start(fileCtx, "wait_for_worker")
+		err := workers.Acquire(ctx)
+		tracing.End(waitSpan, err)
+		if err != nil {
+			tracing.End(fileSpan, err)
+			recordNotStarted(items[i:], context.Cause(ctx),
+				func(item syncItem) { done(ctx, report.Excluded, item) }, recordFailure)
+			break
+		}
+		wg.Add(1)
+
+		go func(ctx context.Context, item syncItem) {
+			defer wg.Done()
+			defer workers.Release()
+			defer trace.SpanFromContext(ctx).End()
+			itemLog := runLog.With(logging.KeyS3Key, item.s3Key)
+			jw.Write(fileRecord(journal.Uploading, item))
+
+			phaseCtx, span := tracing.Start(ctx, "resolve_folder")
+			parentID, err := driveManager.SyncS3PathToDrive(phaseCtx, item.s3Key, opts.rootID)
+			tracing.End(span, err)
+			if err != nil {
+				fail(ctx, item, err)
+				return
+			}
+			itemLog.Debug("Resolved Drive folder", logging.KeyDriveID, parentID)
+
+			upload := drive.UploadOptions{VersionID: item.versionID}
+			phaseCtx, span = tracing.Start(ctx, "check_existing", tracing.KeyDriveID.String(parentID))
+			if opts.allVersions {
+				upload.FileName = drive.VersionedFileName(filepath.Base(item.s3Key), item.versionID)
+			}
+			// A failed lookup fails the file: skipping it would report and journal an upload that never happened
+			existing, err := findExisting(phaseCtx, driveManager, item, parentID, opts.allVersions)
+			tracing.End(span, err)
+			if err != nil {
+				fail(ctx, item, fmt.Errorf("check existing file: %w", err))
+				return
+			}
+			if existing != nil {
+				itemLog.Debug("File already exists in Drive, skipping upload", "s3etag", item.s3ETag, "version_id", item.versionID)
+				jw.Write(fileRecord(journal.Done, item))
+				done(ctx, report.Skipped, item)
+				return
+			}
+
+			if s3.IsArchivedStorageClass(item.storageClass) {
+				phaseCtx, span = tracing.Start(ctx, "restore_status")
+				status, err := restoreStatus(phaseCtx, s3Manager, watcher.Current().S3.Restore, item)
+				tracing.End(span, err)
+				if err != nil {
+					fail(ctx, item, fmt.Errorf("restore status: %w", err))
+					return
+				}
+				if status != s3.RestoreCompleted {
+					itemLog.Debug("Archived object not yet available", "restore", status)
+					pend(ctx, item, fmt.Sprintf("%s, restore %s", item.storageClass, status))
+					return
+				}
+			}
+
+			phaseCtx, span = tracing.Start(ctx, "presign")
+			var presignedURL string
+			if item.versionID != "" {
+				presignedURL, err = s3Manager.GetPresignedVersionURL(phaseCtx, configs.Config.S3.BucketName, item.s3Key, item.versionID)
+			} else {
+				presignedURL, err = s3Manager.GetPresignedURL(phaseCtx, configs.Config.S3.BucketName, item.s3Key)
+			}
+			tracing.End(span, err)
+			if err != nil {
+				fail(ctx, item, err)
+				return
+			}
+
+			upload.ModifiedTime = item.lastModified
+			if watcher.Current().Drive.Metadata.UsesTags() {
+				tags, err := s3Manager.GetObjectTags(ctx, configs.Config.S3.BucketName, item.s3Key, item.versionID)
+				if err != nil {
+					itemLog.Warn("Uploading without tags", logging.Err(err))
+				}
+				upload.Tags = tags
+			}
+
+			phaseCtx, span = tracing.Start(ctx, "upload")
+			bar := pm.NewBar(item.size, item.fileName)
+			file, err := driveManager.StreamUpload(phaseCtx, presignedURL, item.s3Key, opts.rootID, item.s3ETag, upload, bar)
+			if errors.Is(err, drive.ErrAlreadyUploading) {
+				span.End()
+				// Not journaled as done: -resume retries it if the other upload did not finish
+				itemLog.Debug("Object is already being uploaded, skipping")
+				done(ctx, report.Skipped, item)
+				return
+			}
+			tracing.End(span, err)
+			if err != nil {
+				pm.Discard(bar)
+				fail(ctx, item, err)
+				return
+			}
+			r := fileRecord(journal.Done, item)
+			r.DriveID = file.Id
+			jw.Write(r)
+			done(ctx, report.Uploaded, item)
+		}(fileCtx, item)
+	}
+
+	wg.Wait()
+	pm.Wait()
+	cause := context.Cause(ctx)
+	if cause != nil {
+		rec.Abort(cause)
+	}
+	rep = rec.Finish()
+	out := textOutput(*reportPath, progressOpts.jsonLines())
+	if err := writeReport(rep, *reportPath, out); err != nil {
+		runLog.Error("Failed to write run report", logging.Err(err))
+	}
+	if len(rep.PendingRestores) > 0 && !watcher.Current().S3.Restore.Enabled {
+		fmt.Fprintln(out, "Set S3.restore.enabled to request restores automatically.")
+	}
+	if jw != nil && (rep.Failed() || len(rep.PendingRestores) > 0) {
+		fmt.Fprintf(out, "Copy the remaining files with: %s sync -resume %s\n", appName, runID)
+	}
+	runLog.Info("Sync finished", logging.KeyDuration, rep.Duration(), logging.KeyBytes, rep.Counts[report.Uploaded].Bytes,
+		"uploaded", rep.Counts[report.Uploaded].Files, "failed", rep.Counts[report.Failed].Files)
+
+	switch {
+	case cause != nil:
+		return fmt.Errorf("sync aborted: %w", cause)
+	case rep.Failed():
+		return fmt.Errorf("%d of %d files failed", rep.Counts[report.Failed].Files, rep.Total().Files)
+	}
+	return nil
+}
+
+// textOutput is where sync prints the summary table and hints: stderr when
+// stdout carries the JSON report or JSON progress, so that stays parseable
+func textOutput(reportPath string, jsonProgress bool) io.Writer {
+	if reportPath == "-" || jsonProgress {
+		return os.Stderr
+	}
+	return os.Stdout
+}
+
+// writeReport prints the summary table to out and writes the JSON report when path is set
+func writeReport(rep *report.Report, path string, out io.Writer) error {
+	if err := rep.WriteTable(out); err != nil {
+		return err
+	}
+	if path == "" {
+		return nil
+	}
+	return rep.WriteJSONFile(path)
+}
+
+// isFolderPlaceholder reports whether key is an empty "folder/" object created by
+// the S3 console; it has no content to copy and its folder is created with the files
+func isFolderPlaceholder(key string) bool {
+	return strings.HasSuffix(key, "/")
+}
+
+// recordNotStarted settles the items left queued when a run aborts: folder
+// placeholders are excluded as they would have been, the rest fail with cause
+func recordNotStarted(items []syncItem, cause error, excluded func(syncItem), failed func(syncItem, error)) {
+	for _, item := range items {
+		if isFolderPlaceholder(item.s3Key) {
+			excluded(item)
+			continue
+		}
+		failed(item, fmt.Errorf("not started: %w", cause))
+	}
+}
+
+// findExisting returns the Drive file under parentID already copied from item,
+// matched by version with allVersions and by ETag otherwise, or nil
+func findExisting(ctx context.Context, driveManager *drive.DriveManager, item syncItem, parentID string, allVersions bool) (*gdrive.File, error) {
+	if allVersions {
+		return driveManager.FindFileByVersion(ctx, item.versionID, parentID)
+	}
+	return driveManager.FindFileByETag(ctx, item.s3ETag, parentID)
+}
+
+// countFiles returns the files and bytes a run copies or finds already done
+func countFiles(lists ...[]syncItem) (files int, bytes int64) {
+	for _, items := range lists {
+		for _, item := range items {
+			if !isFolderPlaceholder(item.s3Key) {
+				files++
+				bytes += item.size
+			}
+		}
+	}
+	return files, bytes
+}
+
+// fileAttributes describes item on its trace spans
+func fileAttributes(item syncItem) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{
+		tracing.KeyS3Key.String(item.s3Key),
+		tracing.KeySize.Int64(item.size),
+		tracing.KeyStorageClass.String(item.storageClass),
+	}
+	if item.versionID != "" {
+		attrs = append(attrs, tracing.KeyVersionID.String(item.versionID))
+	}
+	return attrs
+}
+
+// restoreStatus checks an archived object, requesting a restore when enabled in config
+func restoreStatus(ctx context.Context, s3Manager *s3.S3Manager, restore configs.RestoreConfig, item syncItem) (s3.RestoreStatus, error) {
+	bucket := configs.Config.S3.BucketName
+	if !restore.Enabled {
+		return s3Manager.GetRestoreStatus(ctx, bucket, item.s3Key, item.versionID)
+	}
+	return s3Manager.EnsureRestored(ctx, bucket, item.s3Key, item.versionID, restore.Days, restore.Tier)
+}
+
+// listSyncItems lists the current objects, the snapshot at asOf when it is set,
+// or every version under prefix
+func listSyncItems(ctx context.Context, s3Manager *s3.S3Manager, prefix string, asOf time.Time, allVersions bool) ([]syncItem, error) {
+	bucket := configs.Config.S3.BucketName
+	if asOf.IsZero() && !allVersions {
+		objects, err := s3Manager.ListS3Objects(ctx, bucket, prefix)
+		if err != nil {
+			return nil, err
+		}
+		items := make([]syncItem, 0, len(objects))
+		for _, obj := range objects {
+			items = append(items, syncItem{
+				s3Key:        aws.ToString(obj.Key),
+				s3ETag:       strings.Trim(aws.ToString(obj.ETag), "\""),
+				fileName:     filepath.Base(aws.ToString(obj.Key)),
+				storageClass: string(obj.StorageClass),
+				size:         aws.ToInt64(obj.Size),
+				lastModified: aws.ToTime(obj.LastModified),
+			})
+		}
+		return items, nil
+	}
+
+	versions, markers, err := s3Manager.ListS3ObjectVersions(ctx, bucket, prefix)
+	if err != nil {
+		return nil, err
+	}
+	if !asOf.IsZero() {
+		versions = s3.SelectVersionsAsOf(versions, markers, asOf)
+	}
+
+	items := make([]syncItem, 0, len(versions))
+	for _, v := range versions {
+		items = append(items, syncItem{
+			s3Key:        aws.ToString(v.Key),
+			s3ETag:       strings.Trim(aws.ToString(v.ETag), "\""),
+			versionID:    aws.ToString(v.VersionId),
+			fileName:     filepath.Base(aws.ToString(v.Key)),
+			storageClass: string(v.StorageClass),
+			size:         aws.ToInt64(v.Size),
+			lastModified: aws.ToTime(v.LastModified),
+		})
+	}
+	return items, nil
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestSyncOptionsCheckAsOf(t *testing.T) {
+	o := &syncOptions{prefix: "p", asOf: "2024-01-31T00:00:00Z"}
+	if err := o.check(); err != nil {
+		t.Fatalf("check() error = %v", err)
+	}
+	if want := time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC); !o.asOfTime.Equal(want) {
+		t.Errorf("asOfTime = %v, want %v", o.asOfTime, want)
+	}
+
+	// A typo fails before anything is listed
+	o = &syncOptions{prefix: "p", asOf: "2024-01-31"}
+	if err := o.check(); err == nil {
+		t.Error("check() accepted an -as-of without a time")
+	}
+
+	o = &syncOptions{prefix: "p"}
+	if err := o.check(); err != nil || !o.asOfTime.IsZero() {
+		t.Errorf("check() = %v, asOfTime = %v; want no error and no time", err, o.asOfTime)
+	}
+}
+
+func TestRecordNotStartedExcludesPlaceholders(t *testing.T) {
+	cause := errors.New("interrupted")
+	items := []syncItem{{s3Key: "a/one.txt"}, {s3Key: "a/empty/"}, {s3Key: "a/two.txt"}}
+
+	var excluded, failed []string
+	recordNotStarted(items, cause,
+		func(item syncItem) { excluded = append(excluded, item.s3Key) },
+		func(item syncItem, err error) {
+			if !errors.Is(err, cause) {
+				t.Errorf("%s failed with %v, want it to wrap %v", item.s3Key, err, cause)
+			}
+			failed = append(failed, item.s3Key)
+		})
+
+	// A queued placeholder is excluded as in a full run, not counted as failed
+	if !slices.Equal(excluded, []string{"a/empty/"}) {
+		t.Errorf("excluded = %v, want [a/empty/]", excluded)
+	}
+	if !slices.Equal(failed, []string{"a/one.txt", "a/two.txt"}) {
+		t.Errorf("failed = %v, want [a/one.txt a/two.txt]", failed)
+	}
+}
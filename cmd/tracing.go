@@ -0,0 +1,34 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/vincent119/s3syncgoogledrive/internal/configs"
+	"github.com/vincent119/s3syncgoogledrive/internal/pkg/logging"
+	"github.com/vincent119/s3syncgoogledrive/internal/pkg/tracing"
+)
+
+// tracingFlushTimeout bounds exporting the spans still buffered when a run ends
+const tracingFlushTimeout = 10 * time.Second
+
+// startTracing exports spans to the Tracing endpoint, if any, until stop is
+// called. A failed flush is logged; it does not fail a sync whose files were copied.
+func startTracing(logger *slog.Logger) (stop func(), err error) {
+	cfg := configs.Config.Tracing
+	shutdown, err := tracing.Setup(context.Background(), cfg)
+	if err != nil {
+		return nil, err
+	}
+	if tracing.Enabled(cfg) {
+		logger.Info("Exporting traces", "endpoint", cfg.Endpoint, "service", cfg.ResolvedServiceName())
+	}
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), tracingFlushTimeout)
+		defer cancel()
+		if err := shutdown(ctx); err != nil {
+			logger.Warn("Failed to export traces", logging.Err(err))
+		}
+	}, nil
+}
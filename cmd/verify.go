@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+
+	"github.com/vincent119/s3syncgoogledrive/internal/configs"
+	"github.com/vincent119/s3syncgoogledrive/internal/googlesdk/drive"
+	"github.com/vincent119/s3syncgoogledrive/internal/pkg/limiter"
+)
+
+// verifyStatus is the state of one S3 object in Drive
+type verifyStatus string
+
+const (
+	verifyOK      verifyStatus = "OK"
+	verifyMissing verifyStatus = "MISSING"
+	verifyChanged verifyStatus = "CHANGED"
+	verifyError   verifyStatus = "ERROR"
+)
+
+type verifyResult struct {
+	item   syncItem
+	status verifyStatus
+	detail string
+}
+
+// runVerify checks every object under the prefix against Drive and fails when any is missing or stale
+func runVerify(args []string) error {
+	fs, global := newCommandFlagSet("verify")
+	opts := addSyncFlags(fs, false)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := opts.check(); err != nil {
+		return err
+	}
+	if err := global.loadConfig(true); err != nil {
+		return err
+	}
+	ctx, stop := signalContext()
+	defer stop()
+
+	s3Manager, err := newS3Manager(logger)
+	if err != nil {
+		return err
+	}
+	driveManager, err := newDriveManager(ctx, logger, opts.account, &opts.rootID)
+	if err != nil {
+		return err
+	}
+
+	items, err := listSyncItems(ctx, s3Manager, normalizePrefix(opts.prefix), opts.asOfTime, false)
+	if err != nil {
+		return fmt.Errorf("failed to fetch S3 file list: %w", err)
+	}
+
+	items = slices.DeleteFunc(items, func(item syncItem) bool { return isFolderPlaceholder(item.s3Key) })
+	results := make([]verifyResult, len(items))
+	workers := limiter.New(configs.Config.Drive.MaxConcurrent)
+	// An interrupted run stops here instead of printing partial results
+	if err := workers.ForEach(ctx, len(items), func(i int) {
+		results[i] = verifyItem(ctx, driveManager, items[i], opts.rootID)
+	}); err != nil {
+		return fmt.Errorf("verify interrupted: %w", err)
+	}
+
+	sort.SliceStable(results, func(i, j int) bool { return results[i].item.s3Key < results[j].item.s3Key })
+	counts := make(map[verifyStatus]int)
+	for _, r := range results {
+		counts[r.status]++
+		if r.status != verifyOK || debug {
+			fmt.Printf("%-8s %s  %s\n", r.status, r.item.s3Key, r.detail)
+		}
+	}
+	fmt.Printf("\nVerified %d objects: %d ok, %d missing, %d changed, %d errors\n",
+		len(results), counts[verifyOK], counts[verifyMissing], counts[verifyChanged], counts[verifyError])
+
+	if failed := len(results) - counts[verifyOK]; failed > 0 {
+		return fmt.Errorf("verification failed for %d objects", failed)
+	}
+	return nil
+}
+
+func verifyItem(ctx context.Context, driveManager *drive.DriveManager, item syncItem, rootID string) verifyResult {
+	parentID, found, err := driveManager.FindFolderPath(ctx, item.s3Key, rootID)
+	if err != nil {
+		return verifyResult{item, verifyError, err.Error()}
+	}
+	if !found {
+		return verifyResult{item, verifyMissing, "folder not found"}
+	}
+
+	file, err := driveManager.FindFileByETag(ctx, item.s3ETag, parentID)
+	if err != nil {
+		return verifyResult{item, verifyError, err.Error()}
+	}
+	if file != nil {
+		return verifyResult{item, verifyOK, file.Id}
+	}
+
+	file, err = driveManager.FindFileByName(ctx, item.fileName, parentID)
+	if err != nil {
+		return verifyResult{item, verifyError, err.Error()}
+	}
+	if file != nil {
+		return verifyResult{item, verifyChanged, fmt.Sprintf("Drive copy has ETag %q, S3 has %q", file.AppProperties["s3etag"], item.s3ETag)}
+	}
+	return verifyResult{item, verifyMissing, "file not found"}
+}
@@ -2,13 +2,29 @@ package awsSDK
 
 import (
 	"context"
-	"log"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
 	"os"
 
+	"github.com/vincent119/s3syncgoogledrive/internal/configs"
+	"github.com/vincent119/s3syncgoogledrive/internal/pkg/errs"
+
 	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
 	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
 )
 
+// DefaultSessionName is used for assume-role sessions when none is configured
+const DefaultSessionName = "s3syncgoogledrive"
+
+// DefaultCompatibleRegion is used for S3-compatible endpoints when no region is configured
+const DefaultCompatibleRegion = "us-east-1"
+
 // ConfigLoader defines a function type for loading AWS config
 type ConfigLoader func(ctx context.Context, optFns ...func(*config.LoadOptions) error) (aws.Config, error)
 
@@ -28,35 +44,147 @@ func NewDefaultAWSManager() *AWSManager {
 }
 
 // Connect loads configuration using AWS_PROFILE
-func (m *AWSManager) Connect() aws.Config {
+func (m *AWSManager) Connect() (aws.Config, error) {
 	awsProfile := os.Getenv("AWS_PROFILE")
 	cfg, err := m.Loader(
 		context.Background(),
 		config.WithSharedConfigProfile(awsProfile),
 	)
 	if err != nil {
-		log.Fatalf("Failed to load AWS config with profile: %v", err)
+		return aws.Config{}, errs.Wrap(errs.ErrAuth, "load AWS config with profile "+awsProfile, err)
 	}
-	return cfg
+	return cfg, nil
 }
 
 // ConnectWithRegion loads configuration with a specific region
-func (m *AWSManager) ConnectWithRegion(region string) aws.Config {
+func (m *AWSManager) ConnectWithRegion(region string) (aws.Config, error) {
 	cfg, err := m.Loader(context.TODO(),
 		config.WithRegion(region),
 	)
 	if err != nil {
-		log.Fatalf("Failed to load AWS config with region: %v", err)
+		return aws.Config{}, errs.Wrap(errs.ErrAuth, "load AWS config with region "+region, err)
+	}
+	return cfg, nil
+}
+
+// ConnectWithS3Config loads configuration using the credential mode in s3cfg
+func (m *AWSManager) ConnectWithS3Config(s3cfg configs.S3Config) (aws.Config, error) {
+	var opts []func(*config.LoadOptions) error
+	region := s3cfg.Region
+	if region == "" && s3cfg.Endpoint != "" {
+		region = DefaultCompatibleRegion
+	}
+	if region != "" {
+		opts = append(opts, config.WithRegion(region))
+	}
+	if s3cfg.CABundle != "" || s3cfg.InsecureSkipVerify {
+		client, err := tlsHTTPClient(s3cfg)
+		if err != nil {
+			return aws.Config{}, err
+		}
+		opts = append(opts, config.WithHTTPClient(client))
+	}
+
+	mode := s3cfg.ResolvedCredentialMode()
+	switch mode {
+	case configs.CredentialModeDefault:
+	case configs.CredentialModeStatic:
+		if s3cfg.AccessKeyId == "" || s3cfg.SecretAccess == "" {
+			return aws.Config{}, fmt.Errorf("credential mode %q requires accessKeyId and secretAccess", mode)
+		}
+		opts = append(opts, staticCredentials(s3cfg))
+	case configs.CredentialModeProfile:
+		if s3cfg.Profile == "" {
+			return aws.Config{}, fmt.Errorf("credential mode %q requires profile", mode)
+		}
+		opts = append(opts, config.WithSharedConfigProfile(s3cfg.Profile))
+	case configs.CredentialModeAssumeRole:
+		if s3cfg.RoleArn == "" {
+			return aws.Config{}, fmt.Errorf("credential mode %q requires roleArn", mode)
+		}
+		// The source identity for sts:AssumeRole is the static keys or
+		// profile when given, otherwise the default chain.
+		if s3cfg.AccessKeyId != "" && s3cfg.SecretAccess != "" {
+			opts = append(opts, staticCredentials(s3cfg))
+		} else if s3cfg.Profile != "" {
+			opts = append(opts, config.WithSharedConfigProfile(s3cfg.Profile))
+		}
+	case configs.CredentialModeWebIdentity:
+		if s3cfg.RoleArn == "" || s3cfg.WebIdentityTokenFile == "" {
+			return aws.Config{}, fmt.Errorf("credential mode %q requires roleArn and webIdentityTokenFile", mode)
+		}
+	default:
+		return aws.Config{}, fmt.Errorf("unknown credential mode %q", mode)
+	}
+
+	cfg, err := m.Loader(context.TODO(), opts...)
+	if err != nil {
+		return aws.Config{}, errs.Wrap(errs.ErrAuth, fmt.Sprintf("load AWS config (mode %s)", mode), err)
 	}
-	return cfg
+
+	switch mode {
+	case configs.CredentialModeAssumeRole:
+		provider := stscreds.NewAssumeRoleProvider(sts.NewFromConfig(cfg), s3cfg.RoleArn, func(o *stscreds.AssumeRoleOptions) {
+			o.RoleSessionName = sessionName(s3cfg)
+			if s3cfg.ExternalID != "" {
+				o.ExternalID = aws.String(s3cfg.ExternalID)
+			}
+		})
+		cfg.Credentials = aws.NewCredentialsCache(provider)
+	case configs.CredentialModeWebIdentity:
+		provider := stscreds.NewWebIdentityRoleProvider(sts.NewFromConfig(cfg), s3cfg.RoleArn,
+			stscreds.IdentityTokenFile(s3cfg.WebIdentityTokenFile),
+			func(o *stscreds.WebIdentityRoleOptions) {
+				o.RoleSessionName = sessionName(s3cfg)
+			})
+		cfg.Credentials = aws.NewCredentialsCache(provider)
+	}
+	return cfg, nil
+}
+
+// tlsHTTPClient builds an HTTP client trusting the configured CA bundle
+func tlsHTTPClient(s3cfg configs.S3Config) (*awshttp.BuildableClient, error) {
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: s3cfg.InsecureSkipVerify,
+	}
+	if s3cfg.CABundle != "" {
+		pem, err := os.ReadFile(s3cfg.CABundle)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA bundle %s: %w", s3cfg.CABundle, err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA bundle %s", s3cfg.CABundle)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	return awshttp.NewBuildableClient().WithTransportOptions(func(tr *http.Transport) {
+		tr.TLSClientConfig = tlsConfig
+	}), nil
+}
+
+func staticCredentials(s3cfg configs.S3Config) func(*config.LoadOptions) error {
+	return config.WithCredentialsProvider(
+		credentials.NewStaticCredentialsProvider(s3cfg.AccessKeyId, s3cfg.SecretAccess, s3cfg.SessionToken),
+	)
+}
+
+func sessionName(s3cfg configs.S3Config) string {
+	if s3cfg.SessionName != "" {
+		return s3cfg.SessionName
+	}
+	return DefaultSessionName
 }
 
 // Wrappers for backward compatibility
-func AwsConnect() aws.Config {
+func AwsConnect() (aws.Config, error) {
 	return NewDefaultAWSManager().Connect()
 }
 
-func AwsConnectWithRegion(region string) aws.Config {
+func AwsConnectWithRegion(region string) (aws.Config, error) {
 	return NewDefaultAWSManager().ConnectWithRegion(region)
 }
-
@@ -2,10 +2,16 @@ package awsSDK
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"testing"
 
+	"github.com/vincent119/s3syncgoogledrive/internal/configs"
+	"github.com/vincent119/s3syncgoogledrive/internal/pkg/errs"
+
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
 )
 
 func TestConnect(t *testing.T) {
@@ -14,17 +20,30 @@ func TestConnect(t *testing.T) {
 	}
 
 	manager := NewAWSManager(mockLoader)
-	cfg := manager.Connect()
+	cfg, err := manager.Connect()
+	if err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
 
 	if cfg.Region != "mock-region" {
 		t.Errorf("Region = %s, want mock-region", cfg.Region)
 	}
 }
 
-// TestConnectError is hard because Connect calls log.Fatalf.
-// Ideally we should refactor Connect to return error, but for now we test happy path.
-// Or we can assume log.Fatalf crashes test, so we can't test error path easily without helper.
-// The task was to improve coverage, happy path gives good coverage.
+func TestConnectError(t *testing.T) {
+	loadErr := errors.New("shared config profile not found")
+	mockLoader := func(ctx context.Context, optFns ...func(*config.LoadOptions) error) (aws.Config, error) {
+		return aws.Config{}, loadErr
+	}
+
+	manager := NewAWSManager(mockLoader)
+	if _, err := manager.Connect(); !errors.Is(err, errs.ErrAuth) || !errors.Is(err, loadErr) {
+		t.Errorf("Connect error = %v, want auth error wrapping the loader error", err)
+	}
+	if _, err := manager.ConnectWithRegion("us-west-2"); !errors.Is(err, errs.ErrAuth) || !errors.Is(err, loadErr) {
+		t.Errorf("ConnectWithRegion error = %v, want auth error wrapping the loader error", err)
+	}
+}
 
 func TestConnectWithRegion(t *testing.T) {
 	mockLoader := func(ctx context.Context, optFns ...func(*config.LoadOptions) error) (aws.Config, error) {
@@ -34,9 +53,173 @@ func TestConnectWithRegion(t *testing.T) {
 	}
 
 	manager := NewAWSManager(mockLoader)
-	cfg := manager.ConnectWithRegion("us-west-2")
+	cfg, err := manager.ConnectWithRegion("us-west-2")
+	if err != nil {
+		t.Fatalf("ConnectWithRegion failed: %v", err)
+	}
 
 	if cfg.Region != "us-west-2" {
 		t.Errorf("Region = %s, want us-west-2", cfg.Region)
 	}
 }
+
+// capturingLoader applies the functional options so tests can inspect them
+func capturingLoader(captured *config.LoadOptions) ConfigLoader {
+	return func(ctx context.Context, optFns ...func(*config.LoadOptions) error) (aws.Config, error) {
+		for _, fn := range optFns {
+			if err := fn(captured); err != nil {
+				return aws.Config{}, err
+			}
+		}
+		return aws.Config{Region: captured.Region, Credentials: captured.Credentials}, nil
+	}
+}
+
+func TestConnectWithS3ConfigStatic(t *testing.T) {
+	var opts config.LoadOptions
+	manager := NewAWSManager(capturingLoader(&opts))
+
+	cfg, err := manager.ConnectWithS3Config(configs.S3Config{
+		Region:       "ap-southeast-1",
+		AccessKeyId:  "AKID",
+		SecretAccess: "SECRET",
+	})
+	if err != nil {
+		t.Fatalf("ConnectWithS3Config failed: %v", err)
+	}
+	if cfg.Region != "ap-southeast-1" {
+		t.Errorf("Region = %s, want ap-southeast-1", cfg.Region)
+	}
+	creds, err := cfg.Credentials.Retrieve(context.Background())
+	if err != nil {
+		t.Fatalf("Retrieve failed: %v", err)
+	}
+	if creds.AccessKeyID != "AKID" || creds.SecretAccessKey != "SECRET" {
+		t.Errorf("Credentials = %s/%s, want AKID/SECRET", creds.AccessKeyID, creds.SecretAccessKey)
+	}
+}
+
+func TestConnectWithS3ConfigProfile(t *testing.T) {
+	var opts config.LoadOptions
+	manager := NewAWSManager(capturingLoader(&opts))
+
+	_, err := manager.ConnectWithS3Config(configs.S3Config{
+		CredentialMode: configs.CredentialModeProfile,
+		Profile:        "backup",
+	})
+	if err != nil {
+		t.Fatalf("ConnectWithS3Config failed: %v", err)
+	}
+	if opts.SharedConfigProfile != "backup" {
+		t.Errorf("SharedConfigProfile = %s, want backup", opts.SharedConfigProfile)
+	}
+	if opts.Credentials != nil {
+		t.Error("Profile mode should not set static credentials")
+	}
+}
+
+func TestConnectWithS3ConfigDefault(t *testing.T) {
+	var opts config.LoadOptions
+	manager := NewAWSManager(capturingLoader(&opts))
+
+	_, err := manager.ConnectWithS3Config(configs.S3Config{Region: "us-east-1"})
+	if err != nil {
+		t.Fatalf("ConnectWithS3Config failed: %v", err)
+	}
+	if opts.Credentials != nil || opts.SharedConfigProfile != "" {
+		t.Error("Default mode should leave the credential chain untouched")
+	}
+}
+
+func TestConnectWithS3ConfigAssumeRole(t *testing.T) {
+	var opts config.LoadOptions
+	manager := NewAWSManager(capturingLoader(&opts))
+
+	cfg, err := manager.ConnectWithS3Config(configs.S3Config{
+		Region:         "us-east-1",
+		CredentialMode: configs.CredentialModeAssumeRole,
+		Profile:        "source",
+		RoleArn:        "arn:aws:iam::123456789012:role/sync",
+		ExternalID:     "ext-id",
+		SessionName:    "nightly",
+	})
+	if err != nil {
+		t.Fatalf("ConnectWithS3Config failed: %v", err)
+	}
+	if opts.SharedConfigProfile != "source" {
+		t.Errorf("SharedConfigProfile = %s, want source", opts.SharedConfigProfile)
+	}
+	cache, ok := cfg.Credentials.(*aws.CredentialsCache)
+	if !ok {
+		t.Fatalf("Credentials = %T, want *aws.CredentialsCache", cfg.Credentials)
+	}
+	if !cache.IsCredentialsProvider(&stscreds.AssumeRoleProvider{}) {
+		t.Error("Credentials should be backed by an AssumeRoleProvider")
+	}
+}
+
+func TestConnectWithS3ConfigWebIdentity(t *testing.T) {
+	var opts config.LoadOptions
+	manager := NewAWSManager(capturingLoader(&opts))
+
+	cfg, err := manager.ConnectWithS3Config(configs.S3Config{
+		Region:               "us-east-1",
+		CredentialMode:       configs.CredentialModeWebIdentity,
+		RoleArn:              "arn:aws:iam::123456789012:role/sync",
+		WebIdentityTokenFile: "/var/run/secrets/token",
+	})
+	if err != nil {
+		t.Fatalf("ConnectWithS3Config failed: %v", err)
+	}
+	cache, ok := cfg.Credentials.(*aws.CredentialsCache)
+	if !ok {
+		t.Fatalf("Credentials = %T, want *aws.CredentialsCache", cfg.Credentials)
+	}
+	if !cache.IsCredentialsProvider(&stscreds.WebIdentityRoleProvider{}) {
+		t.Error("Credentials should be backed by a WebIdentityRoleProvider")
+	}
+}
+
+func TestConnectWithS3ConfigErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  configs.S3Config
+	}{
+		{"UnknownMode", configs.S3Config{CredentialMode: "magic"}},
+		{"StaticMissingKeys", configs.S3Config{CredentialMode: configs.CredentialModeStatic}},
+		{"ProfileMissingName", configs.S3Config{CredentialMode: configs.CredentialModeProfile}},
+		{"AssumeRoleMissingArn", configs.S3Config{CredentialMode: configs.CredentialModeAssumeRole}},
+		{"WebIdentityMissingFile", configs.S3Config{CredentialMode: configs.CredentialModeWebIdentity, RoleArn: "arn"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var opts config.LoadOptions
+			manager := NewAWSManager(capturingLoader(&opts))
+			if _, err := manager.ConnectWithS3Config(tt.cfg); err == nil {
+				t.Error("Expected error, got nil")
+			}
+		})
+	}
+}
+
+func TestConnectWithS3ConfigLoaderError(t *testing.T) {
+	mockLoader := func(ctx context.Context, optFns ...func(*config.LoadOptions) error) (aws.Config, error) {
+		return aws.Config{}, errors.New("load failed")
+	}
+
+	manager := NewAWSManager(mockLoader)
+	if _, err := manager.ConnectWithS3Config(configs.S3Config{}); err == nil {
+		t.Error("Expected error from loader, got nil")
+	}
+}
+
+func TestErrorKindCredentials(t *testing.T) {
+	err := fmt.Errorf("operation error S3: ListObjectsV2, get identity: get credentials: %w", errors.New("no EC2 IMDS role found"))
+	if kind := ErrorKind(err); kind != errs.ErrAuth {
+		t.Errorf("ErrorKind = %v, want ErrAuth", kind)
+	}
+	if kind := ErrorKind(errors.New("connection reset")); kind != nil {
+		t.Errorf("ErrorKind = %v, want nil", kind)
+	}
+}
@@ -0,0 +1,78 @@
+package awsSDK
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/vincent119/s3syncgoogledrive/internal/pkg/errs"
+	"github.com/vincent119/s3syncgoogledrive/internal/pkg/metrics"
+
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/smithy-go"
+)
+
+// WrapError annotates an AWS SDK error with its errs kind
+func WrapError(op string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return errs.Wrap(ErrorKind(err), op, err)
+}
+
+// ErrorKind maps AWS error codes and HTTP statuses to errs kinds
+func ErrorKind(err error) error {
+	var signingErr *v4.SigningError
+	if errors.As(err, &signingErr) {
+		return errs.ErrAuth
+	}
+	// Credential resolution failures carry no error type, only this wrapping
+	if strings.Contains(err.Error(), "get identity: ") {
+		return errs.ErrAuth
+	}
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.ErrorCode() {
+		case "InvalidAccessKeyId", "SignatureDoesNotMatch", "ExpiredToken", "InvalidToken", "TokenRefreshRequired":
+			return errs.ErrAuth
+		case "AccessDenied", "AllAccessDisabled", "InvalidObjectState":
+			return errs.ErrPermission
+		case "NoSuchBucket", "NoSuchKey", "NoSuchVersion", "NotFound":
+			return errs.ErrNotFound
+		case "SlowDown", "Throttling", "ThrottlingException", "TooManyRequestsException", "RequestLimitExceeded":
+			return errs.ErrRateLimit
+		case "InternalError", "ServiceUnavailable":
+			return errs.ErrUnavailable
+		}
+	}
+	var respErr *awshttp.ResponseError
+	if errors.As(err, &respErr) {
+		switch status := respErr.HTTPStatusCode(); {
+		case status == http.StatusUnauthorized:
+			return errs.ErrAuth
+		case status == http.StatusForbidden:
+			return errs.ErrPermission
+		case status == http.StatusNotFound:
+			return errs.ErrNotFound
+		case status == http.StatusTooManyRequests:
+			return errs.ErrRateLimit
+		case status >= http.StatusInternalServerError:
+			return errs.ErrUnavailable
+		}
+	}
+	return nil
+}
+
+// StatusLabel returns the HTTP status of an AWS API call for metrics
+func StatusLabel(err error) string {
+	if err == nil {
+		return strconv.Itoa(http.StatusOK)
+	}
+	var respErr *awshttp.ResponseError
+	if errors.As(err, &respErr) {
+		return strconv.Itoa(respErr.HTTPStatusCode())
+	}
+	return metrics.StatusError
+}
@@ -2,21 +2,31 @@ package s3
 
 import (
 	"context"
-	"log"
+	"log/slog"
+	"sort"
 	"time"
 
 	"github.com/vincent119/s3syncgoogledrive/internal/awsSDK"
 	"github.com/vincent119/s3syncgoogledrive/internal/configs"
+	"github.com/vincent119/s3syncgoogledrive/internal/pkg/logging"
+	"github.com/vincent119/s3syncgoogledrive/internal/pkg/metrics"
+	"github.com/vincent119/s3syncgoogledrive/internal/pkg/tracing"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // S3API defines the interface for S3 client operations
 type S3API interface {
 	ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error)
+	ListObjectVersions(ctx context.Context, params *s3.ListObjectVersionsInput, optFns ...func(*s3.Options)) (*s3.ListObjectVersionsOutput, error)
+	HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error)
+	RestoreObject(ctx context.Context, params *s3.RestoreObjectInput, optFns ...func(*s3.Options)) (*s3.RestoreObjectOutput, error)
+	GetObjectTagging(ctx context.Context, params *s3.GetObjectTaggingInput, optFns ...func(*s3.Options)) (*s3.GetObjectTaggingOutput, error)
 }
 
 // PresignAPI defines the interface for S3 presigner operations
@@ -28,6 +38,29 @@ type PresignAPI interface {
 type S3Manager struct {
 	Client        S3API
 	PresignClient PresignAPI
+	// HTTPClient downloads presigned URLs with the same TLS settings as Client
+	HTTPClient aws.HTTPClient
+	// Logger receives structured logs (defaults to slog.Default())
+	Logger *slog.Logger
+	// Metrics records API calls; nil records nothing
+	Metrics *metrics.Sync
+}
+
+func (m *S3Manager) logger() *slog.Logger {
+	return logging.OrDefault(m.Logger)
+}
+
+// startCall starts the span of an S3 API call of operation; pass the returned
+// context to the call and end it with endCall
+func (m *S3Manager) startCall(ctx context.Context, operation string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return tracing.Start(ctx, "s3."+operation, attrs...)
+}
+
+// endCall records an S3 API call of operation that returned err and ends its span
+func (m *S3Manager) endCall(span trace.Span, operation string, err error) {
+	status := awsSDK.StatusLabel(err)
+	m.Metrics.S3Call(operation, status)
+	tracing.EndCall(span, status, err)
 }
 
 // NewS3Manager creates a new S3Manager
@@ -39,64 +72,217 @@ func NewS3Manager(client S3API, presignClient PresignAPI) *S3Manager {
 }
 
 // NewDefaultManager creates an S3Manager with default AWS config
-func NewDefaultManager() *S3Manager {
-	cfg := awsSDK.AwsConnectWithRegion(configs.Config.S3.Region)
-	client := s3.NewFromConfig(cfg)
-	presignClient := s3.NewPresignClient(client)
-	log.Println("S3 client initialized successfully")
-	return NewS3Manager(client, presignClient)
+func NewDefaultManager() (*S3Manager, error) {
+	cfg, err := awsSDK.NewDefaultAWSManager().ConnectWithS3Config(configs.Config.S3)
+	if err != nil {
+		return nil, err
+	}
+	m := NewManagerFromConfig(cfg, configs.Config.S3)
+	m.logger().Info("S3 client initialized")
+	return m, nil
+}
+
+// NewManagerFromConfig creates an S3Manager for AWS or an S3-compatible endpoint
+func NewManagerFromConfig(cfg aws.Config, s3cfg configs.S3Config) *S3Manager {
+	client := s3.NewFromConfig(cfg, ClientOptions(s3cfg))
+	m := NewS3Manager(client, s3.NewPresignClient(client))
+	m.HTTPClient = cfg.HTTPClient
+	return m
+}
+
+// ClientOptions applies the endpoint and addressing style from s3cfg
+func ClientOptions(s3cfg configs.S3Config) func(*s3.Options) {
+	return func(o *s3.Options) {
+		if s3cfg.Endpoint != "" {
+			o.BaseEndpoint = aws.String(s3cfg.Endpoint)
+		}
+		o.UsePathStyle = s3cfg.UsePathStyle
+	}
 }
 
 // ListS3Objects lists all objects under the specified prefix
-func (m *S3Manager) ListS3Objects(bucket string, prefix string) ([]types.Object, error) {
+func (m *S3Manager) ListS3Objects(ctx context.Context, bucket string, prefix string) ([]types.Object, error) {
 	input := &s3.ListObjectsV2Input{
 		Bucket: aws.String(bucket),
 		Prefix: aws.String(prefix),
 	}
 
-	resp, err := m.Client.ListObjectsV2(context.TODO(), input)
+	callCtx, span := m.startCall(ctx, "ListObjectsV2")
+	resp, err := m.Client.ListObjectsV2(callCtx, input)
+	m.endCall(span, "ListObjectsV2", err)
 	if err != nil {
-		log.Printf("Failed to list objects in bucket %s with prefix %s: %v", bucket, prefix, err)
-		return nil, err
+		m.logger().Error("Failed to list objects", "bucket", bucket, "prefix", prefix, logging.Err(err))
+		return nil, awsSDK.WrapError("list objects in "+bucket, err)
 	}
 
-	log.Printf("Successfully listed %d objects from S3 bucket %s", len(resp.Contents), bucket)
+	m.logger().Info("Listed objects", "bucket", bucket, "prefix", prefix, "count", len(resp.Contents))
 	return resp.Contents, nil
 }
 
+// CheckBucket verifies the bucket is reachable with the configured credentials
+// by listing at most one object
+func (m *S3Manager) CheckBucket(ctx context.Context, bucket string) error {
+	callCtx, span := m.startCall(ctx, "ListObjectsV2")
+	_, err := m.Client.ListObjectsV2(callCtx, &s3.ListObjectsV2Input{
+		Bucket:  aws.String(bucket),
+		MaxKeys: aws.Int32(1),
+	})
+	m.endCall(span, "ListObjectsV2", err)
+	if err != nil {
+		return awsSDK.WrapError("list bucket "+bucket, err)
+	}
+	return nil
+}
+
 // ListS3Folders lists all top-level folders in the specified S3 bucket
-func (m *S3Manager) ListS3Folders(bucket string) ([]string, error) {
+func (m *S3Manager) ListS3Folders(ctx context.Context, bucket string) ([]string, error) {
 	input := &s3.ListObjectsV2Input{
 		Bucket:    aws.String(bucket),
 		Delimiter: aws.String("/"),
 	}
 
-	resp, err := m.Client.ListObjectsV2(context.TODO(), input)
+	callCtx, span := m.startCall(ctx, "ListObjectsV2")
+	resp, err := m.Client.ListObjectsV2(callCtx, input)
+	m.endCall(span, "ListObjectsV2", err)
 	if err != nil {
-		log.Printf("Failed to list folders in bucket %s: %v", bucket, err)
-		return nil, err
+		m.logger().Error("Failed to list folders", "bucket", bucket, logging.Err(err))
+		return nil, awsSDK.WrapError("list folders in "+bucket, err)
 	}
 
 	var folders []string
 	for _, prefix := range resp.CommonPrefixes {
 		folders = append(folders, *prefix.Prefix)
 	}
-	log.Printf("Successfully listed %d folders from S3 bucket %s", len(folders), bucket)
+	m.logger().Info("Listed folders", "bucket", bucket, "count", len(folders))
 	return folders, nil
 }
 
+// ListS3ObjectVersions lists every object version and delete marker under the specified prefix
+func (m *S3Manager) ListS3ObjectVersions(ctx context.Context, bucket, prefix string) ([]types.ObjectVersion, []types.DeleteMarkerEntry, error) {
+	input := &s3.ListObjectVersionsInput{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(prefix),
+	}
+
+	var versions []types.ObjectVersion
+	var markers []types.DeleteMarkerEntry
+	for {
+		callCtx, span := m.startCall(ctx, "ListObjectVersions")
+		resp, err := m.Client.ListObjectVersions(callCtx, input)
+		m.endCall(span, "ListObjectVersions", err)
+		if err != nil {
+			m.logger().Error("Failed to list object versions", "bucket", bucket, "prefix", prefix, logging.Err(err))
+			return nil, nil, awsSDK.WrapError("list object versions in "+bucket, err)
+		}
+		versions = append(versions, resp.Versions...)
+		markers = append(markers, resp.DeleteMarkers...)
+
+		if !aws.ToBool(resp.IsTruncated) {
+			break
+		}
+		input.KeyMarker = resp.NextKeyMarker
+		input.VersionIdMarker = resp.NextVersionIdMarker
+	}
+
+	m.logger().Info("Listed object versions", "bucket", bucket, "prefix", prefix, "versions", len(versions), "delete_markers", len(markers))
+	return versions, markers, nil
+}
+
+// SelectVersionsAsOf picks, for each key, the newest version last modified at or before asOf.
+// Keys whose newest entry at that time is a delete marker did not exist and are omitted.
+func SelectVersionsAsOf(versions []types.ObjectVersion, markers []types.DeleteMarkerEntry, asOf time.Time) []types.ObjectVersion {
+	type candidate struct {
+		modified time.Time
+		version  *types.ObjectVersion
+	}
+	latest := make(map[string]candidate)
+
+	for i := range versions {
+		v := &versions[i]
+		modified := aws.ToTime(v.LastModified)
+		if modified.After(asOf) {
+			continue
+		}
+		key := aws.ToString(v.Key)
+		if c, ok := latest[key]; !ok || modified.After(c.modified) {
+			latest[key] = candidate{modified: modified, version: v}
+		}
+	}
+	for _, dm := range markers {
+		modified := aws.ToTime(dm.LastModified)
+		if modified.After(asOf) {
+			continue
+		}
+		key := aws.ToString(dm.Key)
+		if c, ok := latest[key]; !ok || modified.After(c.modified) {
+			latest[key] = candidate{modified: modified}
+		}
+	}
+
+	var selected []types.ObjectVersion
+	for _, c := range latest {
+		if c.version != nil {
+			selected = append(selected, *c.version)
+		}
+	}
+	sort.Slice(selected, func(i, j int) bool {
+		return aws.ToString(selected[i].Key) < aws.ToString(selected[j].Key)
+	})
+	return selected
+}
+
+// GetObjectTags returns the tag set of an object (or object version) as a map
+func (m *S3Manager) GetObjectTags(ctx context.Context, bucket, key, versionID string) (map[string]string, error) {
+	input := &s3.GetObjectTaggingInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	}
+	if versionID != "" {
+		input.VersionId = aws.String(versionID)
+	}
+
+	callCtx, span := m.startCall(ctx, "GetObjectTagging", tracing.KeyS3Key.String(key))
+	resp, err := m.Client.GetObjectTagging(callCtx, input)
+	m.endCall(span, "GetObjectTagging", err)
+	if err != nil {
+		m.logger().Warn("Failed to get tags", logging.KeyS3Key, key, logging.Err(err))
+		return nil, awsSDK.WrapError("get tags of "+key, err)
+	}
+
+	tags := make(map[string]string, len(resp.TagSet))
+	for _, tag := range resp.TagSet {
+		tags[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+	}
+	return tags, nil
+}
+
 // GetPresignedURL generates a presigned URL for an S3 object (valid for 15 mins by default)
-func (m *S3Manager) GetPresignedURL(bucket, key string) (string, error) {
-	req, err := m.PresignClient.PresignGetObject(context.TODO(), &s3.GetObjectInput{
+func (m *S3Manager) GetPresignedURL(ctx context.Context, bucket, key string) (string, error) {
+	req, err := m.PresignClient.PresignGetObject(ctx, &s3.GetObjectInput{
 		Bucket: aws.String(bucket),
 		Key:    aws.String(key),
 	}, s3.WithPresignExpires(15*time.Minute))
 
 	if err != nil {
-		log.Printf("Failed to generate presigned URL for %s: %v", key, err)
-		return "", err
+		m.logger().Error("Failed to generate presigned URL", logging.KeyS3Key, key, logging.Err(err))
+		return "", awsSDK.WrapError("presign "+key, err)
 	}
 
 	return req.URL, nil
 }
 
+// GetPresignedVersionURL generates a presigned URL for a specific object version
+func (m *S3Manager) GetPresignedVersionURL(ctx context.Context, bucket, key, versionID string) (string, error) {
+	req, err := m.PresignClient.PresignGetObject(ctx, &s3.GetObjectInput{
+		Bucket:    aws.String(bucket),
+		Key:       aws.String(key),
+		VersionId: aws.String(versionID),
+	}, s3.WithPresignExpires(15*time.Minute))
+
+	if err != nil {
+		m.logger().Error("Failed to generate presigned URL", logging.KeyS3Key, key, "version_id", versionID, logging.Err(err))
+		return "", awsSDK.WrapError("presign "+key, err)
+	}
+
+	return req.URL, nil
+}
@@ -2,18 +2,40 @@ package s3
 
 import (
 	"context"
+	"encoding/pem"
 	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/vincent119/s3syncgoogledrive/internal/awsSDK"
+	"github.com/vincent119/s3syncgoogledrive/internal/configs"
+	"github.com/vincent119/s3syncgoogledrive/internal/pkg/errs"
+	"github.com/vincent119/s3syncgoogledrive/internal/pkg/metrics"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
 )
 
 // MockS3Client is a mock implementation of S3API
 type MockS3Client struct {
-	ListObjectsV2Func func(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error)
+	ListObjectsV2Func      func(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error)
+	ListObjectVersionsFunc func(ctx context.Context, params *s3.ListObjectVersionsInput, optFns ...func(*s3.Options)) (*s3.ListObjectVersionsOutput, error)
+	HeadObjectFunc         func(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error)
+	RestoreObjectFunc      func(ctx context.Context, params *s3.RestoreObjectInput, optFns ...func(*s3.Options)) (*s3.RestoreObjectOutput, error)
+	GetObjectTaggingFunc   func(ctx context.Context, params *s3.GetObjectTaggingInput, optFns ...func(*s3.Options)) (*s3.GetObjectTaggingOutput, error)
 }
 
 func (m *MockS3Client) ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
@@ -23,6 +45,34 @@ func (m *MockS3Client) ListObjectsV2(ctx context.Context, params *s3.ListObjects
 	return &s3.ListObjectsV2Output{}, nil
 }
 
+func (m *MockS3Client) ListObjectVersions(ctx context.Context, params *s3.ListObjectVersionsInput, optFns ...func(*s3.Options)) (*s3.ListObjectVersionsOutput, error) {
+	if m.ListObjectVersionsFunc != nil {
+		return m.ListObjectVersionsFunc(ctx, params, optFns...)
+	}
+	return &s3.ListObjectVersionsOutput{}, nil
+}
+
+func (m *MockS3Client) HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	if m.HeadObjectFunc != nil {
+		return m.HeadObjectFunc(ctx, params, optFns...)
+	}
+	return &s3.HeadObjectOutput{}, nil
+}
+
+func (m *MockS3Client) RestoreObject(ctx context.Context, params *s3.RestoreObjectInput, optFns ...func(*s3.Options)) (*s3.RestoreObjectOutput, error) {
+	if m.RestoreObjectFunc != nil {
+		return m.RestoreObjectFunc(ctx, params, optFns...)
+	}
+	return &s3.RestoreObjectOutput{}, nil
+}
+
+func (m *MockS3Client) GetObjectTagging(ctx context.Context, params *s3.GetObjectTaggingInput, optFns ...func(*s3.Options)) (*s3.GetObjectTaggingOutput, error) {
+	if m.GetObjectTaggingFunc != nil {
+		return m.GetObjectTaggingFunc(ctx, params, optFns...)
+	}
+	return &s3.GetObjectTaggingOutput{}, nil
+}
+
 // MockPresignClient is a mock implementation of PresignAPI
 type MockPresignClient struct {
 	PresignGetObjectFunc func(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.PresignOptions)) (*v4.PresignedHTTPRequest, error)
@@ -51,7 +101,7 @@ func TestListS3Objects(t *testing.T) {
 	}
 
 	manager := NewS3Manager(mockClient, &MockPresignClient{})
-	objects, err := manager.ListS3Objects("test-bucket", "prefix")
+	objects, err := manager.ListS3Objects(context.Background(), "test-bucket", "prefix")
 
 	if err != nil {
 		t.Fatalf("ListS3Objects failed: %v", err)
@@ -70,13 +120,76 @@ func TestListS3ObjectsError(t *testing.T) {
 	}
 
 	manager := NewS3Manager(mockClient, &MockPresignClient{})
-	_, err := manager.ListS3Objects("test-bucket", "prefix")
+	_, err := manager.ListS3Objects(context.Background(), "test-bucket", "prefix")
 
 	if err == nil {
 		t.Error("Expected error from ListS3Objects, got nil")
 	}
 }
 
+func TestListS3ObjectsErrorKinds(t *testing.T) {
+	tests := []struct {
+		code string
+		want error
+	}{
+		{"SlowDown", errs.ErrRateLimit},
+		{"AccessDenied", errs.ErrPermission},
+		{"InvalidAccessKeyId", errs.ErrAuth},
+		{"NoSuchBucket", errs.ErrNotFound},
+		{"ServiceUnavailable", errs.ErrUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			mockClient := &MockS3Client{
+				ListObjectsV2Func: func(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+					return nil, &smithy.GenericAPIError{Code: tt.code, Message: "mock"}
+				},
+			}
+
+			_, err := NewS3Manager(mockClient, &MockPresignClient{}).ListS3Objects(context.Background(), "test-bucket", "prefix")
+			if !errors.Is(err, tt.want) {
+				t.Errorf("ListS3Objects error = %v, want kind %v", err, tt.want)
+			}
+			var apiErr smithy.APIError
+			if !errors.As(err, &apiErr) || apiErr.ErrorCode() != tt.code {
+				t.Errorf("ListS3Objects error does not wrap the API error: %v", err)
+			}
+		})
+	}
+}
+
+func TestS3ManagerRecordsCalls(t *testing.T) {
+	calls := 0
+	mockClient := &MockS3Client{
+		ListObjectsV2Func: func(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+			calls++
+			if calls == 1 {
+				return &s3.ListObjectsV2Output{}, nil
+			}
+			return nil, &awshttp.ResponseError{ResponseError: &smithyhttp.ResponseError{
+				Response: &smithyhttp.Response{Response: &http.Response{StatusCode: http.StatusServiceUnavailable}},
+				Err:      errors.New("slow down"),
+			}}
+		},
+	}
+
+	manager := NewS3Manager(mockClient, &MockPresignClient{})
+	manager.Metrics = metrics.NewSync()
+	manager.ListS3Objects(context.Background(), "test-bucket", "prefix")
+	manager.CheckBucket(context.Background(), "test-bucket")
+
+	var buf strings.Builder
+	manager.Metrics.Registry.WriteText(&buf)
+	for _, line := range []string{
+		`s3sync_s3_api_calls_total{operation="ListObjectsV2",status="200"} 1`,
+		`s3sync_s3_api_calls_total{operation="ListObjectsV2",status="503"} 1`,
+	} {
+		if !strings.Contains(buf.String(), line+"\n") {
+			t.Errorf("Missing %q in:\n%s", line, buf.String())
+		}
+	}
+}
+
 func TestGetPresignedURL(t *testing.T) {
 	mockPresignClient := &MockPresignClient{
 		PresignGetObjectFunc: func(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.PresignOptions)) (*v4.PresignedHTTPRequest, error) {
@@ -91,7 +204,7 @@ func TestGetPresignedURL(t *testing.T) {
 	}
 
 	manager := NewS3Manager(&MockS3Client{}, mockPresignClient)
-	url, err := manager.GetPresignedURL("test-bucket", "test-key")
+	url, err := manager.GetPresignedURL(context.Background(), "test-bucket", "test-key")
 
 	if err != nil {
 		t.Fatalf("GetPresignedURL failed: %v", err)
@@ -110,7 +223,7 @@ func TestGetPresignedURLError(t *testing.T) {
 	}
 
 	manager := NewS3Manager(&MockS3Client{}, mockPresignClient)
-	_, err := manager.GetPresignedURL("test-bucket", "test-key")
+	_, err := manager.GetPresignedURL(context.Background(), "test-bucket", "test-key")
 
 	if err == nil {
 		t.Error("Expected error from GetPresignedURL, got nil")
@@ -133,7 +246,7 @@ func TestListS3Folders(t *testing.T) {
 	}
 
 	manager := NewS3Manager(mockClient, &MockPresignClient{})
-	folders, err := manager.ListS3Folders("test-bucket")
+	folders, err := manager.ListS3Folders(context.Background(), "test-bucket")
 
 	if err != nil {
 		t.Fatalf("ListS3Folders failed: %v", err)
@@ -147,3 +260,358 @@ func TestListS3Folders(t *testing.T) {
 	}
 }
 
+// newFakeS3Server starts an in-process S3-compatible server over TLS and
+// writes its certificate to a CA bundle file
+func newFakeS3Server(t *testing.T) (*httptest.Server, string) {
+	t.Helper()
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/test-bucket" && r.URL.Query().Get("list-type") == "2":
+			w.Header().Set("Content-Type", "application/xml")
+			fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<ListBucketResult xmlns="http://s3.amazonaws.com/doc/2006-03-01/">
+  <Name>test-bucket</Name>
+  <Prefix>%s</Prefix>
+  <KeyCount>1</KeyCount>
+  <IsTruncated>false</IsTruncated>
+  <Contents><Key>%sfile.txt</Key><ETag>"abc123"</ETag><Size>11</Size></Contents>
+</ListBucketResult>`, r.URL.Query().Get("prefix"), r.URL.Query().Get("prefix"))
+		case r.URL.Path == "/test-bucket/dir/file.txt" && r.Method == http.MethodGet:
+			w.Write([]byte("hello minio"))
+		default:
+			t.Errorf("Unexpected request: %s %s", r.Method, r.URL.String())
+			http.Error(w, "unexpected", http.StatusBadRequest)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(caFile, certPEM, 0600); err != nil {
+		t.Fatalf("Failed to write CA bundle: %v", err)
+	}
+	return server, caFile
+}
+
+func TestCompatibleEndpointEndToEnd(t *testing.T) {
+	server, caFile := newFakeS3Server(t)
+	s3cfg := configs.S3Config{
+		BucketName:   "test-bucket",
+		AccessKeyId:  "minio",
+		SecretAccess: "minio123",
+		Endpoint:     server.URL,
+		UsePathStyle: true,
+		CABundle:     caFile,
+	}
+
+	cfg, err := awsSDK.NewDefaultAWSManager().ConnectWithS3Config(s3cfg)
+	if err != nil {
+		t.Fatalf("ConnectWithS3Config failed: %v", err)
+	}
+	if cfg.Region != awsSDK.DefaultCompatibleRegion {
+		t.Errorf("Region = %s, want %s", cfg.Region, awsSDK.DefaultCompatibleRegion)
+	}
+
+	manager := NewManagerFromConfig(cfg, s3cfg)
+	objects, err := manager.ListS3Objects(context.Background(), "test-bucket", "dir/")
+	if err != nil {
+		t.Fatalf("ListS3Objects failed: %v", err)
+	}
+	if len(objects) != 1 || *objects[0].Key != "dir/file.txt" {
+		t.Fatalf("Unexpected objects: %+v", objects)
+	}
+
+	url, err := manager.GetPresignedURL(context.Background(), "test-bucket", "dir/file.txt")
+	if err != nil {
+		t.Fatalf("GetPresignedURL failed: %v", err)
+	}
+	if !strings.HasPrefix(url, server.URL+"/test-bucket/dir/file.txt") {
+		t.Errorf("Presigned URL %s should use the custom endpoint with path-style addressing", url)
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	resp, err := manager.HTTPClient.Do(req)
+	if err != nil {
+		t.Fatalf("Download through HTTPClient failed: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != "hello minio" {
+		t.Errorf("Downloaded %q, want %q", body, "hello minio")
+	}
+}
+
+func TestCompatibleEndpointUntrustedCA(t *testing.T) {
+	server, _ := newFakeS3Server(t)
+	server.Config.ErrorLog = log.New(io.Discard, "", 0)
+	s3cfg := configs.S3Config{
+		AccessKeyId:  "minio",
+		SecretAccess: "minio123",
+		Endpoint:     server.URL,
+		UsePathStyle: true,
+	}
+
+	cfg, err := awsSDK.NewDefaultAWSManager().ConnectWithS3Config(s3cfg)
+	if err != nil {
+		t.Fatalf("ConnectWithS3Config failed: %v", err)
+	}
+	manager := NewManagerFromConfig(cfg, s3cfg)
+	if _, err := manager.ListS3Objects(context.Background(), "test-bucket", "dir/"); err == nil {
+		t.Error("Expected TLS verification error without CA bundle, got nil")
+	}
+
+	s3cfg.InsecureSkipVerify = true
+	cfg, err = awsSDK.NewDefaultAWSManager().ConnectWithS3Config(s3cfg)
+	if err != nil {
+		t.Fatalf("ConnectWithS3Config failed: %v", err)
+	}
+	manager = NewManagerFromConfig(cfg, s3cfg)
+	if _, err := manager.ListS3Objects(context.Background(), "test-bucket", "dir/"); err != nil {
+		t.Errorf("ListS3Objects with insecureSkipVerify failed: %v", err)
+	}
+}
+
+func TestListS3ObjectVersionsPaginates(t *testing.T) {
+	calls := 0
+	mockClient := &MockS3Client{
+		ListObjectVersionsFunc: func(ctx context.Context, params *s3.ListObjectVersionsInput, optFns ...func(*s3.Options)) (*s3.ListObjectVersionsOutput, error) {
+			calls++
+			if calls == 1 {
+				return &s3.ListObjectVersionsOutput{
+					Versions:            []types.ObjectVersion{{Key: aws.String("a.txt"), VersionId: aws.String("v1")}},
+					IsTruncated:         aws.Bool(true),
+					NextKeyMarker:       aws.String("a.txt"),
+					NextVersionIdMarker: aws.String("v1"),
+				}, nil
+			}
+			if aws.ToString(params.KeyMarker) != "a.txt" || aws.ToString(params.VersionIdMarker) != "v1" {
+				t.Errorf("Unexpected markers: %v / %v", aws.ToString(params.KeyMarker), aws.ToString(params.VersionIdMarker))
+			}
+			return &s3.ListObjectVersionsOutput{
+				Versions:      []types.ObjectVersion{{Key: aws.String("b.txt"), VersionId: aws.String("v2")}},
+				DeleteMarkers: []types.DeleteMarkerEntry{{Key: aws.String("c.txt"), VersionId: aws.String("v3")}},
+			}, nil
+		},
+	}
+
+	manager := NewS3Manager(mockClient, &MockPresignClient{})
+	versions, markers, err := manager.ListS3ObjectVersions(context.Background(), "test-bucket", "prefix/")
+	if err != nil {
+		t.Fatalf("ListS3ObjectVersions failed: %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("Expected 2 list calls, got %d", calls)
+	}
+	if len(versions) != 2 || len(markers) != 1 {
+		t.Errorf("Got %d versions and %d markers, want 2 and 1", len(versions), len(markers))
+	}
+}
+
+func TestListS3ObjectVersionsError(t *testing.T) {
+	mockClient := &MockS3Client{
+		ListObjectVersionsFunc: func(ctx context.Context, params *s3.ListObjectVersionsInput, optFns ...func(*s3.Options)) (*s3.ListObjectVersionsOutput, error) {
+			return nil, errors.New("AWS Error")
+		},
+	}
+
+	manager := NewS3Manager(mockClient, &MockPresignClient{})
+	if _, _, err := manager.ListS3ObjectVersions(context.Background(), "test-bucket", "prefix/"); err == nil {
+		t.Error("Expected error from ListS3ObjectVersions, got nil")
+	}
+}
+
+func TestSelectVersionsAsOf(t *testing.T) {
+	at := func(day int) *time.Time {
+		ts := time.Date(2024, 1, day, 0, 0, 0, 0, time.UTC)
+		return &ts
+	}
+	versions := []types.ObjectVersion{
+		{Key: aws.String("a.txt"), VersionId: aws.String("a1"), LastModified: at(1)},
+		{Key: aws.String("a.txt"), VersionId: aws.String("a2"), LastModified: at(5)},
+		{Key: aws.String("a.txt"), VersionId: aws.String("a3"), LastModified: at(20)},
+		{Key: aws.String("b.txt"), VersionId: aws.String("b1"), LastModified: at(2)},
+		{Key: aws.String("c.txt"), VersionId: aws.String("c1"), LastModified: at(15)},
+		{Key: aws.String("d.txt"), VersionId: aws.String("d1"), LastModified: at(3)},
+	}
+	markers := []types.DeleteMarkerEntry{
+		{Key: aws.String("b.txt"), VersionId: aws.String("b-del"), LastModified: at(4)},
+		{Key: aws.String("d.txt"), VersionId: aws.String("d-del"), LastModified: at(12)},
+	}
+
+	selected := SelectVersionsAsOf(versions, markers, *at(10))
+
+	got := make(map[string]string)
+	for _, v := range selected {
+		got[*v.Key] = *v.VersionId
+	}
+	want := map[string]string{"a.txt": "a2", "d.txt": "d1"}
+	if len(got) != len(want) {
+		t.Fatalf("Selected %v, want %v", got, want)
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("Key %s selected version %s, want %s", k, got[k], v)
+		}
+	}
+}
+
+func TestGetPresignedVersionURL(t *testing.T) {
+	mockPresignClient := &MockPresignClient{
+		PresignGetObjectFunc: func(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.PresignOptions)) (*v4.PresignedHTTPRequest, error) {
+			if aws.ToString(params.VersionId) != "v42" {
+				t.Errorf("Expected version 'v42', got %s", aws.ToString(params.VersionId))
+			}
+			return &v4.PresignedHTTPRequest{URL: "https://presigned-url.com?versionId=v42"}, nil
+		},
+	}
+
+	manager := NewS3Manager(&MockS3Client{}, mockPresignClient)
+	url, err := manager.GetPresignedVersionURL(context.Background(), "test-bucket", "test-key", "v42")
+	if err != nil {
+		t.Fatalf("GetPresignedVersionURL failed: %v", err)
+	}
+	if url != "https://presigned-url.com?versionId=v42" {
+		t.Errorf("Unexpected URL %s", url)
+	}
+}
+
+func TestIsArchivedStorageClass(t *testing.T) {
+	tests := []struct {
+		storageClass string
+		want         bool
+	}{
+		{"GLACIER", true},
+		{"DEEP_ARCHIVE", true},
+		{"GLACIER_IR", false},
+		{"STANDARD", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if got := IsArchivedStorageClass(tt.storageClass); got != tt.want {
+			t.Errorf("IsArchivedStorageClass(%q) = %v, want %v", tt.storageClass, got, tt.want)
+		}
+	}
+}
+
+func TestEnsureRestored(t *testing.T) {
+	tests := []struct {
+		name          string
+		restoreHeader *string
+		wantStatus    RestoreStatus
+		wantRestore   bool
+	}{
+		{"NotRequested", nil, RestoreInProgress, true},
+		{"InProgress", aws.String(`ongoing-request="true"`), RestoreInProgress, false},
+		{"Completed", aws.String(`ongoing-request="false", expiry-date="Fri, 21 Dec 2012 00:00:00 GMT"`), RestoreCompleted, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			restoreCalled := false
+			mockClient := &MockS3Client{
+				HeadObjectFunc: func(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+					return &s3.HeadObjectOutput{Restore: tt.restoreHeader, StorageClass: types.StorageClassGlacier}, nil
+				},
+				RestoreObjectFunc: func(ctx context.Context, params *s3.RestoreObjectInput, optFns ...func(*s3.Options)) (*s3.RestoreObjectOutput, error) {
+					restoreCalled = true
+					if *params.RestoreRequest.Days != 3 {
+						t.Errorf("Days = %d, want 3", *params.RestoreRequest.Days)
+					}
+					if params.RestoreRequest.GlacierJobParameters.Tier != types.TierBulk {
+						t.Errorf("Tier = %s, want Bulk", params.RestoreRequest.GlacierJobParameters.Tier)
+					}
+					return &s3.RestoreObjectOutput{}, nil
+				},
+			}
+
+			manager := NewS3Manager(mockClient, &MockPresignClient{})
+			status, err := manager.EnsureRestored(context.Background(), "test-bucket", "archive/file.bin", "", 3, "Bulk")
+			if err != nil {
+				t.Fatalf("EnsureRestored failed: %v", err)
+			}
+			if status != tt.wantStatus {
+				t.Errorf("Status = %s, want %s", status, tt.wantStatus)
+			}
+			if restoreCalled != tt.wantRestore {
+				t.Errorf("RestoreObject called = %v, want %v", restoreCalled, tt.wantRestore)
+			}
+		})
+	}
+}
+
+func TestRequestRestoreAlreadyInProgress(t *testing.T) {
+	mockClient := &MockS3Client{
+		RestoreObjectFunc: func(ctx context.Context, params *s3.RestoreObjectInput, optFns ...func(*s3.Options)) (*s3.RestoreObjectOutput, error) {
+			if *params.RestoreRequest.Days != DefaultRestoreDays {
+				t.Errorf("Days = %d, want default %d", *params.RestoreRequest.Days, DefaultRestoreDays)
+			}
+			return nil, &smithy.GenericAPIError{Code: "RestoreAlreadyInProgress"}
+		},
+	}
+
+	manager := NewS3Manager(mockClient, &MockPresignClient{})
+	if err := manager.RequestRestore(context.Background(), "test-bucket", "archive/file.bin", "", 0, ""); err != nil {
+		t.Errorf("RestoreAlreadyInProgress should not be an error, got %v", err)
+	}
+}
+
+func TestRequestRestoreError(t *testing.T) {
+	mockClient := &MockS3Client{
+		RestoreObjectFunc: func(ctx context.Context, params *s3.RestoreObjectInput, optFns ...func(*s3.Options)) (*s3.RestoreObjectOutput, error) {
+			return nil, errors.New("AccessDenied")
+		},
+	}
+
+	manager := NewS3Manager(mockClient, &MockPresignClient{})
+	if err := manager.RequestRestore(context.Background(), "test-bucket", "archive/file.bin", "", 1, "Bulk"); err == nil {
+		t.Error("Expected error from RequestRestore, got nil")
+	}
+}
+
+func TestGetObjectTags(t *testing.T) {
+	mockClient := &MockS3Client{
+		GetObjectTaggingFunc: func(ctx context.Context, params *s3.GetObjectTaggingInput, optFns ...func(*s3.Options)) (*s3.GetObjectTaggingOutput, error) {
+			if aws.ToString(params.VersionId) != "v1" {
+				t.Errorf("Expected version 'v1', got %s", aws.ToString(params.VersionId))
+			}
+			return &s3.GetObjectTaggingOutput{
+				TagSet: []types.Tag{
+					{Key: aws.String("owner"), Value: aws.String("finance")},
+					{Key: aws.String("retention"), Value: aws.String("7y")},
+				},
+			}, nil
+		},
+	}
+
+	manager := NewS3Manager(mockClient, &MockPresignClient{})
+	tags, err := manager.GetObjectTags(context.Background(), "test-bucket", "test-key", "v1")
+	if err != nil {
+		t.Fatalf("GetObjectTags failed: %v", err)
+	}
+	if tags["owner"] != "finance" || tags["retention"] != "7y" {
+		t.Errorf("Unexpected tags: %v", tags)
+	}
+}
+
+func TestCheckBucket(t *testing.T) {
+	mockClient := &MockS3Client{
+		ListObjectsV2Func: func(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+			if aws.ToInt32(params.MaxKeys) != 1 {
+				t.Errorf("MaxKeys = %d, want 1", aws.ToInt32(params.MaxKeys))
+			}
+			if *params.Bucket == "denied" {
+				return nil, errors.New("AccessDenied")
+			}
+			return &s3.ListObjectsV2Output{}, nil
+		},
+	}
+
+	manager := NewS3Manager(mockClient, &MockPresignClient{})
+	if err := manager.CheckBucket(context.Background(), "test-bucket"); err != nil {
+		t.Errorf("CheckBucket failed: %v", err)
+	}
+	if err := manager.CheckBucket(context.Background(), "denied"); err == nil {
+		t.Error("Expected error for denied bucket, got nil")
+	}
+}
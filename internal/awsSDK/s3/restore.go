@@ -0,0 +1,139 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/vincent119/s3syncgoogledrive/internal/awsSDK"
+	"github.com/vincent119/s3syncgoogledrive/internal/pkg/logging"
+	"github.com/vincent119/s3syncgoogledrive/internal/pkg/tracing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+// Default restore settings used when the config leaves them empty
+const (
+	DefaultRestoreTier = string(types.TierStandard)
+	DefaultRestoreDays = 7
+)
+
+// RestoreStatus describes whether an archived object can be downloaded
+type RestoreStatus int
+
+const (
+	// RestoreNotRequested means the object is archived and no restore is running
+	RestoreNotRequested RestoreStatus = iota
+	// RestoreInProgress means a restore was requested but is not finished yet
+	RestoreInProgress
+	// RestoreCompleted means a temporary restored copy is available for download
+	RestoreCompleted
+)
+
+func (s RestoreStatus) String() string {
+	switch s {
+	case RestoreInProgress:
+		return "in-progress"
+	case RestoreCompleted:
+		return "completed"
+	default:
+		return "not-requested"
+	}
+}
+
+// IsArchivedStorageClass reports whether objects in storageClass need a restore before download
+func IsArchivedStorageClass(storageClass string) bool {
+	switch storageClass {
+	case string(types.StorageClassGlacier), string(types.StorageClassDeepArchive):
+		return true
+	}
+	return false
+}
+
+// GetRestoreStatus reads the restore state of an archived object with HeadObject
+func (m *S3Manager) GetRestoreStatus(ctx context.Context, bucket, key, versionID string) (RestoreStatus, error) {
+	input := &s3.HeadObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	}
+	if versionID != "" {
+		input.VersionId = aws.String(versionID)
+	}
+
+	callCtx, span := m.startCall(ctx, "HeadObject", tracing.KeyS3Key.String(key))
+	resp, err := m.Client.HeadObject(callCtx, input)
+	m.endCall(span, "HeadObject", err)
+	if err != nil {
+		m.logger().Error("Failed to head object", logging.KeyS3Key, key, logging.Err(err))
+		return RestoreNotRequested, awsSDK.WrapError("head object "+key, err)
+	}
+	return parseRestoreHeader(aws.ToString(resp.Restore)), nil
+}
+
+// parseRestoreHeader interprets the x-amz-restore header,
+// e.g. `ongoing-request="false", expiry-date="Fri, 21 Dec 2012 00:00:00 GMT"`
+func parseRestoreHeader(header string) RestoreStatus {
+	switch {
+	case strings.Contains(header, `ongoing-request="true"`):
+		return RestoreInProgress
+	case strings.Contains(header, `ongoing-request="false"`):
+		return RestoreCompleted
+	default:
+		return RestoreNotRequested
+	}
+}
+
+// RequestRestore starts a restore of an archived object for the given number of days
+func (m *S3Manager) RequestRestore(ctx context.Context, bucket, key, versionID string, days int32, tier string) error {
+	if days <= 0 {
+		days = DefaultRestoreDays
+	}
+	if tier == "" {
+		tier = DefaultRestoreTier
+	}
+
+	input := &s3.RestoreObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+		RestoreRequest: &types.RestoreRequest{
+			Days:                 aws.Int32(days),
+			GlacierJobParameters: &types.GlacierJobParameters{Tier: types.Tier(tier)},
+		},
+	}
+	if versionID != "" {
+		input.VersionId = aws.String(versionID)
+	}
+
+	callCtx, span := m.startCall(ctx, "RestoreObject", tracing.KeyS3Key.String(key))
+	_, err := m.Client.RestoreObject(callCtx, input)
+	m.endCall(span, "RestoreObject", err)
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) && apiErr.ErrorCode() == "RestoreAlreadyInProgress" {
+		return nil
+	}
+	if err != nil {
+		m.logger().Error("Failed to request restore", logging.KeyS3Key, key, logging.Err(err))
+		return awsSDK.WrapError("restore "+key, err)
+	}
+	m.logger().Info("Restore requested", logging.KeyS3Key, key, "tier", tier, "days", days)
+	return nil
+}
+
+// EnsureRestored checks an archived object and requests a restore when needed.
+// It returns the status after the call; only RestoreCompleted can be downloaded.
+func (m *S3Manager) EnsureRestored(ctx context.Context, bucket, key, versionID string, days int32, tier string) (RestoreStatus, error) {
+	status, err := m.GetRestoreStatus(ctx, bucket, key, versionID)
+	if err != nil {
+		return status, err
+	}
+	if status != RestoreNotRequested {
+		return status, nil
+	}
+	if err := m.RequestRestore(ctx, bucket, key, versionID, days, tier); err != nil {
+		return RestoreNotRequested, err
+	}
+	return RestoreInProgress, nil
+}
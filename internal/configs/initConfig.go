@@ -1,9 +1,17 @@
 package configs
 
 import (
-	"fmt"
+	"reflect"
+	"strings"
+)
 
-	"github.com/spf13/viper"
+// AWS credential modes accepted by S3Config.CredentialMode
+const (
+	CredentialModeDefault     = "default"
+	CredentialModeStatic      = "static"
+	CredentialModeProfile     = "profile"
+	CredentialModeAssumeRole  = "assumeRole"
+	CredentialModeWebIdentity = "webIdentity"
 )
 
 type S3Config struct {
@@ -11,41 +19,296 @@ type S3Config struct {
 	Region       string `mapstructure:"region"`
 	AccessKeyId  string `mapstructure:"accessKeyId"`
 	SecretAccess string `mapstructure:"secretAccess"`
+	SessionToken string `mapstructure:"sessionToken"`
+
+	// CredentialMode selects how AWS credentials are resolved.
+	// Empty means "static" when keys are set, otherwise "default".
+	CredentialMode       string `mapstructure:"credentialMode"`
+	Profile              string `mapstructure:"profile"`
+	RoleArn              string `mapstructure:"roleArn"`
+	ExternalID           string `mapstructure:"externalId"`
+	SessionName          string `mapstructure:"sessionName"`
+	WebIdentityTokenFile string `mapstructure:"webIdentityTokenFile"`
+
+	// S3-compatible storage (MinIO, Ceph, R2, Wasabi)
+	Endpoint           string `mapstructure:"endpoint"`
+	UsePathStyle       bool   `mapstructure:"usePathStyle"`
+	CABundle           string `mapstructure:"caBundle"`
+	InsecureSkipVerify bool   `mapstructure:"insecureSkipVerify"`
+
+	Restore RestoreConfig `mapstructure:"restore"`
+}
+
+// RestoreConfig controls restores of GLACIER / DEEP_ARCHIVE objects
+type RestoreConfig struct {
+	Enabled bool   `mapstructure:"enabled"`
+	Tier    string `mapstructure:"tier"` // Standard | Bulk | Expedited
+	Days    int32  `mapstructure:"days"`
+}
+
+// ResolvedCredentialMode returns the effective credential mode
+func (c S3Config) ResolvedCredentialMode() string {
+	if c.CredentialMode != "" {
+		return c.CredentialMode
+	}
+	if c.AccessKeyId != "" && c.SecretAccess != "" {
+		return CredentialModeStatic
+	}
+	return CredentialModeDefault
 }
 
+// Google Drive authentication modes accepted by DriveConfig.AuthMode
+const (
+	DriveAuthModeOAuth          = "oauth"
+	DriveAuthModeServiceAccount = "serviceAccount"
+)
+
 type DriveConfig struct {
-	ClientID      string `mapstructure:"client_id"`
-	ClientSecret  string `mapstructure:"client_secret"`
-	RefreshToken  string `mapstructure:"refresh_token"`
-	FolderID      string `mapstructure:"folder_id"`
-	MaxConcurrent int    `mapstructure:"maxConcurrent"`
+	ClientID      string         `mapstructure:"client_id"`
+	ClientSecret  string         `mapstructure:"client_secret"`
+	RefreshToken  string         `mapstructure:"refresh_token"`
+	FolderID      string         `mapstructure:"folder_id"`
+	MaxConcurrent int            `mapstructure:"maxConcurrent"`
+	Metadata      MetadataConfig `mapstructure:"metadata"`
+	// SharedDrive is the ID or name of a shared drive used as the sync root
+	SharedDrive string `mapstructure:"sharedDrive"`
+
+	// AuthMode is "oauth" (default, user refresh token) or "serviceAccount"
+	AuthMode string `mapstructure:"authMode"`
+	// ServiceAccountKeyFile is the JSON key used in serviceAccount mode
+	ServiceAccountKeyFile string `mapstructure:"serviceAccountKeyFile"`
+	// ImpersonateUser is the Workspace user for domain-wide delegation
+	ImpersonateUser string `mapstructure:"impersonateUser"`
+
+	TokenStore TokenStoreConfig `mapstructure:"tokenStore"`
+	// Account is the named Google account used for syncing (empty = default)
+	Account string `mapstructure:"account"`
 }
 
-type BaseConfig struct {
-	S3    S3Config    `mapstructure:"S3"`
-	Drive DriveConfig `mapstructure:"Drive"`
+// Token store types accepted by TokenStoreConfig.Type
+const (
+	TokenStoreTypeFile          = "file"
+	TokenStoreTypeEncryptedFile = "encryptedFile"
+	TokenStoreTypeEnv           = "env"
+	TokenStoreTypeConfig        = "config"
+)
+
+// TokenStoreConfig selects where the Google OAuth token is kept
+type TokenStoreConfig struct {
+	Type          string `mapstructure:"type"` // file | encryptedFile | env | config
+	Path          string `mapstructure:"path"`
+	Dir           string `mapstructure:"dir"` // token files of named accounts
+	PassphraseEnv string `mapstructure:"passphraseEnv"`
+	EnvVar        string `mapstructure:"envVar"`
 }
 
-var Config BaseConfig
+// MetadataConfig controls which S3 object attributes are copied onto Drive files
+type MetadataConfig struct {
+	// PreserveModifiedTime sets the Drive modifiedTime from S3 LastModified
+	PreserveModifiedTime bool `mapstructure:"preserveModifiedTime"`
+	// UseContentType uses the S3 Content-Type as the Drive MIME type
+	UseContentType bool `mapstructure:"useContentType"`
+	// Rules map user metadata and object tags into Drive properties
+	Rules []MetadataRule `mapstructure:"rules"`
+	// Description is a text/template rendered with .Meta and .Tags
+	Description string `mapstructure:"description"`
+}
+
+// MetadataRule maps one S3 attribute into a Drive property.
+// Source is "meta:<name>" or "tag:<key>"; "meta:*" and "tag:*" copy every
+// entry, using Property as a key prefix.
+type MetadataRule struct {
+	Source   string `mapstructure:"source"`
+	Property string `mapstructure:"property"`
+}
+
+// UsesTags reports whether the rules or description need S3 object tags
+func (m MetadataConfig) UsesTags() bool {
+	for _, r := range m.Rules {
+		if strings.HasPrefix(r.Source, "tag:") {
+			return true
+		}
+	}
+	return strings.Contains(m.Description, ".Tags")
+}
+
+// Log levels and formats accepted by LogConfig
+const (
+	LogLevelDebug = "debug"
+	LogLevelInfo  = "info"
+	LogLevelWarn  = "warn"
+	LogLevelError = "error"
+
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
 
-func Init(configPath string) error {
-	viper.Reset()
-	viper.SetConfigName("base")
-	viper.SetConfigType("yaml")
-	viper.AddConfigPath(configPath)
-	viper.AutomaticEnv()
+// LogConfig controls the structured log output
+type LogConfig struct {
+	Level  string `mapstructure:"level"`  // debug | info | warn | error (default info)
+	Format string `mapstructure:"format"` // text | json (default text)
+}
+
+// DefaultMetricsJob is the Pushgateway job name when Metrics.job is empty
+const DefaultMetricsJob = "s3sync"
 
-	if err := viper.ReadInConfig(); err != nil {
-		return fmt.Errorf("failed to read base.yaml: %w", err)
+// MetricsConfig exposes Prometheus metrics while syncing
+type MetricsConfig struct {
+	Listen      string `mapstructure:"listen"`      // address serving /metrics, e.g. ":9090" (empty disables)
+	PushGateway string `mapstructure:"pushGateway"` // Pushgateway URL receiving the metrics when a run ends (empty disables)
+	Job         string `mapstructure:"job"`         // Pushgateway job name (default s3sync)
+}
+
+// ResolvedJob returns Job, defaulting to DefaultMetricsJob
+func (c MetricsConfig) ResolvedJob() string {
+	if c.Job == "" {
+		return DefaultMetricsJob
 	}
+	return c.Job
+}
 
-	if err := viper.Unmarshal(&Config); err != nil {
-		return fmt.Errorf("failed to unmarshal config: %w", err)
+// DefaultServiceName is the OpenTelemetry service name when Tracing.serviceName is empty
+const DefaultServiceName = "s3sync"
+
+// TracingConfig exports OpenTelemetry traces over OTLP/HTTP
+type TracingConfig struct {
+	Endpoint    string            `mapstructure:"endpoint"`    // OTLP/HTTP endpoint, e.g. "http://otel-collector:4318" (empty disables)
+	ServiceName string            `mapstructure:"serviceName"` // service.name of the spans (default s3sync)
+	SampleRatio *float64          `mapstructure:"sampleRatio"` // fraction of runs traced, 0-1 (unset traces every run, 0 none)
+	Headers     map[string]string `mapstructure:"headers"`     // sent with every export, e.g. an API key
+}
+
+// ResolvedServiceName returns ServiceName, defaulting to DefaultServiceName
+func (c TracingConfig) ResolvedServiceName() string {
+	if c.ServiceName == "" {
+		return DefaultServiceName
 	}
+	return c.ServiceName
+}
 
-	return nil
-	// Print test
-	// fmt.Printf("AWS S3 Bucket: %s, Region: %s\n", Config.S3.BucketName, Config.S3.Region)
-	// fmt.Printf("Google Drive Client ID: %s\n", Config.Drive.ClientID)
-	// fmt.Printf("Google Drive Client Secret: %s\n", Config.Drive.ClientSecret)
+// ResolvedSampleRatio returns SampleRatio, tracing every run when it is unset
+func (c TracingConfig) ResolvedSampleRatio() float64 {
+	if c.SampleRatio == nil {
+		return 1
+	}
+	return *c.SampleRatio
+}
+
+// Notifier types accepted by NotifierConfig.Type
+const (
+	NotifierTypeSlack   = "slack"
+	NotifierTypeTeams   = "teams"
+	NotifierTypeWebhook = "webhook"
+	NotifierTypeEmail   = "email"
+)
+
+// Run events accepted by NotifierConfig.On
+const (
+	NotifyOnStart   = "start"
+	NotifyOnSuccess = "success"
+	NotifyOnFailure = "failure"
+)
+
+// NotifierConfig is one channel told when a sync starts, succeeds or fails
+type NotifierConfig struct {
+	Name     string     `mapstructure:"name"`     // shown in logs (default type)
+	Type     string     `mapstructure:"type"`     // slack | teams | webhook | email
+	On       []string   `mapstructure:"on"`       // start | success | failure (empty = all)
+	URL      string     `mapstructure:"url"`      // incoming webhook or endpoint URL, not used by email
+	Secret   string     `mapstructure:"secret"`   // webhook only, signs the body with HMAC-SHA256
+	Template string     `mapstructure:"template"` // text/template of the message (default summary)
+	Subject  string     `mapstructure:"subject"`  // email only, text/template of the subject
+	SMTP     SMTPConfig `mapstructure:"smtp"`     // email only
+}
+
+// ResolvedName returns Name, defaulting to Type
+func (c NotifierConfig) ResolvedName() string {
+	if c.Name == "" {
+		return c.Type
+	}
+	return c.Name
+}
+
+// DefaultSMTPPort is the submission port used when SMTP.port is 0
+const DefaultSMTPPort = 587
+
+// SMTPConfig is the mail server of an email notifier
+type SMTPConfig struct {
+	Host     string   `mapstructure:"host"`
+	Port     int      `mapstructure:"port"` // default 587; STARTTLS is used when offered
+	Username string   `mapstructure:"username"`
+	Password string   `mapstructure:"password"`
+	From     string   `mapstructure:"from"`
+	To       []string `mapstructure:"to"`
+}
+
+// ResolvedPort returns Port, defaulting to DefaultSMTPPort
+func (c SMTPConfig) ResolvedPort() int {
+	if c.Port == 0 {
+		return DefaultSMTPPort
+	}
+	return c.Port
+}
+
+// DefaultJournalDir is where run journals are kept when Journal.dir is empty
+const DefaultJournalDir = "journal"
+
+// JournalConfig keeps a journal of every run, which sync -resume continues from
+type JournalConfig struct {
+	Enabled bool   `mapstructure:"enabled"` // default true
+	Dir     string `mapstructure:"dir"`     // one <run-id>.jsonl file per run (default journal)
+}
+
+// ResolvedDir returns Dir, defaulting to DefaultJournalDir
+func (c JournalConfig) ResolvedDir() string {
+	if c.Dir == "" {
+		return DefaultJournalDir
+	}
+	return c.Dir
+}
+
+type BaseConfig struct {
+	S3        S3Config         `mapstructure:"S3"`
+	Drive     DriveConfig      `mapstructure:"Drive"`
+	Log       LogConfig        `mapstructure:"Log"`
+	Metrics   MetricsConfig    `mapstructure:"Metrics"`
+	Tracing   TracingConfig    `mapstructure:"Tracing"`
+	Journal   JournalConfig    `mapstructure:"Journal"`
+	Notifiers []NotifierConfig `mapstructure:"Notifiers"`
+}
+
+var Config BaseConfig
+
+// EnvPrefix prefixes the environment variables overriding config keys,
+// e.g. S3SYNC_S3_BUCKETNAME for S3.bucketName
+const EnvPrefix = "S3SYNC"
+
+// EnvVarName returns the environment variable that overrides a config key
+func EnvVarName(key string) string {
+	return EnvPrefix + "_" + strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+}
+
+// EnvKeys lists every config key that can be overridden from the environment.
+// List fields such as Drive.metadata.rules can only be set in the file.
+func EnvKeys() []string {
+	return envKeys(reflect.TypeOf(BaseConfig{}), "")
+}
+
+func envKeys(t reflect.Type, prefix string) []string {
+	var keys []string
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("mapstructure")
+		if tag == "" {
+			continue
+		}
+		switch f.Type.Kind() {
+		case reflect.Struct:
+			keys = append(keys, envKeys(f.Type, prefix+tag+".")...)
+		case reflect.Slice, reflect.Map:
+		default:
+			keys = append(keys, prefix+tag)
+		}
+	}
+	return keys
 }
@@ -47,3 +47,103 @@ Drive:
 		t.Error("Init() should fail with invalid path")
 	}
 }
+
+func TestInitMetadataDefaults(t *testing.T) {
+	configContent := `
+S3:
+  bucketName: "test-bucket"
+Drive:
+  maxConcurrent: 1
+  metadata:
+    rules:
+      - source: "tag:owner"
+        property: "owner"
+`
+	tmpDir := t.TempDir()
+	if err := os.WriteFile(tmpDir+"/base.yaml", []byte(configContent), 0644); err != nil {
+		t.Fatalf("Failed to create temp config file: %v", err)
+	}
+
+	if err := Init(tmpDir); err != nil {
+		t.Fatalf("Init() failed: %v", err)
+	}
+
+	md := Config.Drive.Metadata
+	if !md.PreserveModifiedTime || !md.UseContentType {
+		t.Errorf("Metadata defaults not applied: %+v", md)
+	}
+	if len(md.Rules) != 1 || md.Rules[0].Source != "tag:owner" {
+		t.Errorf("Unexpected rules: %+v", md.Rules)
+	}
+	if !md.UsesTags() {
+		t.Error("UsesTags() = false, want true")
+	}
+}
+
+func TestInitEnvOverrides(t *testing.T) {
+	configContent := `
+S3:
+  bucketName: "file-bucket"
+  region: "file-region"
+Drive:
+  client_secret: "file-secret"
+  maxConcurrent: 5
+  metadata:
+    useContentType: true
+`
+	tmpDir := t.TempDir()
+	if err := os.WriteFile(tmpDir+"/base.yaml", []byte(configContent), 0644); err != nil {
+		t.Fatalf("Failed to create temp config file: %v", err)
+	}
+
+	t.Setenv("S3SYNC_S3_BUCKETNAME", "env-bucket")
+	t.Setenv("S3SYNC_DRIVE_CLIENT_SECRET", "env-secret")
+	t.Setenv("S3SYNC_DRIVE_MAXCONCURRENT", "3")
+	t.Setenv("S3SYNC_DRIVE_METADATA_USECONTENTTYPE", "false")
+	t.Setenv("S3SYNC_DRIVE_TOKENSTORE_TYPE", "env")
+	t.Setenv("S3SYNC_S3_RESTORE_DAYS", "2")
+
+	if err := Init(tmpDir); err != nil {
+		t.Fatalf("Init() failed: %v", err)
+	}
+
+	if Config.S3.BucketName != "env-bucket" {
+		t.Errorf("BucketName = %s, want env-bucket", Config.S3.BucketName)
+	}
+	if Config.S3.Region != "file-region" {
+		t.Errorf("Region = %s, want file-region", Config.S3.Region)
+	}
+	if Config.Drive.ClientSecret != "env-secret" {
+		t.Errorf("ClientSecret = %s, want env-secret", Config.Drive.ClientSecret)
+	}
+	if Config.Drive.MaxConcurrent != 3 {
+		t.Errorf("MaxConcurrent = %d, want 3", Config.Drive.MaxConcurrent)
+	}
+	if Config.Drive.Metadata.UseContentType {
+		t.Error("UseContentType = true, want false from env")
+	}
+	if Config.Drive.TokenStore.Type != "env" {
+		t.Errorf("TokenStore.Type = %s, want env", Config.Drive.TokenStore.Type)
+	}
+	if Config.S3.Restore.Days != 2 {
+		t.Errorf("Restore.Days = %d, want 2", Config.S3.Restore.Days)
+	}
+}
+
+func TestEnvKeys(t *testing.T) {
+	keys := make(map[string]bool)
+	for _, key := range EnvKeys() {
+		keys[key] = true
+	}
+	for _, key := range []string{"S3.bucketName", "S3.restore.tier", "Drive.client_secret", "Drive.tokenStore.passphraseEnv"} {
+		if !keys[key] {
+			t.Errorf("EnvKeys() is missing %s", key)
+		}
+	}
+	if keys["Drive.metadata.rules"] {
+		t.Error("EnvKeys() should not include list fields")
+	}
+	if got := EnvVarName("Drive.client_secret"); got != "S3SYNC_DRIVE_CLIENT_SECRET" {
+		t.Errorf("EnvVarName = %s, want S3SYNC_DRIVE_CLIENT_SECRET", got)
+	}
+}
@@ -0,0 +1,207 @@
+package configs
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// DefaultConfigName is the file name looked up when Options.Path is a directory
+const DefaultConfigName = "base"
+
+// includeKey lists files merged beneath the file that names them.
+// Paths are relative to the including file.
+const includeKey = "include"
+
+// supportedExts are the config formats, in lookup order
+var supportedExts = []string{".yaml", ".yml", ".toml", ".json"}
+
+// Options selects the configuration files to load
+type Options struct {
+	// Path is a config file, or a directory holding base.yaml/.yml/.toml/.json
+	Path string
+	// Profile merges <name>.<profile><ext> (e.g. base.dev.yaml) onto the base file
+	Profile string
+}
+
+// Source is a loaded configuration together with the files it was read from
+type Source struct {
+	Config BaseConfig
+	// Files lists every file read, includes first
+	Files []string
+
+	opts Options
+	v    *viper.Viper
+}
+
+// current is the Source behind Config, used by Validate
+var current *Source
+
+// CurrentSource returns the Source loaded by Init, or nil before Init
+func CurrentSource() *Source {
+	return current
+}
+
+// Init loads base.yaml (or .yml/.toml/.json) from the configPath directory,
+// or configPath itself when it is a file, into Config
+func Init(configPath string) error {
+	return InitWithOptions(Options{Path: configPath})
+}
+
+// InitWithOptions loads the configuration selected by opts into Config
+func InitWithOptions(opts Options) error {
+	src, err := Load(opts)
+	if err != nil {
+		return err
+	}
+	current = src
+	Config = src.Config
+	return nil
+}
+
+// Load reads a configuration into its own viper instance. Environment
+// variables named by EnvVarName take precedence over the files; command-line
+// flags that default to Config values take precedence over both.
+func Load(opts Options) (*Source, error) {
+	path, err := resolveConfigFile(opts.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	src := &Source{opts: opts, v: viper.New()}
+	// Unmarshal only sees environment variables of keys viper knows about,
+	// so every field is bound explicitly
+	for _, key := range EnvKeys() {
+		if err := src.v.BindEnv(key, EnvVarName(key)); err != nil {
+			return nil, fmt.Errorf("failed to bind %s: %w", EnvVarName(key), err)
+		}
+	}
+	src.v.SetDefault("Drive.metadata.preserveModifiedTime", true)
+	src.v.SetDefault("Drive.metadata.useContentType", true)
+	src.v.SetDefault("Journal.enabled", true)
+
+	files := []string{path}
+	if opts.Profile != "" {
+		ext := filepath.Ext(path)
+		files = append(files, strings.TrimSuffix(path, ext)+"."+opts.Profile+ext)
+	}
+	for _, file := range files {
+		settings, err := src.readFile(file, nil)
+		if err != nil {
+			return nil, err
+		}
+		if err := src.v.MergeConfigMap(settings); err != nil {
+			return nil, fmt.Errorf("failed to merge %s: %w", file, err)
+		}
+	}
+
+	if err := src.v.Unmarshal(&src.Config); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal config: %w", err)
+	}
+	return src, nil
+}
+
+// resolveConfigFile returns path itself, or the base config file inside it when it is a directory
+func resolveConfigFile(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read config %s: %w", path, err)
+	}
+	if !info.IsDir() {
+		return path, nil
+	}
+	for _, ext := range supportedExts {
+		file := filepath.Join(path, DefaultConfigName+ext)
+		if _, err := os.Stat(file); err == nil {
+			return file, nil
+		}
+	}
+	return "", fmt.Errorf("no %s.yaml, .yml, .toml or .json found in %s", DefaultConfigName, path)
+}
+
+// readFile parses one file and the files it includes, which it overrides.
+// stack holds the files being read to detect include cycles.
+func (s *Source) readFile(path string, stack []string) (map[string]any, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range stack {
+		if p == abs {
+			return nil, fmt.Errorf("include cycle: %s", strings.Join(append(stack, abs), " -> "))
+		}
+	}
+	stack = append(stack, abs)
+
+	ext := strings.ToLower(filepath.Ext(path))
+	if !contains(supportedExts, ext) {
+		return nil, fmt.Errorf("unsupported config format %q for %s: use YAML, TOML or JSON", ext, path)
+	}
+	fv := viper.New()
+	fv.SetConfigFile(path)
+	if err := fv.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("failed to read config %s: %w", path, err)
+	}
+
+	includes, err := includePaths(fv.Get(includeKey))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	merged := viper.New()
+	for _, inc := range includes {
+		if !filepath.IsAbs(inc) {
+			inc = filepath.Join(filepath.Dir(path), inc)
+		}
+		settings, err := s.readFile(inc, stack)
+		if err != nil {
+			return nil, err
+		}
+		if err := merged.MergeConfigMap(settings); err != nil {
+			return nil, fmt.Errorf("failed to merge %s: %w", inc, err)
+		}
+	}
+
+	own := fv.AllSettings()
+	delete(own, includeKey)
+	if err := merged.MergeConfigMap(own); err != nil {
+		return nil, fmt.Errorf("failed to merge %s: %w", path, err)
+	}
+	s.Files = append(s.Files, path)
+	return merged.AllSettings(), nil
+}
+
+// includePaths accepts a single path or a list of paths
+func includePaths(value any) ([]string, error) {
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return []string{v}, nil
+	case []any:
+		paths := make([]string, 0, len(v))
+		for _, item := range v {
+			p, ok := item.(string)
+			if !ok {
+				return nil, errors.New(includeKey + " must be a path or a list of paths")
+			}
+			paths = append(paths, p)
+		}
+		return paths, nil
+	default:
+		return nil, errors.New(includeKey + " must be a path or a list of paths")
+	}
+}
+
+// Validate checks the loaded configuration, including keys in its files that
+// match no field, and returns a *ValidationError listing every problem
+func (s *Source) Validate() error {
+	verr := &ValidationError{}
+	checkUnknownKeys(verr, s.v.AllSettings(), reflect.TypeOf(BaseConfig{}), "")
+	s.Config.validate(verr)
+	return verr.errOrNil()
+}
@@ -0,0 +1,177 @@
+package configs
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeConfigFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create dir for %s: %v", name, err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+	return dir
+}
+
+func TestLoadFormats(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"sync.toml": `
+[S3]
+bucketName = "toml-bucket"
+
+[Drive]
+maxConcurrent = 2
+`,
+		"sync.json": `{"S3": {"bucketName": "json-bucket"}, "Drive": {"maxConcurrent": 3}}`,
+		"sync.ini":  `bucketName=x`,
+	})
+
+	tests := []struct {
+		file          string
+		bucket        string
+		maxConcurrent int
+	}{
+		{"sync.toml", "toml-bucket", 2},
+		{"sync.json", "json-bucket", 3},
+	}
+	for _, tt := range tests {
+		src, err := Load(Options{Path: filepath.Join(dir, tt.file)})
+		if err != nil {
+			t.Fatalf("Load(%s) failed: %v", tt.file, err)
+		}
+		if src.Config.S3.BucketName != tt.bucket || src.Config.Drive.MaxConcurrent != tt.maxConcurrent {
+			t.Errorf("Load(%s) = %+v", tt.file, src.Config)
+		}
+		if !src.Config.Drive.Metadata.PreserveModifiedTime {
+			t.Errorf("Load(%s) did not apply defaults", tt.file)
+		}
+	}
+
+	if _, err := Load(Options{Path: filepath.Join(dir, "sync.ini")}); err == nil {
+		t.Error("Expected error for unsupported format, got nil")
+	}
+	if _, err := Load(Options{Path: dir}); err == nil {
+		t.Error("Expected error for directory without base config, got nil")
+	}
+}
+
+func TestLoadProfileOverlay(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"base.yaml": `
+S3:
+  bucketName: "prod-bucket"
+  region: "ap-northeast-1"
+Drive:
+  maxConcurrent: 10
+`,
+		"base.dev.yaml": `
+S3:
+  bucketName: "dev-bucket"
+Drive:
+  maxConcurrent: 2
+`,
+	})
+
+	src, err := Load(Options{Path: dir, Profile: "dev"})
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if src.Config.S3.BucketName != "dev-bucket" || src.Config.Drive.MaxConcurrent != 2 {
+		t.Errorf("Overlay not applied: %+v", src.Config)
+	}
+	if src.Config.S3.Region != "ap-northeast-1" {
+		t.Errorf("Region = %s, want base value ap-northeast-1", src.Config.S3.Region)
+	}
+
+	t.Setenv("S3SYNC_S3_BUCKETNAME", "env-bucket")
+	src, err = Load(Options{Path: dir, Profile: "dev"})
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if src.Config.S3.BucketName != "env-bucket" {
+		t.Errorf("BucketName = %s, want env-bucket over the profile", src.Config.S3.BucketName)
+	}
+
+	if _, err := Load(Options{Path: dir, Profile: "staging"}); err == nil {
+		t.Error("Expected error for missing profile overlay, got nil")
+	}
+}
+
+func TestLoadIncludes(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"base.yaml": `
+include:
+  - shared/s3.yaml
+  - shared/drive.json
+S3:
+  bucketName: "own-bucket"
+`,
+		"shared/s3.yaml": `
+include: region.toml
+S3:
+  bucketName: "shared-bucket"
+  credentialMode: "profile"
+  profile: "team"
+`,
+		"shared/region.toml": `
+[S3]
+region = "eu-west-1"
+`,
+		"shared/drive.json": `{"Drive": {"maxConcurrent": 4, "client_id": "id", "client_secret": "secret"}}`,
+	})
+
+	src, err := Load(Options{Path: dir})
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	cfg := src.Config
+	if cfg.S3.BucketName != "own-bucket" {
+		t.Errorf("BucketName = %s, want own-bucket (including file wins)", cfg.S3.BucketName)
+	}
+	if cfg.S3.Profile != "team" || cfg.S3.Region != "eu-west-1" || cfg.Drive.MaxConcurrent != 4 {
+		t.Errorf("Includes not merged: %+v", cfg)
+	}
+	if len(src.Files) != 4 {
+		t.Errorf("Files = %v, want 4 files", src.Files)
+	}
+	if err := src.Validate(); err != nil {
+		t.Errorf("Validate() = %v, include key should not be reported", err)
+	}
+}
+
+func TestLoadIncludeCycle(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"base.yaml": "include: a.yaml\n",
+		"a.yaml":    "include: base.yaml\n",
+	})
+
+	_, err := Load(Options{Path: dir})
+	if err == nil || !strings.Contains(err.Error(), "include cycle") {
+		t.Errorf("Load() = %v, want include cycle error", err)
+	}
+}
+
+func TestLoadSampleRatio(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"zero.yaml":  "Tracing:\n  sampleRatio: 0\n",
+		"unset.yaml": "Tracing:\n  serviceName: s3sync\n",
+	})
+	for file, want := range map[string]float64{"zero.yaml": 0, "unset.yaml": 1} {
+		src, err := Load(Options{Path: filepath.Join(dir, file)})
+		if err != nil {
+			t.Fatalf("Load(%s) failed: %v", file, err)
+		}
+		if got := src.Config.Tracing.ResolvedSampleRatio(); got != want {
+			t.Errorf("Load(%s) sample ratio = %g, want %g", file, got, want)
+		}
+	}
+}
@@ -0,0 +1,328 @@
+package configs
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// FieldError is a single configuration problem located by its YAML path
+type FieldError struct {
+	Path    string
+	Message string
+}
+
+func (e FieldError) Error() string {
+	return e.Path + ": " + e.Message
+}
+
+// ValidationError collects every problem found in a configuration
+type ValidationError struct {
+	Errors []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	lines := make([]string, 0, len(e.Errors)+1)
+	noun := "problems"
+	if len(e.Errors) == 1 {
+		noun = "problem"
+	}
+	lines = append(lines, fmt.Sprintf("invalid configuration (%d %s):", len(e.Errors), noun))
+	for _, fe := range e.Errors {
+		lines = append(lines, "  - "+fe.Error())
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (e *ValidationError) add(path, format string, args ...any) {
+	e.Errors = append(e.Errors, FieldError{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+// errOrNil avoids returning a typed nil pointer as a non-nil error
+func (e *ValidationError) errOrNil() error {
+	if len(e.Errors) == 0 {
+		return nil
+	}
+	sort.SliceStable(e.Errors, func(i, j int) bool { return e.Errors[i].Path < e.Errors[j].Path })
+	return e
+}
+
+// restoreTiers are the Glacier retrieval tiers accepted by S3.restore.tier
+var restoreTiers = []string{"Standard", "Bulk", "Expedited"}
+
+// Validate checks Config as loaded by Init, including keys in its files that
+// match no field, and returns a *ValidationError listing every problem
+func Validate() error {
+	if current == nil {
+		return Config.Validate()
+	}
+	return current.Validate()
+}
+
+// Validate checks required fields, ranges and enum values
+func (c BaseConfig) Validate() error {
+	verr := &ValidationError{}
+	c.validate(verr)
+	return verr.errOrNil()
+}
+
+func (c BaseConfig) validate(verr *ValidationError) {
+	c.S3.validate(verr)
+	c.Drive.validate(verr)
+	c.Log.validate(verr)
+	c.Metrics.validate(verr)
+	c.Tracing.validate(verr)
+	for i, n := range c.Notifiers {
+		n.validate(verr, fmt.Sprintf("Notifiers[%d]", i))
+	}
+}
+
+func (c MetricsConfig) validate(verr *ValidationError) {
+	if c.Listen != "" {
+		if _, _, err := net.SplitHostPort(c.Listen); err != nil {
+			verr.add("Metrics.listen", "must be host:port such as :9090, got %q", c.Listen)
+		}
+	}
+	if c.PushGateway != "" {
+		if u, err := url.Parse(c.PushGateway); err != nil || u.Scheme == "" || u.Host == "" {
+			verr.add("Metrics.pushGateway", "must be an absolute URL such as http://pushgateway:9091, got %q", c.PushGateway)
+		}
+	}
+}
+
+func (c TracingConfig) validate(verr *ValidationError) {
+	if c.Endpoint != "" {
+		if u, err := url.Parse(c.Endpoint); err != nil || u.Scheme == "" || u.Host == "" {
+			verr.add("Tracing.endpoint", "must be an absolute URL such as http://otel-collector:4318, got %q", c.Endpoint)
+		}
+	}
+	if r := c.ResolvedSampleRatio(); r < 0 || r > 1 {
+		verr.add("Tracing.sampleRatio", "must be between 0 and 1, got %g", r)
+	}
+}
+
+func (c NotifierConfig) validate(verr *ValidationError, path string) {
+	switch c.Type {
+	case NotifierTypeSlack, NotifierTypeTeams, NotifierTypeWebhook:
+		if u, err := url.Parse(c.URL); err != nil || u.Scheme == "" || u.Host == "" {
+			verr.add(path+".url", "must be an absolute URL for type %q, got %q", c.Type, c.URL)
+		}
+	case NotifierTypeEmail:
+		if c.SMTP.Host == "" {
+			verr.add(path+".smtp.host", "is required for type %q", c.Type)
+		}
+		if c.SMTP.Port < 0 || c.SMTP.Port > 65535 {
+			verr.add(path+".smtp.port", "must be between 1 and 65535 (0 uses the default), got %d", c.SMTP.Port)
+		}
+		if c.SMTP.From == "" {
+			verr.add(path+".smtp.from", "is required for type %q", c.Type)
+		}
+		if len(c.SMTP.To) == 0 {
+			verr.add(path+".smtp.to", "is required for type %q", c.Type)
+		}
+	default:
+		verr.add(path+".type", "must be one of %s, got %q", quoteList(NotifierTypeSlack, NotifierTypeTeams,
+			NotifierTypeWebhook, NotifierTypeEmail), c.Type)
+	}
+	for i, event := range c.On {
+		switch event {
+		case NotifyOnStart, NotifyOnSuccess, NotifyOnFailure:
+		default:
+			verr.add(fmt.Sprintf("%s.on[%d]", path, i), "must be one of %s, got %q",
+				quoteList(NotifyOnStart, NotifyOnSuccess, NotifyOnFailure), event)
+		}
+	}
+	for field, text := range map[string]string{"template": c.Template, "subject": c.Subject} {
+		if _, err := template.New(field).Parse(text); err != nil {
+			verr.add(path+"."+field, "is not a valid template: %v", err)
+		}
+	}
+}
+
+func (c LogConfig) validate(verr *ValidationError) {
+	switch c.Level {
+	case "", LogLevelDebug, LogLevelInfo, LogLevelWarn, LogLevelError:
+	default:
+		verr.add("Log.level", "must be one of %s, got %q", quoteList(LogLevelDebug, LogLevelInfo, LogLevelWarn, LogLevelError), c.Level)
+	}
+	switch c.Format {
+	case "", LogFormatText, LogFormatJSON:
+	default:
+		verr.add("Log.format", "must be one of %s, got %q", quoteList(LogFormatText, LogFormatJSON), c.Format)
+	}
+}
+
+func (c S3Config) validate(verr *ValidationError) {
+	if c.BucketName == "" {
+		verr.add("S3.bucketName", "is required")
+	}
+
+	switch mode := c.ResolvedCredentialMode(); mode {
+	case CredentialModeDefault:
+	case CredentialModeStatic:
+		if c.AccessKeyId == "" {
+			verr.add("S3.accessKeyId", "is required when credentialMode is %q", mode)
+		}
+		if c.SecretAccess == "" {
+			verr.add("S3.secretAccess", "is required when credentialMode is %q", mode)
+		}
+	case CredentialModeProfile:
+		if c.Profile == "" {
+			verr.add("S3.profile", "is required when credentialMode is %q", mode)
+		}
+	case CredentialModeAssumeRole:
+		if c.RoleArn == "" {
+			verr.add("S3.roleArn", "is required when credentialMode is %q", mode)
+		}
+	case CredentialModeWebIdentity:
+		if c.RoleArn == "" {
+			verr.add("S3.roleArn", "is required when credentialMode is %q", mode)
+		}
+		if c.WebIdentityTokenFile == "" {
+			verr.add("S3.webIdentityTokenFile", "is required when credentialMode is %q", mode)
+		}
+	default:
+		verr.add("S3.credentialMode", "must be one of %s, got %q", quoteList(CredentialModeDefault, CredentialModeStatic,
+			CredentialModeProfile, CredentialModeAssumeRole, CredentialModeWebIdentity), mode)
+	}
+
+	if c.Endpoint != "" {
+		if u, err := url.Parse(c.Endpoint); err != nil || u.Scheme == "" || u.Host == "" {
+			verr.add("S3.endpoint", "must be an absolute URL such as https://minio.example.com, got %q", c.Endpoint)
+		}
+	}
+
+	if c.Restore.Tier != "" && !contains(restoreTiers, c.Restore.Tier) {
+		verr.add("S3.restore.tier", "must be one of %s, got %q", quoteList(restoreTiers...), c.Restore.Tier)
+	}
+	if c.Restore.Days < 0 {
+		verr.add("S3.restore.days", "must be at least 1 (0 uses the default), got %d", c.Restore.Days)
+	}
+}
+
+func (c DriveConfig) validate(verr *ValidationError) {
+	// A zero-capacity semaphore blocks the first upload forever
+	if c.MaxConcurrent < 1 {
+		verr.add("Drive.maxConcurrent", "must be at least 1, got %d", c.MaxConcurrent)
+	}
+
+	switch c.AuthMode {
+	case "", DriveAuthModeOAuth:
+		if c.ClientID == "" {
+			verr.add("Drive.client_id", "is required in %s mode", DriveAuthModeOAuth)
+		}
+		if c.ClientSecret == "" {
+			verr.add("Drive.client_secret", "is required in %s mode", DriveAuthModeOAuth)
+		}
+	case DriveAuthModeServiceAccount:
+		if c.ServiceAccountKeyFile == "" {
+			verr.add("Drive.serviceAccountKeyFile", "is required in %s mode", DriveAuthModeServiceAccount)
+		}
+	default:
+		verr.add("Drive.authMode", "must be one of %s, got %q", quoteList(DriveAuthModeOAuth, DriveAuthModeServiceAccount), c.AuthMode)
+	}
+
+	switch c.TokenStore.Type {
+	case "", TokenStoreTypeFile, TokenStoreTypeEncryptedFile, TokenStoreTypeEnv:
+	case TokenStoreTypeConfig:
+		if c.Account != "" {
+			verr.add("Drive.account", "named accounts cannot use tokenStore.type %q", TokenStoreTypeConfig)
+		}
+	default:
+		verr.add("Drive.tokenStore.type", "must be one of %s, got %q", quoteList(TokenStoreTypeFile,
+			TokenStoreTypeEncryptedFile, TokenStoreTypeEnv, TokenStoreTypeConfig), c.TokenStore.Type)
+	}
+
+	for i, r := range c.Metadata.Rules {
+		path := fmt.Sprintf("Drive.metadata.rules[%d]", i)
+		name, ok := strings.CutPrefix(r.Source, "meta:")
+		if !ok {
+			name, ok = strings.CutPrefix(r.Source, "tag:")
+		}
+		if !ok || name == "" {
+			verr.add(path+".source", `must be "meta:<name>" or "tag:<key>", got %q`, r.Source)
+		}
+		if r.Property == "" && name != "*" {
+			verr.add(path+".property", "is required")
+		}
+	}
+	if c.Metadata.Description != "" {
+		if _, err := template.New("description").Parse(c.Metadata.Description); err != nil {
+			verr.add("Drive.metadata.description", "is not a valid template: %v", err)
+		}
+	}
+}
+
+// checkUnknownKeys reports settings that match no mapstructure tag of t.
+// Viper lower-cases keys, so paths are rebuilt from the struct tags where known.
+func checkUnknownKeys(verr *ValidationError, settings map[string]any, t reflect.Type, path string) {
+	fields := make(map[string]reflect.StructField, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if tag := f.Tag.Get("mapstructure"); tag != "" {
+			fields[strings.ToLower(tag)] = f
+		}
+	}
+
+	for key, value := range settings {
+		f, ok := fields[key]
+		if !ok {
+			verr.add(joinPath(path, key), "unknown key")
+			continue
+		}
+		fieldPath := joinPath(path, f.Tag.Get("mapstructure"))
+		switch f.Type.Kind() {
+		case reflect.Struct:
+			if m, ok := value.(map[string]any); ok {
+				checkUnknownKeys(verr, m, f.Type, fieldPath)
+			}
+		case reflect.Slice:
+			items, ok := value.([]any)
+			if !ok || f.Type.Elem().Kind() != reflect.Struct {
+				continue
+			}
+			for i, item := range items {
+				if m, ok := item.(map[string]any); ok {
+					checkUnknownKeys(verr, lowerKeys(m), f.Type.Elem(), fmt.Sprintf("%s[%d]", fieldPath, i))
+				}
+			}
+		}
+	}
+}
+
+// lowerKeys normalizes list items, whose keys viper leaves as written
+func lowerKeys(m map[string]any) map[string]any {
+	out := make(map[string]any, len(m))
+	for k, v := range m {
+		out[strings.ToLower(k)] = v
+	}
+	return out
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func contains(values []string, v string) bool {
+	for _, s := range values {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
+
+func quoteList(values ...string) string {
+	quoted := make([]string, len(values))
+	for i, v := range values {
+		quoted[i] = fmt.Sprintf("%q", v)
+	}
+	return strings.Join(quoted, ", ")
+}
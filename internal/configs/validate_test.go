@@ -0,0 +1,243 @@
+package configs
+
+import (
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/vincent119/s3syncgoogledrive/internal/pkg/logging"
+)
+
+func validConfig() BaseConfig {
+	return BaseConfig{
+		S3:    S3Config{BucketName: "bucket", Region: "us-east-1"},
+		Drive: DriveConfig{ClientID: "id", ClientSecret: "secret", MaxConcurrent: 4},
+	}
+}
+
+func TestValidateValid(t *testing.T) {
+	if err := validConfig().Validate(); err != nil {
+		t.Errorf("Validate() = %v, want nil", err)
+	}
+}
+
+func TestValidateAggregatesErrors(t *testing.T) {
+	cfg := validConfig()
+	cfg.S3.BucketName = ""
+	cfg.S3.CredentialMode = "magic"
+	cfg.S3.Restore.Tier = "Fast"
+	cfg.Drive.MaxConcurrent = 0
+	cfg.Drive.AuthMode = DriveAuthModeServiceAccount
+	cfg.Drive.TokenStore.Type = "vault"
+	cfg.Drive.Metadata.Rules = []MetadataRule{{Source: "header:x", Property: "x"}}
+	cfg.Drive.Metadata.Description = "{{ .Meta"
+
+	err := cfg.Validate()
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("Validate() = %v, want *ValidationError", err)
+	}
+
+	want := []string{
+		"Drive.maxConcurrent",
+		"Drive.metadata.description",
+		"Drive.metadata.rules[0].source",
+		"Drive.serviceAccountKeyFile",
+		"Drive.tokenStore.type",
+		"S3.bucketName",
+		"S3.credentialMode",
+		"S3.restore.tier",
+	}
+	if len(verr.Errors) != len(want) {
+		t.Fatalf("Got %d errors, want %d:\n%v", len(verr.Errors), len(want), err)
+	}
+	for i, path := range want {
+		if verr.Errors[i].Path != path {
+			t.Errorf("Errors[%d].Path = %s, want %s", i, verr.Errors[i].Path, path)
+		}
+	}
+	if !strings.Contains(err.Error(), "8 problems") {
+		t.Errorf("Error() = %q, want problem count", err.Error())
+	}
+}
+
+func TestValidateLog(t *testing.T) {
+	cfg := validConfig()
+	cfg.Log = LogConfig{Level: LogLevelDebug, Format: LogFormatJSON}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Validate() = %v, want nil", err)
+	}
+
+	cfg.Log = LogConfig{Level: "verbose", Format: "xml"}
+	var verr *ValidationError
+	if !errors.As(cfg.Validate(), &verr) || len(verr.Errors) != 2 {
+		t.Fatalf("Validate() = %v, want Log.format and Log.level errors", verr)
+	}
+	if verr.Errors[0].Path != "Log.format" || verr.Errors[1].Path != "Log.level" {
+		t.Errorf("Paths = %s, %s", verr.Errors[0].Path, verr.Errors[1].Path)
+	}
+}
+
+func TestValidateMetrics(t *testing.T) {
+	cfg := validConfig()
+	cfg.Metrics = MetricsConfig{Listen: ":9090", PushGateway: "http://pushgateway:9091"}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Validate() = %v, want nil", err)
+	}
+
+	cfg.Metrics = MetricsConfig{Listen: "9090", PushGateway: "pushgateway"}
+	var verr *ValidationError
+	if !errors.As(cfg.Validate(), &verr) || len(verr.Errors) != 2 {
+		t.Fatalf("Validate() = %v, want Metrics.listen and Metrics.pushGateway errors", verr)
+	}
+	if verr.Errors[0].Path != "Metrics.listen" || verr.Errors[1].Path != "Metrics.pushGateway" {
+		t.Errorf("Paths = %s, %s", verr.Errors[0].Path, verr.Errors[1].Path)
+	}
+}
+
+func TestValidateTracing(t *testing.T) {
+	cfg := validConfig()
+	cfg.Tracing = TracingConfig{Endpoint: "http://otel-collector:4318", SampleRatio: ratio(0.1)}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Validate() = %v, want nil", err)
+	}
+
+	cfg.Tracing = TracingConfig{Endpoint: "otel-collector:4318", SampleRatio: ratio(2)}
+	var verr *ValidationError
+	if !errors.As(cfg.Validate(), &verr) || len(verr.Errors) != 2 {
+		t.Fatalf("Validate() = %v, want Tracing.endpoint and Tracing.sampleRatio errors", verr)
+	}
+	if verr.Errors[0].Path != "Tracing.endpoint" || verr.Errors[1].Path != "Tracing.sampleRatio" {
+		t.Errorf("Paths = %s, %s", verr.Errors[0].Path, verr.Errors[1].Path)
+	}
+}
+
+func ratio(r float64) *float64 { return &r }
+
+func TestResolvedSampleRatio(t *testing.T) {
+	if got := (TracingConfig{}).ResolvedSampleRatio(); got != 1 {
+		t.Errorf("unset ResolvedSampleRatio() = %g, want 1", got)
+	}
+	// An explicit 0 traces nothing instead of falling back to every run
+	if got := (TracingConfig{SampleRatio: ratio(0)}).ResolvedSampleRatio(); got != 0 {
+		t.Errorf("ResolvedSampleRatio() = %g, want 0", got)
+	}
+}
+
+func TestValidateNotifiers(t *testing.T) {
+	cfg := validConfig()
+	cfg.Notifiers = []NotifierConfig{
+		{Type: NotifierTypeSlack, URL: "https://hooks.slack.com/services/T/B/x", On: []string{NotifyOnFailure}},
+		{Type: NotifierTypeWebhook, URL: "http://ops.internal/hooks/s3sync", Secret: "k", Template: "{{.RunID}}"},
+		{Type: NotifierTypeEmail, SMTP: SMTPConfig{Host: "smtp.example.com", From: "s3sync@example.com", To: []string{"ops@example.com"}}},
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Validate() = %v, want nil", err)
+	}
+
+	cfg.Notifiers = []NotifierConfig{
+		{Type: NotifierTypeTeams, URL: "outlook.office.com/webhook", On: []string{NotifyOnStart, "end"}},
+		{Type: NotifierTypeEmail, Subject: "{{.RunID"},
+		{Type: "pagerduty"},
+	}
+	var verr *ValidationError
+	if !errors.As(cfg.Validate(), &verr) {
+		t.Fatal("Validate() returned no error for invalid notifiers")
+	}
+	want := []string{
+		"Notifiers[0].on[1]", "Notifiers[0].url",
+		"Notifiers[1].smtp.from", "Notifiers[1].smtp.host", "Notifiers[1].smtp.to", "Notifiers[1].subject",
+		"Notifiers[2].type",
+	}
+	if len(verr.Errors) != len(want) {
+		t.Fatalf("Validate() = %v, want paths %v", verr, want)
+	}
+	for i, path := range want {
+		if verr.Errors[i].Path != path {
+			t.Errorf("Errors[%d].Path = %s, want %s", i, verr.Errors[i].Path, path)
+		}
+	}
+}
+
+func TestValidateCredentialModes(t *testing.T) {
+	tests := []struct {
+		mode string
+		want []string
+	}{
+		{CredentialModeStatic, []string{"S3.accessKeyId", "S3.secretAccess"}},
+		{CredentialModeProfile, []string{"S3.profile"}},
+		{CredentialModeAssumeRole, []string{"S3.roleArn"}},
+		{CredentialModeWebIdentity, []string{"S3.roleArn", "S3.webIdentityTokenFile"}},
+	}
+	for _, tt := range tests {
+		cfg := validConfig()
+		cfg.S3.CredentialMode = tt.mode
+		var verr *ValidationError
+		if !errors.As(cfg.Validate(), &verr) {
+			t.Fatalf("%s: expected validation error", tt.mode)
+		}
+		if len(verr.Errors) != len(tt.want) {
+			t.Fatalf("%s: got %v, want paths %v", tt.mode, verr, tt.want)
+		}
+		for i, path := range tt.want {
+			if verr.Errors[i].Path != path {
+				t.Errorf("%s: Errors[%d].Path = %s, want %s", tt.mode, i, verr.Errors[i].Path, path)
+			}
+		}
+	}
+}
+
+func TestValidateUnknownKeys(t *testing.T) {
+	configContent := `
+S3:
+  bucketName: "test-bucket"
+  bucktName: "typo"
+Drive:
+  client_id: "id"
+  client_secret: "secret"
+  maxConcurrent: 2
+  metadata:
+    rules:
+      - source: "tag:owner"
+        property: "owner"
+        propery: "typo"
+Extra: true
+`
+	tmpDir := t.TempDir()
+	if err := os.WriteFile(tmpDir+"/base.yaml", []byte(configContent), 0644); err != nil {
+		t.Fatalf("Failed to create temp config file: %v", err)
+	}
+	if err := Init(tmpDir); err != nil {
+		t.Fatalf("Init() failed: %v", err)
+	}
+
+	var verr *ValidationError
+	if !errors.As(Validate(), &verr) {
+		t.Fatal("Validate() returned no error for unknown keys")
+	}
+	want := []string{"Drive.metadata.rules[0].propery", "S3.bucktname", "extra"}
+	if len(verr.Errors) != len(want) {
+		t.Fatalf("Got %v, want paths %v", verr, want)
+	}
+	for i, path := range want {
+		if verr.Errors[i].Path != path || verr.Errors[i].Message != "unknown key" {
+			t.Errorf("Errors[%d] = %v, want unknown key at %s", i, verr.Errors[i], path)
+		}
+	}
+}
+
+// The logging package names levels and formats without importing configs
+func TestLogNamesMatchLogging(t *testing.T) {
+	for _, level := range []string{LogLevelDebug, LogLevelInfo, LogLevelWarn, LogLevelError} {
+		if _, err := logging.ParseLevel(level); err != nil {
+			t.Errorf("logging.ParseLevel(%q) = %v", level, err)
+		}
+	}
+	for _, format := range []string{LogFormatText, LogFormatJSON} {
+		if _, err := logging.New(io.Discard, "", format); err != nil {
+			t.Errorf("logging.New(format %q) = %v", format, err)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package configs
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vincent119/s3syncgoogledrive/internal/pkg/logging"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// DefaultReloadDelay lets editors finish writing before the files are read again
+const DefaultReloadDelay = 250 * time.Millisecond
+
+// reloadableKeys take effect on a running sync; other changes need a restart
+var reloadableKeys = []string{
+	"Drive.maxConcurrent",
+	"Drive.metadata",
+	"S3.restore",
+}
+
+// Reloadable reports whether a change to key applies without a restart
+func Reloadable(key string) bool {
+	for _, k := range reloadableKeys {
+		if key == k || strings.HasPrefix(key, k+".") || strings.HasPrefix(key, k+"[") {
+			return true
+		}
+	}
+	return false
+}
+
+// ChangedKeys lists the config keys whose values differ between a and b
+func ChangedKeys(a, b BaseConfig) []string {
+	return diffKeys(reflect.ValueOf(a), reflect.ValueOf(b), "")
+}
+
+func diffKeys(a, b reflect.Value, path string) []string {
+	if a.Kind() != reflect.Struct {
+		if reflect.DeepEqual(a.Interface(), b.Interface()) {
+			return nil
+		}
+		return []string{path}
+	}
+	var keys []string
+	for i := 0; i < a.NumField(); i++ {
+		tag := a.Type().Field(i).Tag.Get("mapstructure")
+		if tag == "" {
+			continue
+		}
+		keys = append(keys, diffKeys(a.Field(i), b.Field(i), joinPath(path, tag))...)
+	}
+	return keys
+}
+
+// Watcher reloads a configuration when any of its files change. A new
+// configuration replaces the current one only if it loads and validates;
+// otherwise the error is logged and the previous configuration is kept.
+type Watcher struct {
+	// OnReload is called with the previous and new configuration after a valid change
+	OnReload func(old, new BaseConfig)
+	// Delay debounces bursts of file events
+	Delay time.Duration
+	// Logger receives watcher errors and rejected reloads (defaults to slog.Default())
+	Logger *slog.Logger
+
+	mu      sync.RWMutex
+	current *Source
+}
+
+func (w *Watcher) logger() *slog.Logger {
+	if w.Logger == nil {
+		return slog.Default()
+	}
+	return w.Logger
+}
+
+// NewWatcher watches the files src was loaded from
+func NewWatcher(src *Source) *Watcher {
+	return &Watcher{Delay: DefaultReloadDelay, current: src}
+}
+
+// Current returns the configuration in effect
+func (w *Watcher) Current() BaseConfig {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.current.Config
+}
+
+// Reload reads the files again and swaps in the result if it is valid
+func (w *Watcher) Reload() error {
+	w.mu.RLock()
+	opts := w.current.opts
+	w.mu.RUnlock()
+
+	src, err := Load(opts)
+	if err == nil {
+		err = src.Validate()
+	}
+	if err != nil {
+		return fmt.Errorf("config change rejected, keeping the previous config: %w", err)
+	}
+
+	w.mu.Lock()
+	old := w.current.Config
+	w.current = src
+	w.mu.Unlock()
+
+	if w.OnReload != nil {
+		w.OnReload(old, src.Config)
+	}
+	return nil
+}
+
+// Run watches the config files until ctx is done. The parent directories are
+// watched so files replaced by editors or ConfigMap updates are still seen.
+func (w *Watcher) Run(ctx context.Context) error {
+	fw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to watch config: %w", err)
+	}
+	defer fw.Close()
+
+	watched := make(map[string]bool)
+	files := make(map[string]bool)
+	watchFiles := func() error {
+		w.mu.RLock()
+		paths := w.current.Files
+		w.mu.RUnlock()
+		for _, p := range paths {
+			abs, err := filepath.Abs(p)
+			if err != nil {
+				return err
+			}
+			files[abs] = true
+			if dir := filepath.Dir(abs); !watched[dir] {
+				if err := fw.Add(dir); err != nil {
+					return fmt.Errorf("failed to watch %s: %w", dir, err)
+				}
+				watched[dir] = true
+			}
+		}
+		return nil
+	}
+	if err := watchFiles(); err != nil {
+		return err
+	}
+
+	var timer *time.Timer
+	var fire <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-fw.Events:
+			if !ok {
+				return nil
+			}
+			abs, _ := filepath.Abs(event.Name)
+			if !files[abs] || event.Op == fsnotify.Chmod {
+				continue
+			}
+			if timer == nil {
+				timer = time.NewTimer(w.Delay)
+			} else {
+				timer.Reset(w.Delay)
+			}
+			fire = timer.C
+		case err, ok := <-fw.Errors:
+			if !ok {
+				return nil
+			}
+			w.logger().Error("Config watcher error", logging.Err(err))
+		case <-fire:
+			fire = nil
+			if err := w.Reload(); err != nil {
+				w.logger().Error("Config reload failed", logging.Err(err))
+				continue
+			}
+			// Includes may have changed
+			if err := watchFiles(); err != nil {
+				w.logger().Error("Config watcher error", logging.Err(err))
+			}
+		}
+	}
+}
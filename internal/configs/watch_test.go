@@ -0,0 +1,135 @@
+package configs
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const watchBaseConfig = `
+S3:
+  bucketName: "bucket"
+Drive:
+  client_id: "id"
+  client_secret: "secret"
+  maxConcurrent: 4
+`
+
+func TestWatcherReload(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{"base.yaml": watchBaseConfig})
+	src, err := Load(Options{Path: dir})
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	w := NewWatcher(src)
+	var reloads []int
+	w.OnReload = func(old, new BaseConfig) {
+		reloads = append(reloads, new.Drive.MaxConcurrent)
+	}
+
+	writeFile := func(content string) {
+		if err := os.WriteFile(filepath.Join(dir, "base.yaml"), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	writeFile(`
+S3:
+  bucketName: "bucket"
+Drive:
+  client_id: "id"
+  client_secret: "secret"
+  maxConcurrent: 8
+`)
+	if err := w.Reload(); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	if got := w.Current().Drive.MaxConcurrent; got != 8 {
+		t.Errorf("MaxConcurrent = %d, want 8", got)
+	}
+
+	writeFile(`
+S3:
+  bucketName: "bucket"
+Drive:
+  maxConcurrent: 0
+`)
+	if err := w.Reload(); err == nil {
+		t.Error("Expected invalid config to be rejected, got nil")
+	}
+	if got := w.Current().Drive.MaxConcurrent; got != 8 {
+		t.Errorf("MaxConcurrent = %d after rejected change, want 8", got)
+	}
+	if !reflect.DeepEqual(reloads, []int{8}) {
+		t.Errorf("OnReload calls = %v, want [8]", reloads)
+	}
+}
+
+func TestWatcherRun(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"base.yaml":   "include: shared.yaml\n" + watchBaseConfig,
+		"shared.yaml": "S3:\n  region: \"us-east-1\"\n",
+	})
+	src, err := Load(Options{Path: dir})
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	w := NewWatcher(src)
+	w.Delay = 10 * time.Millisecond
+	reloaded := make(chan BaseConfig, 1)
+	w.OnReload = func(old, new BaseConfig) { reloaded <- new }
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- w.Run(ctx) }()
+	time.Sleep(50 * time.Millisecond) // let the watcher register
+
+	if err := os.WriteFile(filepath.Join(dir, "shared.yaml"), []byte("S3:\n  region: \"eu-west-1\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case cfg := <-reloaded:
+		if cfg.S3.Region != "eu-west-1" {
+			t.Errorf("Region = %s, want eu-west-1", cfg.S3.Region)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("change to an included file was not reloaded")
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("Run returned %v", err)
+	}
+}
+
+func TestChangedKeys(t *testing.T) {
+	a := BaseConfig{Drive: DriveConfig{MaxConcurrent: 1}}
+	b := a
+	b.Drive.MaxConcurrent = 2
+	b.S3.BucketName = "other"
+	b.Drive.Metadata.Rules = []MetadataRule{{Source: "tag:*"}}
+
+	got := ChangedKeys(a, b)
+	want := []string{"S3.bucketName", "Drive.maxConcurrent", "Drive.metadata.rules"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ChangedKeys = %v, want %v", got, want)
+	}
+
+	for key, reloadable := range map[string]bool{
+		"Drive.maxConcurrent":  true,
+		"Drive.metadata.rules": true,
+		"S3.restore.days":      true,
+		"S3.bucketName":        false,
+		"Drive.metadataX":      false,
+	} {
+		if Reloadable(key) != reloadable {
+			t.Errorf("Reloadable(%s) = %v, want %v", key, !reloadable, reloadable)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package googlesdk
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+
+	"github.com/vincent119/s3syncgoogledrive/internal/configs"
+	drivesdk "github.com/vincent119/s3syncgoogledrive/internal/googlesdk/drive"
+)
+
+// DefaultAccount is the account stored at tokenStore.path
+const DefaultAccount = "default"
+
+// accountIndexFile lists the named accounts, stored in tokenStore.dir
+const accountIndexFile = "accounts.json"
+
+var accountNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+func normalizeAccount(account string) string {
+	if account == "" {
+		return DefaultAccount
+	}
+	return account
+}
+
+func validateAccountName(account string) error {
+	if !accountNamePattern.MatchString(account) {
+		return fmt.Errorf("invalid account name %q: use letters, digits, '.', '_' or '-'", account)
+	}
+	return nil
+}
+
+func (a *AuthManager) accountIndexPath() string {
+	dir := configs.Config.Drive.TokenStore.Dir
+	if dir == "" {
+		dir = DefaultTokenDir
+	}
+	return filepath.Join(dir, accountIndexFile)
+}
+
+func (a *AuthManager) readAccountIndex() ([]string, error) {
+	data, err := a.fs.ReadFile(a.accountIndexPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	if err := json.Unmarshal(data, &names); err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", a.accountIndexPath(), err)
+	}
+	return names, nil
+}
+
+func (a *AuthManager) writeAccountIndex(names []string) error {
+	sort.Strings(names)
+	data, err := json.Marshal(names)
+	if err != nil {
+		return err
+	}
+	return a.fs.WriteFile(a.accountIndexPath(), data, tokenFileMode)
+}
+
+// Accounts lists the default account (when it has a token) followed by every named account
+func (a *AuthManager) Accounts() ([]string, error) {
+	names, err := a.readAccountIndex()
+	if err != nil {
+		return nil, err
+	}
+	var accounts []string
+	if store, err := a.tokenStore(DefaultAccount); err == nil {
+		if _, err := store.Load(); err == nil {
+			accounts = append(accounts, DefaultAccount)
+		}
+	}
+	return append(accounts, names...), nil
+}
+
+// AddAccount authorizes a Google account and stores its token under name
+func (a *AuthManager) AddAccount(ctx context.Context, name string, headless bool) error {
+	name = normalizeAccount(name)
+	if err := validateAccountName(name); err != nil {
+		return err
+	}
+	if err := a.LoginAccount(ctx, name, headless); err != nil {
+		return err
+	}
+	if name == DefaultAccount {
+		return nil
+	}
+
+	names, err := a.readAccountIndex()
+	if err != nil {
+		return err
+	}
+	for _, n := range names {
+		if n == name {
+			return nil
+		}
+	}
+	return a.writeAccountIndex(append(names, name))
+}
+
+// RemoveAccount deletes the stored token of an account and forgets it
+func (a *AuthManager) RemoveAccount(name string) error {
+	name = normalizeAccount(name)
+	store, err := a.tokenStore(name)
+	if err != nil {
+		return err
+	}
+	if err := store.Delete(); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to delete token of account %s: %w", name, err)
+	}
+
+	a.mu.Lock()
+	delete(a.stores, name)
+	delete(a.services, name)
+	a.mu.Unlock()
+
+	names, err := a.readAccountIndex()
+	if err != nil {
+		return err
+	}
+	kept := names[:0]
+	for _, n := range names {
+		if n != name {
+			kept = append(kept, n)
+		}
+	}
+	return a.writeAccountIndex(kept)
+}
+
+// AccountEmail returns the email of the Google user behind an account via about.get
+func (a *AuthManager) AccountEmail(name string) (string, error) {
+	srv, err := a.DriveServiceFor(name)
+	if err != nil {
+		return "", err
+	}
+	about, err := srv.About.Get().Fields("user(emailAddress)").Do()
+	if err != nil {
+		return "", drivesdk.WrapError("get account email", err)
+	}
+	if about.User == nil {
+		return "", errors.New("about.get returned no user")
+	}
+	return about.User.EmailAddress, nil
+}
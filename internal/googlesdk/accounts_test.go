@@ -0,0 +1,163 @@
+package googlesdk
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/vincent119/s3syncgoogledrive/internal/configs"
+
+	"golang.org/x/oauth2"
+	drive "google.golang.org/api/drive/v3"
+	"google.golang.org/api/option"
+)
+
+func TestNewTokenStoreNamedAccount(t *testing.T) {
+	mockFS := NewMockFileIO()
+
+	store, err := NewTokenStore(mockFS, configs.DriveConfig{TokenStore: configs.TokenStoreConfig{Dir: "tokens"}}, "work")
+	if err != nil {
+		t.Fatalf("NewTokenStore failed: %v", err)
+	}
+	if path := store.(*FileTokenStore).path; path != "tokens/work.json" {
+		t.Errorf("path = %s, want tokens/work.json", path)
+	}
+
+	store, err = NewTokenStore(mockFS, configs.DriveConfig{TokenStore: configs.TokenStoreConfig{Type: TokenStoreEnv}}, "team-b")
+	if err != nil {
+		t.Fatalf("NewTokenStore failed: %v", err)
+	}
+	if name := store.(*EnvTokenStore).name; name != DefaultTokenEnv+"_TEAM_B" {
+		t.Errorf("env = %s, want %s_TEAM_B", name, DefaultTokenEnv)
+	}
+
+	if _, err := NewTokenStore(mockFS, configs.DriveConfig{TokenStore: configs.TokenStoreConfig{Type: TokenStoreConfig}}, "work"); err == nil {
+		t.Error("Expected error for named account in config store, got nil")
+	}
+	for _, name := range []string{"../etc", "a/b", ".hidden", "with space"} {
+		if _, err := NewTokenStore(mockFS, configs.DriveConfig{}, name); err == nil {
+			t.Errorf("Expected error for account name %q, got nil", name)
+		}
+	}
+}
+
+func TestAccountsAddListRemove(t *testing.T) {
+	oldDrive := configs.Config.Drive
+	defer func() { configs.Config.Drive = oldDrive }()
+	configs.Config.Drive = configs.DriveConfig{}
+
+	mockFS := NewMockFileIO()
+	manager := NewAuthManager(mockFS)
+
+	accounts, err := manager.Accounts()
+	if err != nil || len(accounts) != 0 {
+		t.Fatalf("Accounts() = %v, %v; want empty", accounts, err)
+	}
+
+	// Token saves stand in for the browser login, which is covered by TestLoginLoopback
+	for _, name := range []string{DefaultAccount, "work", "personal"} {
+		if err := manager.saveToken(name, &oauth2.Token{RefreshToken: name + "-token"}); err != nil {
+			t.Fatalf("saveToken(%s) failed: %v", name, err)
+		}
+	}
+	if err := manager.writeAccountIndex([]string{"work", "personal"}); err != nil {
+		t.Fatalf("writeAccountIndex failed: %v", err)
+	}
+
+	accounts, err = manager.Accounts()
+	if err != nil {
+		t.Fatalf("Accounts failed: %v", err)
+	}
+	if want := []string{DefaultAccount, "personal", "work"}; !reflect.DeepEqual(accounts, want) {
+		t.Errorf("Accounts() = %v, want %v", accounts, want)
+	}
+	if saved := savedToken(t, mockFS, "config/tokens/work.json"); saved.RefreshToken != "work-token" {
+		t.Errorf("work token = %s, want work-token", saved.RefreshToken)
+	}
+
+	if err := manager.RemoveAccount("work"); err != nil {
+		t.Fatalf("RemoveAccount failed: %v", err)
+	}
+	if _, ok := mockFS.Files["config/tokens/work.json"]; ok {
+		t.Error("Token file of removed account still exists")
+	}
+	accounts, _ = manager.Accounts()
+	if want := []string{DefaultAccount, "personal"}; !reflect.DeepEqual(accounts, want) {
+		t.Errorf("Accounts() after remove = %v, want %v", accounts, want)
+	}
+}
+
+func TestAddAccountHeadless(t *testing.T) {
+	oldDrive := configs.Config.Drive
+	defer func() { configs.Config.Drive = oldDrive }()
+	configs.Config.Drive = configs.DriveConfig{}
+
+	var challenge string
+	tokenServer := newFakeTokenServer(t, &challenge)
+
+	mockFS := NewMockFileIO()
+	manager := NewAuthManager(mockFS)
+	manager.endpoint = oauth2.Endpoint{AuthURL: "https://accounts.example.com/auth", TokenURL: tokenServer.URL}
+	var out bytes.Buffer
+	manager.out = &out
+	manager.in = &lazyReader{build: func() string {
+		for _, line := range strings.Split(out.String(), "\n") {
+			if strings.HasPrefix(line, "https://accounts.example.com/auth") {
+				u, _ := url.Parse(line)
+				challenge = u.Query().Get("code_challenge")
+				return headlessRedirectURL + "?code=auth-code&state=" + url.QueryEscape(u.Query().Get("state")) + "\n"
+			}
+		}
+		t.Fatal("Consent URL was not printed")
+		return ""
+	}}
+
+	if err := manager.AddAccount(context.Background(), "work", true); err != nil {
+		t.Fatalf("AddAccount failed: %v", err)
+	}
+	if saved := savedToken(t, mockFS, "config/tokens/work.json"); saved.RefreshToken != "new-refresh-token" {
+		t.Errorf("Saved refresh token = %s, want new-refresh-token", saved.RefreshToken)
+	}
+	if _, ok := mockFS.Files["config/refresh_token.txt"]; ok {
+		t.Error("Named account overwrote the default token")
+	}
+	if names, _ := manager.readAccountIndex(); !reflect.DeepEqual(names, []string{"work"}) {
+		t.Errorf("account index = %v, want [work]", names)
+	}
+
+	if err := manager.AddAccount(context.Background(), "../work", true); err == nil {
+		t.Error("Expected error for invalid account name, got nil")
+	}
+}
+
+func TestAccountEmail(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/about" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"user":{"emailAddress":"work@example.com"}}`))
+	}))
+	defer server.Close()
+
+	srv, err := drive.NewService(context.Background(), option.WithEndpoint(server.URL), option.WithoutAuthentication())
+	if err != nil {
+		t.Fatalf("drive.NewService failed: %v", err)
+	}
+	manager := NewAuthManager(NewMockFileIO())
+	manager.services["work"] = srv
+
+	email, err := manager.AccountEmail("work")
+	if err != nil {
+		t.Fatalf("AccountEmail failed: %v", err)
+	}
+	if email != "work@example.com" {
+		t.Errorf("AccountEmail = %s, want work@example.com", email)
+	}
+}
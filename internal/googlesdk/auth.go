@@ -3,13 +3,19 @@ package googlesdk
 import (
 	"context"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
 	"os"
+	"path/filepath"
+	"sync"
 
 	"github.com/vincent119/s3syncgoogledrive/internal/configs"
+	"github.com/vincent119/s3syncgoogledrive/internal/pkg/errs"
+	"github.com/vincent119/s3syncgoogledrive/internal/pkg/logging"
 
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
+	"golang.org/x/oauth2/jwt"
 	drive "google.golang.org/api/drive/v3"
 	"google.golang.org/api/option"
 )
@@ -18,6 +24,7 @@ import (
 type FileIO interface {
 	ReadFile(name string) ([]byte, error)
 	WriteFile(name string, data []byte, perm os.FileMode) error
+	Remove(name string) error
 }
 
 // RealFileIO implements FileIO using os package
@@ -27,18 +34,51 @@ func (r *RealFileIO) ReadFile(name string) ([]byte, error) {
 	return os.ReadFile(name)
 }
 
+// WriteFile writes data and applies perm even when the file already exists.
+// Missing parent directories are created with owner-only access.
 func (r *RealFileIO) WriteFile(name string, data []byte, perm os.FileMode) error {
-	return os.WriteFile(name, data, perm)
+	if err := os.MkdirAll(filepath.Dir(name), 0700); err != nil {
+		return err
+	}
+	if err := os.WriteFile(name, data, perm); err != nil {
+		return err
+	}
+	return os.Chmod(name, perm)
+}
+
+func (r *RealFileIO) Remove(name string) error {
+	return os.Remove(name)
 }
 
 // AuthManager handles Google authentication
 type AuthManager struct {
-	fs FileIO
+	// Logger receives structured logs (defaults to slog.Default())
+	Logger *slog.Logger
+
+	fs       FileIO
+	endpoint oauth2.Endpoint
+
+	mu       sync.Mutex
+	stores   map[string]TokenStore
+	services map[string]*drive.Service
+
+	// browser opens the consent URL; in and out are used for prompts
+	browser func(url string) error
+	in      io.Reader
+	out     io.Writer
 }
 
 // NewAuthManager creates a new AuthManager
 func NewAuthManager(fs FileIO) *AuthManager {
-	return &AuthManager{fs: fs}
+	return &AuthManager{
+		fs:       fs,
+		endpoint: google.Endpoint,
+		stores:   make(map[string]TokenStore),
+		services: make(map[string]*drive.Service),
+		browser:  openBrowser,
+		in:       os.Stdin,
+		out:      os.Stdout,
+	}
 }
 
 // NewDefaultAuthManager creates an AuthManager with RealFileIO
@@ -46,110 +86,170 @@ func NewDefaultAuthManager() *AuthManager {
 	return NewAuthManager(&RealFileIO{})
 }
 
-func (a *AuthManager) GoogleConnect() {
-	ctx := context.Background()
+func (a *AuthManager) logger() *slog.Logger {
+	return logging.OrDefault(a.Logger)
+}
+
+// GoogleConnect runs the interactive loopback login and saves the refresh token
+func (a *AuthManager) GoogleConnect() error {
+	return a.Login(context.Background(), false)
+}
 
-	conf := &oauth2.Config{
+// oauthConfig builds the OAuth client config for the Drive scope
+func (a *AuthManager) oauthConfig(redirectURL string) *oauth2.Config {
+	return &oauth2.Config{
 		ClientID:     configs.Config.Drive.ClientID,
 		ClientSecret: configs.Config.Drive.ClientSecret,
-		Endpoint:     google.Endpoint,
-		Scopes:       []string{"https://www.googleapis.com/auth/drive"},
-		RedirectURL:  "urn:ietf:wg:oauth:2.0:oob",
+		Endpoint:     a.endpoint,
+		Scopes:       []string{drive.DriveScope},
+		RedirectURL:  redirectURL,
 	}
+}
 
-	authURL := conf.AuthCodeURL("state-token", oauth2.AccessTypeOffline)
-	fmt.Println("Visit the following URL, authorize the app, and paste the authorization code below:")
-	fmt.Println(authURL)
-
-	var code string
-	fmt.Print("Enter the authorization code: ")
-	fmt.Scan(&code)
-
-	token, err := conf.Exchange(ctx, code)
+// tokenStore returns the token store of an account, built from Drive.tokenStore on first use
+func (a *AuthManager) tokenStore(account string) (TokenStore, error) {
+	account = normalizeAccount(account)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if store, ok := a.stores[account]; ok {
+		return store, nil
+	}
+	store, err := NewTokenStore(a.fs, configs.Config.Drive, account)
 	if err != nil {
-		log.Fatalf("Token exchange failed: %v", err)
+		return nil, err
 	}
+	a.stores[account] = store
+	return store, nil
+}
 
-	fmt.Println("Access Token:", token.AccessToken)
-	fmt.Println("Refresh Token (save this):", token.RefreshToken)
-
-	a.saveRefreshToken(token.RefreshToken)
+// saveToken persists the full token, including access token and expiry
+func (a *AuthManager) saveToken(account string, token *oauth2.Token) error {
+	store, err := a.tokenStore(account)
+	if err != nil {
+		return err
+	}
+	if err := store.Save(token); err != nil {
+		return fmt.Errorf("failed to save token: %w", err)
+	}
+	a.logger().Info("Google token saved", "account", normalizeAccount(account))
+	return nil
 }
 
-func (a *AuthManager) saveRefreshToken(refreshToken string) {
-	err := a.fs.WriteFile("config/refresh_token.txt", []byte(refreshToken), 0644)
+// oauthTokenSource loads the stored token and persists every refreshed token
+func (a *AuthManager) oauthTokenSource(ctx context.Context, account string) (oauth2.TokenSource, error) {
+	store, err := a.tokenStore(account)
 	if err != nil {
-		log.Println("Failed to save refresh token:", err)
-	} else {
-		log.Println("Refresh token saved to refresh_token.txt")
+		return nil, err
 	}
+	token, err := store.Load()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load token for account %s: %w", normalizeAccount(account), err)
+	}
+	base := a.oauthConfig("").TokenSource(ctx, token)
+	persisting := newPersistingTokenSource(base, store, token)
+	persisting.logger = a.logger()
+	return oauth2.ReuseTokenSource(nil, persisting), nil
 }
 
-func (a *AuthManager) GetAccessTokenFromRefresh() string {
+// GetAccessTokenFromRefresh returns a fresh access token for Drive.account
+func (a *AuthManager) GetAccessTokenFromRefresh() (string, error) {
 	ctx := context.Background()
 
-	// 讀取 refresh_token
-	refreshTokenBytes, err := a.fs.ReadFile("config/refresh_token.txt")
+	tokenSource, err := a.oauthTokenSource(ctx, configs.Config.Drive.Account)
 	if err != nil {
-		log.Fatalf("Failed to read refresh_token.txt: %v", err)
-	}
-	refreshToken := string(refreshTokenBytes)
-
-	conf := &oauth2.Config{
-		ClientID:     configs.Config.Drive.ClientID,
-		ClientSecret: configs.Config.Drive.ClientSecret,
-		Endpoint:     google.Endpoint,
-		Scopes:       []string{"https://www.googleapis.com/auth/drive"},
+		return "", errs.Wrap(errs.ErrAuth, "load Google token", err)
 	}
 
-	// 用 refresh_token 換 access_token
-	token := &oauth2.Token{RefreshToken: refreshToken}
-	tokenSource := conf.TokenSource(ctx, token)
-
 	newToken, err := tokenSource.Token()
 	if err != nil {
-		log.Fatalf("Failed to get access token from refresh token: %v", err)
+		return "", errs.Wrap(errs.ErrAuth, "refresh Google access token", err)
 	}
 
-	fmt.Println("New Access Token:", newToken.AccessToken)
-	return newToken.AccessToken
+	a.logger().Debug("Google access token refreshed", "account", normalizeAccount(configs.Config.Drive.Account))
+	return newToken.AccessToken, nil
 }
 
-func (a *AuthManager) GetDriveService() *drive.Service {
+// GetDriveService returns the Drive service of Drive.account
+func (a *AuthManager) GetDriveService() (*drive.Service, error) {
+	return a.DriveServiceFor(configs.Config.Drive.Account)
+}
+
+// DriveServiceFor returns the Drive service of a named account, creating it on first use
+func (a *AuthManager) DriveServiceFor(account string) (*drive.Service, error) {
+	account = normalizeAccount(account)
+	a.mu.Lock()
+	srv, ok := a.services[account]
+	a.mu.Unlock()
+	if ok {
+		return srv, nil
+	}
+
 	ctx := context.Background()
+	var tokenSource oauth2.TokenSource
+	var err error
+	switch configs.Config.Drive.AuthMode {
+	case configs.DriveAuthModeServiceAccount:
+		if account != DefaultAccount {
+			return nil, fmt.Errorf("named accounts are not supported in %s mode", configs.DriveAuthModeServiceAccount)
+		}
+		tokenSource, err = a.serviceAccountTokenSource(ctx)
+	case "", configs.DriveAuthModeOAuth:
+		tokenSource, err = a.oauthTokenSource(ctx, account)
+	default:
+		err = fmt.Errorf("unknown Drive auth mode: %s", configs.Config.Drive.AuthMode)
+	}
+	if err != nil {
+		return nil, errs.Wrap(errs.ErrAuth, "load Google credentials for account "+account, err)
+	}
 
-	refreshToken, err := a.fs.ReadFile("config/refresh_token.txt")
+	srv, err = drive.NewService(ctx, option.WithTokenSource(tokenSource))
 	if err != nil {
-		log.Fatalf("Failed to read refresh_token.txt: %v", err)
+		return nil, err
 	}
+	a.mu.Lock()
+	a.services[account] = srv
+	a.mu.Unlock()
+	return srv, nil
+}
 
-	conf := &oauth2.Config{
-		ClientID:     configs.Config.Drive.ClientID,
-		ClientSecret: configs.Config.Drive.ClientSecret,
-		Endpoint:     google.Endpoint,
-		Scopes:       []string{"https://www.googleapis.com/auth/drive"},
+// serviceAccountJWTConfig loads the service account key, impersonating
+// Drive.impersonateUser through domain-wide delegation when set
+func (a *AuthManager) serviceAccountJWTConfig() (*jwt.Config, error) {
+	keyFile := configs.Config.Drive.ServiceAccountKeyFile
+	if keyFile == "" {
+		return nil, fmt.Errorf("Drive.serviceAccountKeyFile is required in %s mode", configs.DriveAuthModeServiceAccount)
+	}
+	key, err := a.fs.ReadFile(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read service account key %s: %w", keyFile, err)
 	}
 
-	token := &oauth2.Token{RefreshToken: string(refreshToken)}
-	tokenSource := conf.TokenSource(ctx, token)
+	conf, err := google.JWTConfigFromJSON(key, drive.DriveScope)
+	if err != nil {
+		return nil, fmt.Errorf("invalid service account key %s: %w", keyFile, err)
+	}
+	conf.Subject = configs.Config.Drive.ImpersonateUser
+	return conf, nil
+}
 
-	srv, err := drive.NewService(ctx, option.WithTokenSource(tokenSource))
+func (a *AuthManager) serviceAccountTokenSource(ctx context.Context) (oauth2.TokenSource, error) {
+	conf, err := a.serviceAccountJWTConfig()
 	if err != nil {
-		log.Fatalf("Failed to create Drive service: %v", err)
+		return nil, err
 	}
-	return srv
+	return conf.TokenSource(ctx), nil
 }
 
 // Global Wrappers for backward compatibility
-func GoogleConnect() {
-	NewDefaultAuthManager().GoogleConnect()
+func GoogleConnect() error {
+	return NewDefaultAuthManager().GoogleConnect()
 }
 
-func GetAccessTokenFromRefresh() string {
+func GetAccessTokenFromRefresh() (string, error) {
 	return NewDefaultAuthManager().GetAccessTokenFromRefresh()
 }
 
-func GetDriveService() *drive.Service {
+func GetDriveService() (*drive.Service, error) {
 	return NewDefaultAuthManager().GetDriveService()
 }
 
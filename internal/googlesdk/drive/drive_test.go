@@ -3,15 +3,28 @@ package drive
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"mime"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/vincent119/s3syncgoogledrive/internal/configs"
+	"github.com/vincent119/s3syncgoogledrive/internal/pkg/errs"
+	"github.com/vincent119/s3syncgoogledrive/internal/pkg/metrics"
+	"github.com/vincent119/s3syncgoogledrive/internal/pkg/tracing"
 
 	"github.com/vbauerster/mpb/v8"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 	drive "google.golang.org/api/drive/v3"
+	"google.golang.org/api/googleapi"
 	"google.golang.org/api/option"
 )
 
@@ -54,14 +67,24 @@ func TestFindOrCreateFolder_Create(t *testing.T) {
 	defer server.Close()
 
 	d := NewDriveManager(srv)
+	d.Metrics = metrics.NewSync()
 	// We need to unlock global mutex after test if it locks?
 	// The FindOrCreateFolder uses globalFolderMutex.
 	// Since tests run sequentially usually, it might be fine, but parallel tests could block.
 
-	id := d.FindOrCreateFolder("test-folder", "root")
+	id, err := d.FindOrCreateFolder(context.Background(), "test-folder", "root")
+	if err != nil {
+		t.Fatalf("FindOrCreateFolder failed: %v", err)
+	}
 	if id != "new-folder-id" {
 		t.Errorf("FindOrCreateFolder = %s, want new-folder-id", id)
 	}
+	// Looking up a folder that does not exist yet is not a retry
+	var buf strings.Builder
+	d.Metrics.Registry.WriteText(&buf)
+	if strings.Contains(buf.String(), `s3sync_retries_total{operation="files.list"}`) {
+		t.Errorf("Retry counted for a folder that was not found:\n%s", buf.String())
+	}
 }
 
 func TestFindOrCreateFolder_Found(t *testing.T) {
@@ -85,12 +108,40 @@ func TestFindOrCreateFolder_Found(t *testing.T) {
 
 	d := NewDriveManager(srv)
 
-	id := d.FindOrCreateFolder("test-folder", "root")
+	id, err := d.FindOrCreateFolder(context.Background(), "test-folder", "root")
+	if err != nil {
+		t.Fatalf("FindOrCreateFolder failed: %v", err)
+	}
 	if id != "existing-folder-id" {
 		t.Errorf("FindOrCreateFolder = %s, want existing-folder-id", id)
 	}
 }
 
+func TestFindOrCreateFolderCancelled(t *testing.T) {
+	// Scenario: the folder is not listed yet and the run is cancelled during the backoff
+	ctx, cancel := context.WithCancel(context.Background())
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			t.Errorf("Unexpected %s request after cancel", r.Method)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"files": []interface{}{}})
+		cancel()
+	}
+	srv, server := newMockDriveService(t, handler)
+	defer server.Close()
+
+	d := NewDriveManager(srv)
+	start := time.Now()
+	_, err := d.FindOrCreateFolder(ctx, "test-folder", "root")
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("FindOrCreateFolder() = %v, want context.Canceled", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("FindOrCreateFolder() took %s, want it to stop waiting when cancelled", elapsed)
+	}
+}
+
 func TestFileETagExistsInDrive_True(t *testing.T) {
 	handler := func(w http.ResponseWriter, r *http.Request) {
 		// Expect query to contain appProperties
@@ -110,7 +161,7 @@ func TestFileETagExistsInDrive_True(t *testing.T) {
 	defer server.Close()
 
 	d := NewDriveManager(srv)
-	exists := d.FileETagExistsInDrive("test-etag", "parent-id")
+	exists := d.FileETagExistsInDrive(context.Background(), "test-etag", "parent-id")
 	if !exists {
 		t.Errorf("FileETagExistsInDrive = false, want true")
 	}
@@ -128,12 +179,39 @@ func TestFileETagExistsInDrive_False(t *testing.T) {
 	defer server.Close()
 
 	d := NewDriveManager(srv)
-	exists := d.FileETagExistsInDrive("test-etag", "parent-id")
+	exists := d.FileETagExistsInDrive(context.Background(), "test-etag", "parent-id")
 	if exists {
 		t.Errorf("FileETagExistsInDrive = true, want false")
 	}
 }
 
+func TestFindFileServerError(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"error": map[string]interface{}{"code": http.StatusInternalServerError, "message": "backend error"},
+		})
+	}
+	srv, server := newMockDriveService(t, handler)
+	defer server.Close()
+	d := NewDriveManager(srv)
+
+	// sync must see the error instead of a file to skip
+	file, err := d.FindFileByETag(context.Background(), "test-etag", "parent-id")
+	if err == nil || file != nil {
+		t.Errorf("FindFileByETag = %v, %v; want an error", file, err)
+	}
+	file, err = d.FindFileByVersion(context.Background(), "v1", "parent-id")
+	if err == nil || file != nil {
+		t.Errorf("FindFileByVersion = %v, %v; want an error", file, err)
+	}
+	var apiErr *googleapi.Error
+	if !errors.As(err, &apiErr) || apiErr.Code != http.StatusInternalServerError {
+		t.Errorf("FindFileByVersion error does not wrap the API error: %v", err)
+	}
+}
+
 func TestSyncS3PathToDrive(t *testing.T) {
 	// Scenario: Path "folderA/folderB"
 	// 1. List folderA under root -> Not Found -> Create folderA (id: id_A)
@@ -184,7 +262,10 @@ func TestSyncS3PathToDrive(t *testing.T) {
 	// Mock global mutex? It is fine, tests in parallel might fail but we run sequential here mostly.
 	// Actually we should mock it or ensure it doesn't block. It is a real mutex/map.
 
-	id := d.SyncS3PathToDrive("folderA/folderB/file.txt", "root")
+	id, err := d.SyncS3PathToDrive(context.Background(), "folderA/folderB/file.txt", "root")
+	if err != nil {
+		t.Fatalf("SyncS3PathToDrive failed: %v", err)
+	}
 	if id != "id_B" {
 		t.Errorf("SyncS3PathToDrive = %s, want id_B", id)
 	}
@@ -222,7 +303,7 @@ func TestStreamUploadWithProgress(t *testing.T) {
 
 			// Just return success
 			json.NewEncoder(w).Encode(map[string]interface{}{
-				"id": "new-file-id",
+				"id":   "new-file-id",
 				"name": "file.txt",
 			})
 			return
@@ -245,9 +326,573 @@ func TestStreamUploadWithProgress(t *testing.T) {
 	p := mpb.New(mpb.WithOutput(io.Discard))
 	bar := p.AddBar(int64(len(fileContent)))
 
-	err := d.StreamUploadWithProgress(fileServer.URL, "folder/file.txt", "root", "etag123", bar)
+	err := d.StreamUploadWithProgress(context.Background(), fileServer.URL, "folder/file.txt", "root", "etag123", bar)
 	if err != nil {
 		t.Fatalf("StreamUploadWithProgress failed: %v", err)
 	}
 }
 
+func TestStreamUploadRecordsMetrics(t *testing.T) {
+	fileServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("Hello World"))
+	}))
+	defer fileServer.Close()
+
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method == "GET" {
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"files": []map[string]interface{}{{"id": "folder_id"}},
+			})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"id": "new-file-id"})
+	}
+	srv, server := newMockDriveService(t, handler)
+	defer server.Close()
+
+	d := NewDriveManager(srv)
+	d.Metrics = metrics.NewSync()
+	p := mpb.New(mpb.WithOutput(io.Discard))
+	if err := d.StreamUploadWithProgress(context.Background(), fileServer.URL, "folder/file.txt", "root", "etag123", p.AddBar(11)); err != nil {
+		t.Fatalf("StreamUploadWithProgress failed: %v", err)
+	}
+
+	var buf strings.Builder
+	d.Metrics.Registry.WriteText(&buf)
+	for _, line := range []string{
+		`s3sync_drive_api_calls_total{method="files.list",status="200"} 1`,
+		`s3sync_drive_api_calls_total{method="files.create",status="200"} 1`,
+		`s3sync_s3_api_calls_total{operation="GetObject",status="200"} 1`,
+		`s3sync_transfers_in_flight 0`,
+		`s3sync_upload_duration_seconds_count 1`,
+	} {
+		if !strings.Contains(buf.String(), line+"\n") {
+			t.Errorf("Missing %q in:\n%s", line, buf.String())
+		}
+	}
+}
+
+func TestStreamUploadReturnsFile(t *testing.T) {
+	fileServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("Hello World"))
+	}))
+	defer fileServer.Close()
+
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method == "GET" {
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"files": []map[string]interface{}{{"id": "folder_id"}},
+			})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"id": "new-file-id", "name": "file.txt"})
+	}
+	srv, server := newMockDriveService(t, handler)
+	defer server.Close()
+
+	d := NewDriveManager(srv)
+	p := mpb.New(mpb.WithOutput(io.Discard))
+	file, err := d.StreamUpload(context.Background(), fileServer.URL, "folder/file.txt", "root", "etag123", UploadOptions{}, p.AddBar(11))
+	if err != nil {
+		t.Fatalf("StreamUpload failed: %v", err)
+	}
+	if file == nil || file.Id != "new-file-id" {
+		t.Errorf("StreamUpload = %+v, want new-file-id", file)
+	}
+}
+
+func TestStreamUploadAlreadyUploading(t *testing.T) {
+	uploading.Store("dup/file.txt", true)
+	defer uploading.Delete("dup/file.txt")
+
+	d := NewDriveManager(nil)
+	p := mpb.New(mpb.WithOutput(io.Discard))
+	file, err := d.StreamUpload(context.Background(), "http://unused", "dup/file.txt", "root", "etag123", UploadOptions{}, p.AddBar(11))
+	if !errors.Is(err, ErrAlreadyUploading) || file != nil {
+		t.Errorf("StreamUpload = %v, %v; want ErrAlreadyUploading", file, err)
+	}
+	// The older call keeps reporting no error
+	if err := d.StreamUploadWithOptions(context.Background(), "http://unused", "dup/file.txt", "root", "etag123", UploadOptions{}, p.AddBar(11)); err != nil {
+		t.Errorf("StreamUploadWithOptions error = %v, want nil", err)
+	}
+}
+
+func TestStreamUploadRecordsSpans(t *testing.T) {
+	rec := tracetest.NewSpanRecorder()
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)))
+	defer otel.SetTracerProvider(prev)
+
+	fileServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("Hello World"))
+	}))
+	defer fileServer.Close()
+
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method == "GET" {
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"files": []map[string]interface{}{{"id": "folder_id"}},
+			})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"id": "new-file-id"})
+	}
+	srv, server := newMockDriveService(t, handler)
+	defer server.Close()
+
+	ctx, parent := tracing.Start(context.Background(), "upload")
+	d := NewDriveManager(srv)
+	p := mpb.New(mpb.WithOutput(io.Discard))
+	if err := d.StreamUploadWithProgress(ctx, fileServer.URL, "folder/file.txt", "root", "etag123", p.AddBar(11)); err != nil {
+		t.Fatalf("StreamUploadWithProgress failed: %v", err)
+	}
+	parent.End()
+
+	spans := make(map[string]sdktrace.ReadOnlySpan)
+	for _, span := range rec.Ended() {
+		if span.Parent().SpanID() == parent.SpanContext().SpanID() {
+			spans[span.Name()] = span
+		}
+	}
+	want := map[string]map[string]string{
+		"drive.files.list":   {"attempt": "1", "http.response.status_code": "200"},
+		"s3.GetObject":       {"s3.key": "folder/file.txt", "file.size": "11", "http.response.status_code": "200"},
+		"drive.files.create": {"s3.key": "folder/file.txt", "file.size": "11", "http.response.status_code": "200"},
+	}
+	for name, attrs := range want {
+		span, ok := spans[name]
+		if !ok {
+			t.Errorf("No %s span under the caller's span", name)
+			continue
+		}
+		got := make(map[string]string)
+		for _, kv := range span.Attributes() {
+			got[string(kv.Key)] = kv.Value.Emit()
+		}
+		for key, value := range attrs {
+			if got[key] != value {
+				t.Errorf("%s %s = %q, want %q", name, key, got[key], value)
+			}
+		}
+	}
+}
+
+func TestStreamUploadWithProgress_DownloadError(t *testing.T) {
+	fileServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "SignatureDoesNotMatch", http.StatusForbidden)
+	}))
+	defer fileServer.Close()
+
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method == "GET" {
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"files": []map[string]interface{}{
+					{"id": "folder_id", "name": "folder"},
+				},
+			})
+			return
+		}
+		t.Errorf("Upload should not be attempted after a failed download: %s %s", r.Method, r.URL.Path)
+		http.Error(w, "Unexpected request", http.StatusBadRequest)
+	}
+
+	srv, server := newMockDriveService(t, handler)
+	defer server.Close()
+
+	d := NewDriveManager(srv)
+	p := mpb.New(mpb.WithOutput(io.Discard))
+	bar := p.AddBar(10)
+
+	err := d.StreamUploadWithProgress(context.Background(), fileServer.URL, "folder/denied.txt", "root", "etag123", bar)
+	if err == nil {
+		t.Fatal("Expected error for non-200 download, got nil")
+	}
+}
+
+func TestFileVersionExistsInDrive(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if !strings.Contains(r.URL.Query().Get("q"), "appProperties has { key='s3versionid' and value='v1' }") {
+			t.Errorf("Query missing version check: %s", r.URL.Query().Get("q"))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"files": []map[string]interface{}{
+				{"id": "file-id", "name": "file.v1.txt"},
+			},
+		})
+	}
+
+	srv, server := newMockDriveService(t, handler)
+	defer server.Close()
+
+	d := NewDriveManager(srv)
+	if !d.FileVersionExistsInDrive(context.Background(), "v1", "parent-id") {
+		t.Errorf("FileVersionExistsInDrive = false, want true")
+	}
+}
+
+func TestStreamUploadWithOptions_Version(t *testing.T) {
+	fileServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("v1 content"))
+	}))
+	defer fileServer.Close()
+
+	var uploadBody string
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method == "GET" {
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"files": []map[string]interface{}{
+					{"id": "folder_id", "name": "folder"},
+				},
+			})
+			return
+		}
+		if r.Method == "POST" && strings.Contains(r.URL.Path, "/upload/") {
+			body, _ := io.ReadAll(r.Body)
+			uploadBody = string(body)
+			json.NewEncoder(w).Encode(map[string]interface{}{"id": "new-file-id"})
+			return
+		}
+		http.Error(w, "Unexpected request", http.StatusBadRequest)
+	}
+
+	srv, server := newMockDriveService(t, handler)
+	defer server.Close()
+
+	d := NewDriveManager(srv)
+	p := mpb.New(mpb.WithOutput(io.Discard))
+	bar := p.AddBar(10)
+
+	opts := UploadOptions{FileName: "file.v1.txt", VersionID: "v1"}
+	if err := d.StreamUploadWithOptions(context.Background(), fileServer.URL, "folder/file.txt", "root", "etag123", opts, bar); err != nil {
+		t.Fatalf("StreamUploadWithOptions failed: %v", err)
+	}
+	if !strings.Contains(uploadBody, `"s3versionid":"v1"`) {
+		t.Errorf("Upload metadata missing s3versionid: %s", uploadBody)
+	}
+	if !strings.Contains(uploadBody, `"name":"file.v1.txt"`) {
+		t.Errorf("Upload metadata missing versioned name: %s", uploadBody)
+	}
+}
+
+func TestStreamUploadWithOptions_S3Metadata(t *testing.T) {
+	fileServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("X-Amz-Meta-Project", "apollo")
+		w.Write([]byte("a,b\n1,2\n"))
+	}))
+	defer fileServer.Close()
+
+	var uploaded map[string]interface{}
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method == "GET" {
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"files": []map[string]interface{}{
+					{"id": "folder_id", "name": "folder"},
+				},
+			})
+			return
+		}
+		if r.Method == "POST" && strings.Contains(r.URL.Path, "/upload/") {
+			_, params, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+			part, err := multipart.NewReader(r.Body, params["boundary"]).NextPart()
+			if err != nil {
+				t.Errorf("Failed to read metadata part: %v", err)
+			} else {
+				json.NewDecoder(part).Decode(&uploaded)
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"id": "new-file-id"})
+			return
+		}
+		http.Error(w, "Unexpected request", http.StatusBadRequest)
+	}
+
+	srv, server := newMockDriveService(t, handler)
+	defer server.Close()
+
+	d := NewDriveManager(srv)
+	d.Metadata = configs.MetadataConfig{
+		PreserveModifiedTime: true,
+		UseContentType:       true,
+		Rules: []configs.MetadataRule{
+			{Source: "meta:project", Property: "project"},
+			{Source: "tag:owner", Property: "owner"},
+		},
+		Description: "Owned by {{.Tags.owner}}",
+	}
+	p := mpb.New(mpb.WithOutput(io.Discard))
+	bar := p.AddBar(8)
+
+	opts := UploadOptions{
+		ModifiedTime: time.Date(2023, 6, 1, 12, 0, 0, 0, time.FixedZone("UTC+8", 8*3600)),
+		Tags:         map[string]string{"owner": "finance"},
+	}
+	if err := d.StreamUploadWithOptions(context.Background(), fileServer.URL, "folder/data.csv", "root", "etag123", opts, bar); err != nil {
+		t.Fatalf("StreamUploadWithOptions failed: %v", err)
+	}
+
+	if uploaded["modifiedTime"] != "2023-06-01T04:00:00Z" {
+		t.Errorf("modifiedTime = %v, want 2023-06-01T04:00:00Z", uploaded["modifiedTime"])
+	}
+	if uploaded["mimeType"] != "text/csv" {
+		t.Errorf("mimeType = %v, want text/csv", uploaded["mimeType"])
+	}
+	if uploaded["description"] != "Owned by finance" {
+		t.Errorf("description = %v, want 'Owned by finance'", uploaded["description"])
+	}
+	props, _ := uploaded["properties"].(map[string]interface{})
+	if props["project"] != "apollo" || props["owner"] != "finance" {
+		t.Errorf("properties = %v, want project=apollo owner=finance", props)
+	}
+}
+
+func TestSharedDriveQueries(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		q := r.URL.Query()
+		if q.Get("supportsAllDrives") != "true" {
+			t.Errorf("%s %s missing supportsAllDrives", r.Method, r.URL.Path)
+		}
+		if r.Method == "GET" {
+			if q.Get("includeItemsFromAllDrives") != "true" || q.Get("corpora") != "drive" || q.Get("driveId") != "shared-1" {
+				t.Errorf("List not scoped to shared drive: %s", r.URL.RawQuery)
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"files": []interface{}{}})
+			return
+		}
+		if r.Method == "POST" {
+			json.NewEncoder(w).Encode(map[string]interface{}{"id": "new-folder-id"})
+			return
+		}
+		http.Error(w, "Unexpected request", http.StatusBadRequest)
+	}
+
+	srv, server := newMockDriveService(t, handler)
+	defer server.Close()
+
+	d := NewDriveManager(srv)
+	d.DriveID = "shared-1"
+
+	if d.FileETagExistsInDrive(context.Background(), "etag", "shared-1") {
+		t.Error("FileETagExistsInDrive = true, want false")
+	}
+	if id, err := d.CreateFolder(context.Background(), "folder", "shared-1"); err != nil || id != "new-folder-id" {
+		t.Errorf("CreateFolder = %s, %v, want new-folder-id", id, err)
+	}
+}
+
+func TestResolveSharedDrive(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/drives/0AbCdEf"):
+			json.NewEncoder(w).Encode(map[string]interface{}{"id": "0AbCdEf", "name": "Finance"})
+		case strings.HasSuffix(r.URL.Path, "/drives/Finance"):
+			http.Error(w, `{"error":{"code":404,"message":"not found"}}`, http.StatusNotFound)
+		case strings.HasSuffix(r.URL.Path, "/drives"):
+			if r.URL.Query().Get("q") != "name = 'Finance'" {
+				t.Errorf("Unexpected drives query: %s", r.URL.Query().Get("q"))
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"drives": []map[string]interface{}{{"id": "0AbCdEf", "name": "Finance"}},
+			})
+		default:
+			http.Error(w, `{"error":{"code":404,"message":"not found"}}`, http.StatusNotFound)
+		}
+	}
+
+	srv, server := newMockDriveService(t, handler)
+	defer server.Close()
+
+	d := NewDriveManager(srv)
+	for _, input := range []string{"0AbCdEf", "Finance"} {
+		id, err := d.ResolveSharedDrive(context.Background(), input)
+		if err != nil {
+			t.Fatalf("ResolveSharedDrive(%s) failed: %v", input, err)
+		}
+		if id != "0AbCdEf" {
+			t.Errorf("ResolveSharedDrive(%s) = %s, want 0AbCdEf", input, id)
+		}
+	}
+}
+
+func TestResolveSharedDriveNotFound(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if strings.HasSuffix(r.URL.Path, "/drives") {
+			json.NewEncoder(w).Encode(map[string]interface{}{"drives": []interface{}{}})
+			return
+		}
+		http.Error(w, `{"error":{"code":404,"message":"not found"}}`, http.StatusNotFound)
+	}
+
+	srv, server := newMockDriveService(t, handler)
+	defer server.Close()
+
+	d := NewDriveManager(srv)
+	if _, err := d.ResolveSharedDrive(context.Background(), "Nope"); err == nil {
+		t.Error("Expected error for unknown shared drive, got nil")
+	}
+}
+
+func TestFindFolderPath(t *testing.T) {
+	var created bool
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "POST" {
+			created = true
+		}
+		q := r.URL.Query().Get("q")
+		files := []interface{}{}
+		switch {
+		case strings.Contains(q, "name = 'a'") && strings.Contains(q, "'root' in parents"):
+			files = append(files, map[string]string{"id": "a-id"})
+		case strings.Contains(q, "name = 'b'") && strings.Contains(q, "'a-id' in parents"):
+			files = append(files, map[string]string{"id": "b-id"})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"files": files})
+	}
+	srv, server := newMockDriveService(t, handler)
+	defer server.Close()
+	dm := NewDriveManager(srv)
+
+	id, found, err := dm.FindFolderPath(context.Background(), "a/b/file.txt", "root")
+	if err != nil || !found || id != "b-id" {
+		t.Errorf("FindFolderPath(a/b) = %s, %v, %v; want b-id, true", id, found, err)
+	}
+	if _, found, err := dm.FindFolderPath(context.Background(), "a/missing/file.txt", "root"); err != nil || found {
+		t.Errorf("FindFolderPath(a/missing) found = %v, err = %v; want not found", found, err)
+	}
+	if id, found, _ := dm.FindFolderPath(context.Background(), "file.txt", "root"); !found || id != "root" {
+		t.Errorf("FindFolderPath(file.txt) = %s, %v; want root", id, found)
+	}
+	if created {
+		t.Error("FindFolderPath created a folder")
+	}
+}
+
+func TestFindFileByName(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		files := []interface{}{}
+		if strings.Contains(r.URL.Query().Get("q"), "name = 'report.pdf'") {
+			files = append(files, map[string]interface{}{
+				"id": "file-id", "name": "report.pdf", "appProperties": map[string]string{"s3etag": "old"},
+			})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"files": files})
+	}
+	srv, server := newMockDriveService(t, handler)
+	defer server.Close()
+	dm := NewDriveManager(srv)
+
+	file, err := dm.FindFileByName(context.Background(), "report.pdf", "parent")
+	if err != nil || file == nil || file.AppProperties["s3etag"] != "old" {
+		t.Errorf("FindFileByName = %+v, %v; want file with s3etag old", file, err)
+	}
+	if file, err := dm.FindFileByName(context.Background(), "other.pdf", "parent"); err != nil || file != nil {
+		t.Errorf("FindFileByName(other.pdf) = %+v, %v; want nil", file, err)
+	}
+}
+
+func TestListFolderPaginates(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Query().Get("pageToken") == "" {
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"files":         []map[string]string{{"id": "1", "name": "a"}},
+				"nextPageToken": "next",
+			})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"files": []map[string]string{{"id": "2", "name": "b"}},
+		})
+	}
+	srv, server := newMockDriveService(t, handler)
+	defer server.Close()
+
+	files, err := NewDriveManager(srv).ListFolder(context.Background(), "root")
+	if err != nil {
+		t.Fatalf("ListFolder failed: %v", err)
+	}
+	if len(files) != 2 || files[0].Name != "a" || files[1].Name != "b" {
+		t.Errorf("ListFolder = %+v, want a and b", files)
+	}
+}
+
+func TestCreateFolderErrorKinds(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		reason string
+		want   error
+	}{
+		{"Quota", http.StatusForbidden, "storageQuotaExceeded", errs.ErrQuota},
+		{"RateLimit403", http.StatusForbidden, "userRateLimitExceeded", errs.ErrRateLimit},
+		{"RateLimit429", http.StatusTooManyRequests, "", errs.ErrRateLimit},
+		{"Permission", http.StatusForbidden, "insufficientFilePermissions", errs.ErrPermission},
+		{"Auth", http.StatusUnauthorized, "authError", errs.ErrAuth},
+		{"NotFound", http.StatusNotFound, "notFound", errs.ErrNotFound},
+		{"Unavailable", http.StatusServiceUnavailable, "backendError", errs.ErrUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(tt.status)
+				json.NewEncoder(w).Encode(map[string]interface{}{
+					"error": map[string]interface{}{
+						"code":    tt.status,
+						"message": tt.name,
+						"errors":  []interface{}{map[string]interface{}{"reason": tt.reason}},
+					},
+				})
+			}
+			srv, server := newMockDriveService(t, handler)
+			defer server.Close()
+
+			_, err := NewDriveManager(srv).CreateFolder(context.Background(), "folder", "root")
+			if !errors.Is(err, tt.want) {
+				t.Errorf("CreateFolder error = %v, want kind %v", err, tt.want)
+			}
+			var apiErr *googleapi.Error
+			if !errors.As(err, &apiErr) || apiErr.Code != tt.status {
+				t.Errorf("CreateFolder error does not wrap the API error: %v", err)
+			}
+		})
+	}
+}
+
+func TestStreamUploadFolderError(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method == "GET" {
+			json.NewEncoder(w).Encode(map[string]interface{}{"files": []interface{}{}})
+			return
+		}
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"error": map[string]interface{}{
+				"code":   403,
+				"errors": []interface{}{map[string]interface{}{"reason": "storageQuotaExceeded"}},
+			},
+		})
+	}
+	srv, server := newMockDriveService(t, handler)
+	defer server.Close()
+
+	p := mpb.New(mpb.WithOutput(io.Discard))
+	bar := p.AddBar(1)
+	err := NewDriveManager(srv).StreamUploadWithProgress(context.Background(), "http://unused.invalid/file", "quota/file.txt", "root", "etag", bar)
+	if !errors.Is(err, errs.ErrQuota) {
+		t.Errorf("StreamUploadWithProgress error = %v, want quota error", err)
+	}
+	p.Wait()
+}
@@ -0,0 +1,86 @@
+package drive
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/vincent119/s3syncgoogledrive/internal/pkg/errs"
+	"github.com/vincent119/s3syncgoogledrive/internal/pkg/metrics"
+
+	"golang.org/x/oauth2"
+	"google.golang.org/api/googleapi"
+)
+
+// WrapError annotates a Drive API error with its errs kind
+func WrapError(op string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return errs.Wrap(errorKind(err), op, err)
+}
+
+// errorKind maps Drive API status codes and reasons to errs kinds.
+// Drive reports rate limits and quota as 403 with a reason, so the reason wins over the code.
+func errorKind(err error) error {
+	var retrieveErr *oauth2.RetrieveError
+	if errors.As(err, &retrieveErr) {
+		return errs.ErrAuth
+	}
+	var apiErr *googleapi.Error
+	if !errors.As(err, &apiErr) {
+		return nil
+	}
+	for _, item := range apiErr.Errors {
+		switch item.Reason {
+		case "rateLimitExceeded", "userRateLimitExceeded":
+			return errs.ErrRateLimit
+		case "storageQuotaExceeded", "quotaExceeded", "dailyLimitExceeded", "teamDriveFileLimitExceeded":
+			return errs.ErrQuota
+		case "notFound":
+			return errs.ErrNotFound
+		}
+	}
+	switch {
+	case apiErr.Code == http.StatusUnauthorized:
+		return errs.ErrAuth
+	case apiErr.Code == http.StatusForbidden:
+		return errs.ErrPermission
+	case apiErr.Code == http.StatusNotFound:
+		return errs.ErrNotFound
+	case apiErr.Code == http.StatusTooManyRequests:
+		return errs.ErrRateLimit
+	case apiErr.Code == http.StatusBadRequest:
+		return errs.ErrInvalid
+	case apiErr.Code >= http.StatusInternalServerError:
+		return errs.ErrUnavailable
+	}
+	return nil
+}
+
+// downloadErrorKind maps the status of a presigned S3 download to an errs kind
+func downloadErrorKind(status int) error {
+	switch {
+	case status == http.StatusForbidden:
+		return errs.ErrPermission
+	case status == http.StatusNotFound:
+		return errs.ErrNotFound
+	case status == http.StatusTooManyRequests, status == http.StatusServiceUnavailable:
+		return errs.ErrRateLimit
+	case status >= http.StatusInternalServerError:
+		return errs.ErrUnavailable
+	}
+	return nil
+}
+
+// statusLabel returns the HTTP status of a Drive API call for metrics
+func statusLabel(err error) string {
+	if err == nil {
+		return strconv.Itoa(http.StatusOK)
+	}
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) {
+		return strconv.Itoa(apiErr.Code)
+	}
+	return metrics.StatusError
+}
@@ -0,0 +1,104 @@
+package drive
+
+import (
+	"log/slog"
+	"net/http"
+	"strings"
+	"text/template"
+
+	"github.com/vincent119/s3syncgoogledrive/internal/configs"
+	"github.com/vincent119/s3syncgoogledrive/internal/pkg/logging"
+)
+
+// Drive limits each property to 124 bytes of key plus value
+const maxPropertyBytes = 124
+
+const userMetadataHeaderPrefix = "X-Amz-Meta-"
+
+// userMetadataFromHeader extracts x-amz-meta-* headers from an S3 GET response
+func userMetadataFromHeader(h http.Header) map[string]string {
+	meta := make(map[string]string)
+	for name, values := range h {
+		if len(values) == 0 || !strings.HasPrefix(name, userMetadataHeaderPrefix) {
+			continue
+		}
+		meta[strings.ToLower(strings.TrimPrefix(name, userMetadataHeaderPrefix))] = values[0]
+	}
+	return meta
+}
+
+// BuildProperties applies metadata rules to S3 user metadata and tags; keys too
+// long for Drive are skipped and logged to logger (nil for slog.Default())
+func BuildProperties(logger *slog.Logger, rules []configs.MetadataRule, meta, tags map[string]string) map[string]string {
+	logger = logging.OrDefault(logger)
+	props := make(map[string]string)
+	for _, rule := range rules {
+		source, name, ok := strings.Cut(rule.Source, ":")
+		if !ok {
+			continue
+		}
+		var values map[string]string
+		switch source {
+		case "meta":
+			values = meta
+			name = strings.ToLower(name)
+		case "tag":
+			values = tags
+		default:
+			continue
+		}
+
+		if name == "*" {
+			for k, v := range values {
+				setProperty(logger, props, rule.Property+k, v)
+			}
+			continue
+		}
+		if v, ok := values[name]; ok {
+			key := rule.Property
+			if key == "" {
+				key = name
+			}
+			setProperty(logger, props, key, v)
+		}
+	}
+	return props
+}
+
+// setProperty stores a property, truncating the value to fit Drive's size limit
+func setProperty(logger *slog.Logger, props map[string]string, key, value string) {
+	if len(key) >= maxPropertyBytes {
+		logger.Debug("Skipping property, key too long", "property", key, "max_bytes", maxPropertyBytes)
+		return
+	}
+	if room := maxPropertyBytes - len(key); len(value) > room {
+		value = strings.ToValidUTF8(value[:room], "")
+	}
+	props[key] = value
+}
+
+// RenderDescription renders the description template with .Meta and .Tags
+func RenderDescription(tmpl string, meta, tags map[string]string) (string, error) {
+	t, err := template.New("description").Option("missingkey=zero").Parse(tmpl)
+	if err != nil {
+		return "", err
+	}
+	var sb strings.Builder
+	data := struct {
+		Meta map[string]string
+		Tags map[string]string
+	}{Meta: meta, Tags: tags}
+	if err := t.Execute(&sb, data); err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
+
+// usableContentType reports whether an S3 Content-Type is more specific than the default
+func usableContentType(contentType string) bool {
+	switch contentType {
+	case "", "binary/octet-stream", "application/octet-stream":
+		return false
+	}
+	return true
+}
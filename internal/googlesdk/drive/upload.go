@@ -2,43 +2,137 @@ package drive
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/vincent119/s3syncgoogledrive/internal/configs"
+	"github.com/vincent119/s3syncgoogledrive/internal/pkg/errs"
+	"github.com/vincent119/s3syncgoogledrive/internal/pkg/logging"
+	"github.com/vincent119/s3syncgoogledrive/internal/pkg/metrics"
+	"github.com/vincent119/s3syncgoogledrive/internal/pkg/tracing"
+
 	"github.com/vbauerster/mpb/v8"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	drive "google.golang.org/api/drive/v3"
 )
 
 var (
 	folderCreateMutex sync.Map
 	uploading         sync.Map
-	Debug             bool
 )
 
-func debugLog(format string, v ...any) {
-	if Debug {
-		log.Printf(format, v...)
-	}
+// HTTPDoer is the subset of *http.Client used to download source files
+type HTTPDoer interface {
+	Do(req *http.Request) (*http.Response, error)
 }
 
 // DriveManager handles Google Drive operations
 type DriveManager struct {
 	srv *drive.Service
+	// DownloadClient fetches presigned S3 URLs (defaults to http.DefaultClient)
+	DownloadClient HTTPDoer
+	// Metadata controls which S3 attributes are copied onto uploaded files.
+	// Use SetMetadata once uploads are running.
+	Metadata configs.MetadataConfig
+	// DriveID scopes queries to a shared drive; empty means My Drive
+	DriveID string
+	// Logger receives structured logs (defaults to slog.Default())
+	Logger *slog.Logger
+	// Metrics records API calls, retries and uploads; nil records nothing
+	Metrics *metrics.Sync
+
+	metadataMu sync.RWMutex
+}
+
+// SetMetadata replaces the metadata settings used by subsequent uploads
+func (d *DriveManager) SetMetadata(m configs.MetadataConfig) {
+	d.metadataMu.Lock()
+	d.Metadata = m
+	d.metadataMu.Unlock()
+}
+
+func (d *DriveManager) logger() *slog.Logger {
+	return logging.OrDefault(d.Logger)
+}
+
+// startCall starts the span of a Drive API call of method; pass the returned
+// context to the call and end it with endCall
+func (d *DriveManager) startCall(ctx context.Context, method string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return tracing.Start(ctx, "drive."+method, attrs...)
+}
+
+// endCall records a Drive API call of method that returned err and ends its span
+func (d *DriveManager) endCall(span trace.Span, method string, err error) {
+	status := statusLabel(err)
+	d.Metrics.DriveCall(method, status)
+	tracing.EndCall(span, status, err)
+}
+
+func (d *DriveManager) metadata() configs.MetadataConfig {
+	d.metadataMu.RLock()
+	defer d.metadataMu.RUnlock()
+	return d.Metadata
 }
 
 // NewDriveManager creates a new DriveManager
 func NewDriveManager(srv *drive.Service) *DriveManager {
 	return &DriveManager{
-		srv: srv,
+		srv:            srv,
+		DownloadClient: http.DefaultClient,
 	}
 }
 
-func (d *DriveManager) CreateFolder(folderName, parentID string) string {
+// listCall builds a Files.List call that also sees shared drive items
+func (d *DriveManager) listCall(query string) *drive.FilesListCall {
+	call := d.srv.Files.List().Q(query).SupportsAllDrives(true).IncludeItemsFromAllDrives(true)
+	if d.DriveID != "" {
+		call = call.Corpora("drive").DriveId(d.DriveID)
+	}
+	return call
+}
+
+// createCall builds a Files.Create call that may target a shared drive
+func (d *DriveManager) createCall(file *drive.File) *drive.FilesCreateCall {
+	return d.srv.Files.Create(file).SupportsAllDrives(true)
+}
+
+// ResolveSharedDrive returns the ID of a shared drive given its ID or name
+func (d *DriveManager) ResolveSharedDrive(ctx context.Context, idOrName string) (string, error) {
+	callCtx, span := d.startCall(ctx, "drives.get")
+	sd, err := d.srv.Drives.Get(idOrName).Fields("id, name").Context(callCtx).Do()
+	d.endCall(span, "drives.get", err)
+	if err == nil {
+		return sd.Id, nil
+	}
+
+	query := fmt.Sprintf("name = '%s'", strings.ReplaceAll(idOrName, "'", "\\'"))
+	callCtx, span = d.startCall(ctx, "drives.list")
+	resp, err := d.srv.Drives.List().Q(query).Fields("drives(id, name)").Context(callCtx).Do()
+	d.endCall(span, "drives.list", err)
+	if err != nil {
+		return "", WrapError("list shared drives", err)
+	}
+	switch len(resp.Drives) {
+	case 0:
+		return "", fmt.Errorf("shared drive %q not found", idOrName)
+	case 1:
+		d.logger().Debug("Resolved shared drive", "shared_drive", idOrName, logging.KeyDriveID, resp.Drives[0].Id)
+		return resp.Drives[0].Id, nil
+	default:
+		return "", fmt.Errorf("shared drive name %q is ambiguous (%d matches), use its ID", idOrName, len(resp.Drives))
+	}
+}
+
+// CreateFolder creates a folder under parentID and returns its ID
+func (d *DriveManager) CreateFolder(ctx context.Context, folderName, parentID string) (string, error) {
 	folderMetadata := &drive.File{
 		Name:     folderName,
 		MimeType: "application/vnd.google-apps.folder",
@@ -46,15 +140,18 @@ func (d *DriveManager) CreateFolder(folderName, parentID string) string {
 	if parentID != "" {
 		folderMetadata.Parents = []string{parentID}
 	}
-	folder, err := d.srv.Files.Create(folderMetadata).Do()
+	ctx, span := d.startCall(ctx, "files.create")
+	folder, err := d.createCall(folderMetadata).Context(ctx).Do()
+	d.endCall(span, "files.create", err)
 	if err != nil {
-		log.Fatalf("Failed to create folder: %v", err)
+		return "", WrapError("create folder "+folderName, err)
 	}
-	debugLog("Folder created: %s (ID: %s)", folderName, folder.Id)
-	return folder.Id
+	d.logger().Debug("Folder created", "folder", folderName, logging.KeyDriveID, folder.Id)
+	return folder.Id, nil
 }
 
-func (d *DriveManager) FindOrCreateFolder(folderName, parentID string) string {
+// FindOrCreateFolder returns the ID of the folder named folderName under parentID, creating it when missing
+func (d *DriveManager) FindOrCreateFolder(ctx context.Context, folderName, parentID string) (string, error) {
 	// Simple fix for mutex to lock per parent+folder? Or just global for now as before?
 	// Previous code used sync.Mutex global 'folderCreateMutex'.
 	// I changed it to sync.Map in imports/var but logic below uses .Lock().
@@ -64,11 +161,26 @@ func (d *DriveManager) FindOrCreateFolder(folderName, parentID string) string {
 		strings.ReplaceAll(folderName, "'", "\\'"), parentID)
 
 	for retries := 0; retries < 3; retries++ {
-		resp, err := d.srv.Files.List().Q(query).Fields("files(id)").Do()
+		callCtx, span := d.startCall(ctx, "files.list", tracing.KeyAttempt.Int(retries+1))
+		resp, err := d.listCall(query).Fields("files(id)").Context(callCtx).Do()
+		d.endCall(span, "files.list", err)
 		if err == nil && len(resp.Files) > 0 {
-			return resp.Files[0].Id
+			return resp.Files[0].Id, nil
+		}
+		d.logger().Debug("Folder not found yet", "folder", folderName, "parent_id", parentID, logging.KeyAttempt, retries+1, logging.Err(err))
+		wait := time.Second * time.Duration(retries+1)
+		// An empty result is the normal path before a folder is created, not a retried failure
+		if err != nil {
+			d.Metrics.Retry("files.list")
+			if errorKind(err) == errs.ErrRateLimit {
+				d.Metrics.RateLimitWait(wait)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return "", WrapError("look up folder "+folderName, ctx.Err())
+		case <-time.After(wait):
 		}
-		time.Sleep(time.Second * time.Duration(retries+1))
 	}
 
 	// Lock to prevent duplicate folder creation
@@ -81,62 +193,260 @@ func (d *DriveManager) FindOrCreateFolder(folderName, parentID string) string {
 	globalFolderMutex.Lock()
 	defer globalFolderMutex.Unlock()
 
-	resp, err := d.srv.Files.List().Q(query).Fields("files(id)").Do()
-	if err == nil && len(resp.Files) > 0 {
-		return resp.Files[0].Id
+	callCtx, span := d.startCall(ctx, "files.list", tracing.KeyAttempt.Int(4))
+	resp, err := d.listCall(query).Fields("files(id)").Context(callCtx).Do()
+	d.endCall(span, "files.list", err)
+	if err != nil {
+		// Creating a folder we could not look up risks duplicates, and fails
+		// the same way when the cause is auth or quota
+		return "", WrapError("look up folder "+folderName, err)
+	}
+	if len(resp.Files) > 0 {
+		return resp.Files[0].Id, nil
 	}
-	return d.CreateFolder(folderName, parentID)
+	return d.CreateFolder(ctx, folderName, parentID)
 }
 
-func (d *DriveManager) SyncS3PathToDrive(s3Key, rootDriveID string) string {
+// SyncS3PathToDrive creates the Drive folders mirroring the directory of s3Key
+// and returns the ID of the innermost one
+func (d *DriveManager) SyncS3PathToDrive(ctx context.Context, s3Key, rootDriveID string) (string, error) {
 	parentID := rootDriveID
 	for _, folder := range strings.Split(filepath.Dir(s3Key), "/") {
 		if folder != "" {
-			parentID = d.FindOrCreateFolder(folder, parentID)
+			id, err := d.FindOrCreateFolder(ctx, folder, parentID)
+			if err != nil {
+				return "", err
+			}
+			parentID = id
 		}
 	}
-	return parentID
+	return parentID, nil
 }
 
-func (d *DriveManager) FileETagExistsInDrive(s3ETag, parentID string) bool {
-	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+// FindFolderPath resolves the Drive folder mirroring the directory of s3Key
+// without creating anything; found is false when a folder is missing
+func (d *DriveManager) FindFolderPath(ctx context.Context, s3Key, rootDriveID string) (folderID string, found bool, err error) {
+	parentID := rootDriveID
+	for _, folder := range strings.Split(filepath.Dir(s3Key), "/") {
+		if folder == "" || folder == "." {
+			continue
+		}
+		query := fmt.Sprintf("name = '%s' and mimeType = 'application/vnd.google-apps.folder' and trashed = false and '%s' in parents",
+			strings.ReplaceAll(folder, "'", "\\'"), parentID)
+		callCtx, span := d.startCall(ctx, "files.list")
+		resp, err := d.listCall(query).Fields("files(id)").Context(callCtx).Do()
+		d.endCall(span, "files.list", err)
+		if err != nil {
+			return "", false, WrapError("look up folder "+folder, err)
+		}
+		if len(resp.Files) == 0 {
+			return "", false, nil
+		}
+		parentID = resp.Files[0].Id
+	}
+	return parentID, true, nil
+}
+
+// FindFileByETag returns the file under parentID uploaded from an object with s3ETag, or nil
+func (d *DriveManager) FindFileByETag(ctx context.Context, s3ETag, parentID string) (*drive.File, error) {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Minute)
 	defer cancel()
 
 	query := fmt.Sprintf(`'%s' in parents and trashed=false and appProperties has { key='s3etag' and value='%s' }`, parentID, s3ETag)
-	debugLog("ETag query: %s", query)
+	d.logger().Debug("Looking up file by ETag", "query", query)
+
+	ctx, span := d.startCall(ctx, "files.list")
+	resp, err := d.listCall(query).Context(ctx).Fields("files(id, name, size, modifiedTime)").Do()
+	d.endCall(span, "files.list", err)
+	if err != nil {
+		return nil, WrapError("find file by ETag", err)
+	}
+	if len(resp.Files) == 0 {
+		return nil, nil
+	}
+	return resp.Files[0], nil
+}
 
-	resp, err := d.srv.Files.List().Context(ctx).Q(query).Fields("files(id, name)").Do()
+// FindFileByName returns a file named fileName under parentID, or nil
+func (d *DriveManager) FindFileByName(ctx context.Context, fileName, parentID string) (*drive.File, error) {
+	query := fmt.Sprintf("name = '%s' and mimeType != 'application/vnd.google-apps.folder' and trashed = false and '%s' in parents",
+		strings.ReplaceAll(fileName, "'", "\\'"), parentID)
+	ctx, span := d.startCall(ctx, "files.list")
+	resp, err := d.listCall(query).Fields("files(id, name, size, modifiedTime, appProperties)").Context(ctx).Do()
+	d.endCall(span, "files.list", err)
 	if err != nil {
-		debugLog("ETag check failed, skipping file: %v", err)
+		return nil, WrapError("find file "+fileName, err)
+	}
+	if len(resp.Files) == 0 {
+		return nil, nil
+	}
+	return resp.Files[0], nil
+}
+
+// ListFolder returns every file and folder directly under parentID
+func (d *DriveManager) ListFolder(ctx context.Context, parentID string) ([]*drive.File, error) {
+	query := fmt.Sprintf("'%s' in parents and trashed = false", parentID)
+	var files []*drive.File
+	pageToken := ""
+	for {
+		call := d.listCall(query).Fields("nextPageToken, files(id, name, mimeType, size, modifiedTime)").OrderBy("folder, name")
+		if pageToken != "" {
+			call = call.PageToken(pageToken)
+		}
+		callCtx, span := d.startCall(ctx, "files.list")
+		resp, err := call.Context(callCtx).Do()
+		d.endCall(span, "files.list", err)
+		if err != nil {
+			return nil, WrapError("list folder "+parentID, err)
+		}
+		files = append(files, resp.Files...)
+		if resp.NextPageToken == "" {
+			return files, nil
+		}
+		pageToken = resp.NextPageToken
+	}
+}
+
+// FileETagExistsInDrive reports whether an object with s3ETag was already uploaded
+// under parentID. A failed lookup counts as found; use FindFileByETag to tell
+// them apart.
+func (d *DriveManager) FileETagExistsInDrive(ctx context.Context, s3ETag, parentID string) bool {
+	file, err := d.FindFileByETag(ctx, s3ETag, parentID)
+	if err != nil {
+		d.logger().Warn("ETag check failed, skipping file", "s3etag", s3ETag, logging.Err(err))
 		return true // Fail-safe: treat as exists to avoid duplicate uploads
 	}
 
-	if len(resp.Files) > 0 {
-		debugLog("File with matching s3etag found: %s (ID: %s)", resp.Files[0].Name, resp.Files[0].Id)
+	if file != nil {
+		d.logger().Debug("File with matching s3etag found", "name", file.Name, logging.KeyDriveID, file.Id)
 		return true
 	}
-	debugLog("ETag check completed, no match found")
+	d.logger().Debug("No file with matching s3etag", "s3etag", s3ETag)
 	return false
 }
 
-func (d *DriveManager) StreamUploadWithProgress(fileURL, s3Key, rootDriveID, s3ETag string, bar *mpb.Bar) error {
-	if _, exists := uploading.LoadOrStore(s3Key, true); exists {
-		bar.Abort(true)
+// FindFileByVersion returns the file under parentID uploaded from an S3 object version, or nil
+func (d *DriveManager) FindFileByVersion(ctx context.Context, versionID, parentID string) (*drive.File, error) {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Minute)
+	defer cancel()
+
+	query := fmt.Sprintf(`'%s' in parents and trashed=false and appProperties has { key='s3versionid' and value='%s' }`, parentID, versionID)
+	d.logger().Debug("Looking up file by version", "query", query)
+
+	ctx, span := d.startCall(ctx, "files.list")
+	resp, err := d.listCall(query).Context(ctx).Fields("files(id, name)").Do()
+	d.endCall(span, "files.list", err)
+	if err != nil {
+		return nil, WrapError("find file by version", err)
+	}
+	if len(resp.Files) == 0 {
+		return nil, nil
+	}
+	return resp.Files[0], nil
+}
+
+// FileVersionExistsInDrive reports whether an S3 object version was already uploaded
+// under parentID. A failed lookup counts as found; use FindFileByVersion to tell
+// them apart.
+func (d *DriveManager) FileVersionExistsInDrive(ctx context.Context, versionID, parentID string) bool {
+	file, err := d.FindFileByVersion(ctx, versionID, parentID)
+	if err != nil {
+		d.logger().Warn("Version check failed, skipping file", "version_id", versionID, logging.Err(err))
+		return true // Fail-safe: treat as exists to avoid duplicate uploads
+	}
+	return file != nil
+}
+
+// UploadOptions customizes the Drive file created by StreamUploadWithOptions
+type UploadOptions struct {
+	// FileName overrides the Drive file name (defaults to the S3 key base name)
+	FileName string
+	// VersionID is the S3 object version, recorded in appProperties as s3versionid
+	VersionID string
+	// ModifiedTime is the S3 LastModified time
+	ModifiedTime time.Time
+	// Tags are the S3 object tags, used by metadata rules
+	Tags map[string]string
+}
+
+// VersionedFileName inserts an S3 version ID before the file extension,
+// e.g. report.pdf -> report.3HL4kqtJlcpXroDTDmJ.pdf
+func VersionedFileName(fileName, versionID string) string {
+	ext := filepath.Ext(fileName)
+	return strings.TrimSuffix(fileName, ext) + "." + versionID + ext
+}
+
+func (d *DriveManager) StreamUploadWithProgress(ctx context.Context, fileURL, s3Key, rootDriveID, s3ETag string, bar *mpb.Bar) error {
+	return d.StreamUploadWithOptions(ctx, fileURL, s3Key, rootDriveID, s3ETag, UploadOptions{}, bar)
+}
+
+func (d *DriveManager) StreamUploadWithOptions(ctx context.Context, fileURL, s3Key, rootDriveID, s3ETag string, opts UploadOptions, bar *mpb.Bar) error {
+	_, err := d.StreamUpload(ctx, fileURL, s3Key, rootDriveID, s3ETag, opts, bar)
+	if errors.Is(err, ErrAlreadyUploading) {
 		return nil
 	}
-	defer uploading.Delete(s3Key)
+	return err
+}
+
+// ErrAlreadyUploading is returned by StreamUpload when another worker is uploading the same object
+var ErrAlreadyUploading = errors.New("object is already being uploaded")
+
+// StreamUpload copies fileURL into the Drive folder of s3Key and returns the
+// created file, or ErrAlreadyUploading when another worker is uploading the
+// same object.
+func (d *DriveManager) StreamUpload(ctx context.Context, fileURL, s3Key, rootDriveID, s3ETag string, opts UploadOptions, bar *mpb.Bar) (*drive.File, error) {
+	uploadKey := s3Key
+	if opts.VersionID != "" {
+		uploadKey += "?versionId=" + opts.VersionID
+	}
+	if _, exists := uploading.LoadOrStore(uploadKey, true); exists {
+		bar.Abort(true)
+		return nil, ErrAlreadyUploading
+	}
+	defer uploading.Delete(uploadKey)
 
-	parentFolderID := d.SyncS3PathToDrive(s3Key, rootDriveID)
+	start := time.Now()
+	parentFolderID, err := d.SyncS3PathToDrive(ctx, s3Key, rootDriveID)
+	if err != nil {
+		bar.Abort(true)
+		return nil, err
+	}
 
-	resp, err := http.Get(fileURL)
+	ctx, cancel := context.WithTimeout(ctx, 6*time.Hour)
+	defer cancel()
+
+	// The GetObject span ends when the response starts; the body is read while uploading
+	downloadCtx, downloadSpan := tracing.Start(ctx, "s3.GetObject", tracing.KeyS3Key.String(s3Key))
+	req, err := http.NewRequestWithContext(downloadCtx, http.MethodGet, fileURL, nil)
+	if err != nil {
+		tracing.End(downloadSpan, err)
+		bar.Abort(true)
+		return nil, errs.Wrap(errs.ErrInvalid, "download "+s3Key, err)
+	}
+	defer d.Metrics.StartTransfer()()
+	resp, err := d.DownloadClient.Do(req)
 	if err != nil {
+		d.Metrics.S3Call("GetObject", metrics.StatusError)
+		tracing.End(downloadSpan, err)
 		bar.Abort(true)
-		return fmt.Errorf("Failed to download: %v", err)
+		return nil, errs.Wrap(errs.ErrUnavailable, "download "+s3Key, err)
 	}
 	defer resp.Body.Close()
+	d.Metrics.S3Call("GetObject", strconv.Itoa(resp.StatusCode))
+	downloadSpan.SetAttributes(tracing.KeyHTTPStatus.Int(resp.StatusCode), tracing.KeySize.Int64(resp.ContentLength))
+	if resp.StatusCode != http.StatusOK {
+		err := errs.Wrap(downloadErrorKind(resp.StatusCode), "download "+s3Key, fmt.Errorf("unexpected status %s", resp.Status))
+		tracing.End(downloadSpan, err)
+		bar.Abort(true)
+		return nil, err
+	}
+	downloadSpan.End()
 
 	fileName := filepath.Base(s3Key)
 	mimeType := detectMimeType(fileName)
+	if opts.FileName != "" {
+		fileName = opts.FileName
+	}
 
 	fileMetadata := &drive.File{
 		Name:     fileName,
@@ -146,21 +456,53 @@ func (d *DriveManager) StreamUploadWithProgress(fileURL, s3Key, rootDriveID, s3E
 			"s3etag": s3ETag,
 		},
 	}
+	if opts.VersionID != "" {
+		fileMetadata.AppProperties["s3versionid"] = opts.VersionID
+	}
+	d.applyS3Metadata(d.logger().With(logging.KeyS3Key, s3Key), fileMetadata, resp.Header, opts)
 
 	progressReader := bar.ProxyReader(resp.Body)
 	defer progressReader.Close()
 
-	ctx, cancel := context.WithTimeout(context.Background(), 6*time.Hour)
-	defer cancel()
-
-	uploadedFile, err := d.srv.Files.Create(fileMetadata).Context(ctx).Media(progressReader).Do()
+	uploadCtx, span := d.startCall(ctx, "files.create", tracing.KeyS3Key.String(s3Key), tracing.KeySize.Int64(resp.ContentLength))
+	uploadedFile, err := d.createCall(fileMetadata).Context(uploadCtx).Media(progressReader).Do()
+	d.endCall(span, "files.create", err)
 	if err != nil {
 		bar.Abort(true)
-		return fmt.Errorf("Google Drive upload failed: %v", err)
+		return nil, WrapError("upload "+fileName, err)
 	}
 
-	log.Printf("Upload completed: %s (ID: %s)", fileName, uploadedFile.Id)
-	return nil
+	elapsed := time.Since(start)
+	d.Metrics.UploadDuration(elapsed)
+	d.logger().Info("Upload completed", logging.KeyS3Key, s3Key, logging.KeyDriveID, uploadedFile.Id,
+		logging.KeyBytes, resp.ContentLength, logging.KeyDuration, elapsed)
+	return uploadedFile, nil
+}
+
+// applyS3Metadata copies the S3 timestamp, Content-Type, user metadata and tags onto the Drive file
+func (d *DriveManager) applyS3Metadata(logger *slog.Logger, file *drive.File, header http.Header, opts UploadOptions) {
+	md := d.metadata()
+	if md.PreserveModifiedTime && !opts.ModifiedTime.IsZero() {
+		file.ModifiedTime = opts.ModifiedTime.UTC().Format(time.RFC3339)
+	}
+	if md.UseContentType {
+		if ct := header.Get("Content-Type"); usableContentType(ct) {
+			file.MimeType = ct
+		}
+	}
+
+	meta := userMetadataFromHeader(header)
+	if props := BuildProperties(logger, md.Rules, meta, opts.Tags); len(props) > 0 {
+		file.Properties = props
+	}
+	if md.Description != "" {
+		desc, err := RenderDescription(md.Description, meta, opts.Tags)
+		if err != nil {
+			logger.Warn("Failed to render description", "name", file.Name, logging.Err(err))
+		} else {
+			file.Description = desc
+		}
+	}
 }
 
 func detectMimeType(fileName string) string {
@@ -1,7 +1,13 @@
 package drive
 
 import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"strings"
 	"testing"
+
+	"github.com/vincent119/s3syncgoogledrive/internal/configs"
 )
 
 func TestDetectMimeType(t *testing.T) {
@@ -26,3 +32,106 @@ func TestDetectMimeType(t *testing.T) {
 		})
 	}
 }
+
+func TestVersionedFileName(t *testing.T) {
+	tests := []struct {
+		name      string
+		fileName  string
+		versionID string
+		want      string
+	}{
+		{"WithExt", "report.pdf", "v123", "report.v123.pdf"},
+		{"NoExt", "README", "v123", "README.v123"},
+		{"MultiDot", "archive.tar.gz", "null", "archive.tar.null.gz"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := VersionedFileName(tt.fileName, tt.versionID); got != tt.want {
+				t.Errorf("VersionedFileName(%s, %s) = %v, want %v", tt.fileName, tt.versionID, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildProperties(t *testing.T) {
+	rules := []configs.MetadataRule{
+		{Source: "meta:project", Property: "project"},
+		{Source: "tag:owner"},
+		{Source: "tag:*", Property: "tag_"},
+		{Source: "meta:missing", Property: "missing"},
+		{Source: "bogus"},
+	}
+	meta := map[string]string{"project": "apollo"}
+	tags := map[string]string{"owner": "finance", "retention": "7y"}
+
+	got := BuildProperties(nil, rules, meta, tags)
+	want := map[string]string{
+		"project":       "apollo",
+		"owner":         "finance",
+		"tag_owner":     "finance",
+		"tag_retention": "7y",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("BuildProperties = %v, want %v", got, want)
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("Property %s = %q, want %q", k, got[k], v)
+		}
+	}
+}
+
+func TestBuildPropertiesTruncatesValue(t *testing.T) {
+	rules := []configs.MetadataRule{{Source: "meta:note", Property: "note"}}
+	meta := map[string]string{"note": strings.Repeat("x", 200)}
+
+	got := BuildProperties(nil, rules, meta, nil)
+	if len(got["note"])+len("note") != maxPropertyBytes {
+		t.Errorf("Truncated property length = %d, want %d", len(got["note"])+len("note"), maxPropertyBytes)
+	}
+}
+
+func TestBuildPropertiesLogsSkippedKey(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})).With("s3_key", "a/b.txt")
+	long := strings.Repeat("k", maxPropertyBytes)
+	rules := []configs.MetadataRule{{Source: "meta:note", Property: long}}
+
+	got := BuildProperties(logger, rules, map[string]string{"note": "x"}, nil)
+	if len(got) != 0 {
+		t.Errorf("BuildProperties = %v, want the long key skipped", got)
+	}
+	// Skipped keys go to the manager's logger with its fields
+	if out := buf.String(); !strings.Contains(out, "Skipping property") || !strings.Contains(out, "s3_key=a/b.txt") {
+		t.Errorf("Unexpected log output: %s", out)
+	}
+}
+
+func TestRenderDescription(t *testing.T) {
+	meta := map[string]string{"project": "apollo"}
+	tags := map[string]string{"owner": "finance"}
+
+	got, err := RenderDescription(`{{.Meta.project}} / {{.Tags.owner}}{{.Tags.none}}`, meta, tags)
+	if err != nil {
+		t.Fatalf("RenderDescription failed: %v", err)
+	}
+	if got != "apollo / finance" {
+		t.Errorf("RenderDescription = %q, want %q", got, "apollo / finance")
+	}
+
+	if _, err := RenderDescription(`{{.Meta.project`, meta, tags); err == nil {
+		t.Error("Expected parse error for invalid template, got nil")
+	}
+}
+
+func TestUserMetadataFromHeader(t *testing.T) {
+	h := http.Header{}
+	h.Set("X-Amz-Meta-Project", "apollo")
+	h.Set("Content-Type", "text/csv")
+
+	got := userMetadataFromHeader(h)
+	if len(got) != 1 || got["project"] != "apollo" {
+		t.Errorf("userMetadataFromHeader = %v, want map[project:apollo]", got)
+	}
+}
@@ -0,0 +1,182 @@
+package googlesdk
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/vincent119/s3syncgoogledrive/internal/pkg/errs"
+
+	"golang.org/x/oauth2"
+)
+
+// headlessRedirectURL is registered for the paste flow; nothing listens on it,
+// the user copies the URL the browser failed to load
+const headlessRedirectURL = "http://127.0.0.1:1/callback"
+
+// loginTimeout bounds how long the loopback listener waits for the redirect
+const loginTimeout = 5 * time.Minute
+
+// Login authorizes the default account; see LoginAccount
+func (a *AuthManager) Login(ctx context.Context, headless bool) error {
+	return a.LoginAccount(ctx, DefaultAccount, headless)
+}
+
+// LoginAccount authorizes the Drive scope with PKCE and a random state and saves the token.
+// The default flow receives the code on a temporary loopback listener; headless prints
+// the consent URL and reads the redirected URL pasted back by the user.
+func (a *AuthManager) LoginAccount(ctx context.Context, account string, headless bool) error {
+	state, err := randomState()
+	if err != nil {
+		return err
+	}
+	verifier := oauth2.GenerateVerifier()
+
+	var code string
+	var conf *oauth2.Config
+	if headless {
+		conf = a.oauthConfig(headlessRedirectURL)
+		code, err = a.pasteCode(conf, state, verifier)
+	} else {
+		conf, code, err = a.loopbackCode(ctx, state, verifier)
+	}
+	if err != nil {
+		return err
+	}
+
+	token, err := conf.Exchange(ctx, code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		return errs.Wrap(errs.ErrAuth, "exchange authorization code", err)
+	}
+	if token.RefreshToken == "" {
+		return errs.Wrap(errs.ErrAuth, "exchange authorization code", errors.New("no refresh token returned; revoke the app's access and try again"))
+	}
+
+	return a.saveToken(account, token)
+}
+
+// authCodeURL builds the consent URL; prompt=consent makes Google return a refresh token every time
+func authCodeURL(conf *oauth2.Config, state, verifier string) string {
+	return conf.AuthCodeURL(state,
+		oauth2.AccessTypeOffline,
+		oauth2.S256ChallengeOption(verifier),
+		oauth2.SetAuthURLParam("prompt", "consent"),
+	)
+}
+
+// loopbackCode serves http://127.0.0.1:<port>/callback until the redirect arrives
+func (a *AuthManager) loopbackCode(ctx context.Context, state, verifier string) (*oauth2.Config, string, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to start loopback listener: %w", err)
+	}
+	defer listener.Close()
+
+	conf := a.oauthConfig(fmt.Sprintf("http://%s/callback", listener.Addr().String()))
+
+	type result struct {
+		code string
+		err  error
+	}
+	results := make(chan result, 1)
+	server := &http.Server{
+		ReadHeaderTimeout: 10 * time.Second,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/callback" {
+				http.NotFound(w, r)
+				return
+			}
+			code, err := codeFromQuery(r.URL.Query(), state)
+			if err != nil {
+				http.Error(w, "Authorization failed: "+err.Error(), http.StatusBadRequest)
+			} else {
+				fmt.Fprintln(w, "Authorization complete. You can close this window.")
+			}
+			select {
+			case results <- result{code: code, err: err}:
+			default:
+			}
+		}),
+	}
+	go server.Serve(listener)
+	defer server.Close()
+
+	authURL := authCodeURL(conf, state, verifier)
+	fmt.Fprintln(a.out, "Opening the browser to authorize access. If it does not open, visit:")
+	fmt.Fprintln(a.out, authURL)
+	if err := a.browser(authURL); err != nil {
+		fmt.Fprintf(a.out, "Could not open the browser automatically: %v\n", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, loginTimeout)
+	defer cancel()
+	select {
+	case res := <-results:
+		return conf, res.code, res.err
+	case <-ctx.Done():
+		return nil, "", fmt.Errorf("timed out waiting for authorization: %w", ctx.Err())
+	}
+}
+
+// pasteCode prints the consent URL and reads the redirected URL from the user
+func (a *AuthManager) pasteCode(conf *oauth2.Config, state, verifier string) (string, error) {
+	fmt.Fprintln(a.out, "Visit the following URL on any machine and authorize the app:")
+	fmt.Fprintln(a.out, authCodeURL(conf, state, verifier))
+	fmt.Fprintln(a.out, "The browser will then fail to load a 127.0.0.1 page; copy that page's full URL.")
+	fmt.Fprint(a.out, "Paste the redirected URL: ")
+
+	line, err := bufio.NewReader(a.in).ReadString('\n')
+	if err != nil && line == "" {
+		return "", fmt.Errorf("failed to read redirected URL: %w", err)
+	}
+	redirected, err := url.Parse(strings.TrimSpace(line))
+	if err != nil {
+		return "", fmt.Errorf("invalid redirected URL: %w", err)
+	}
+	return codeFromQuery(redirected.Query(), state)
+}
+
+// codeFromQuery verifies the state and extracts the authorization code from a redirect
+func codeFromQuery(q url.Values, state string) (string, error) {
+	if e := q.Get("error"); e != "" {
+		return "", errs.Wrap(errs.ErrAuth, "authorize", fmt.Errorf("authorization denied: %s", e))
+	}
+	if q.Get("state") != state {
+		return "", errors.New("state mismatch, possible forged redirect")
+	}
+	code := q.Get("code")
+	if code == "" {
+		return "", errors.New("redirect does not contain an authorization code")
+	}
+	return code, nil
+}
+
+func randomState() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate state: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// openBrowser opens url in the user's default browser
+func openBrowser(url string) error {
+	switch runtime.GOOS {
+	case "darwin":
+		return exec.Command("open", url).Start()
+	case "windows":
+		return exec.Command("rundll32", "url.dll,FileProtocolHandler", url).Start()
+	default:
+		return exec.Command("xdg-open", url).Start()
+	}
+}
@@ -0,0 +1,311 @@
+package googlesdk
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/vincent119/s3syncgoogledrive/internal/configs"
+	"github.com/vincent119/s3syncgoogledrive/internal/pkg/logging"
+
+	"golang.org/x/oauth2"
+)
+
+// Token store types accepted by TokenStoreConfig.Type
+const (
+	TokenStoreFile          = configs.TokenStoreTypeFile
+	TokenStoreEncryptedFile = configs.TokenStoreTypeEncryptedFile
+	TokenStoreEnv           = configs.TokenStoreTypeEnv
+	TokenStoreConfig        = configs.TokenStoreTypeConfig
+)
+
+// Defaults used when the token store config leaves them empty
+const (
+	DefaultTokenPath     = "config/refresh_token.txt"
+	DefaultTokenDir      = "config/tokens"
+	DefaultTokenEnv      = "S3SYNC_GOOGLE_TOKEN"
+	DefaultPassphraseEnv = "S3SYNC_TOKEN_PASSPHRASE"
+)
+
+// tokenFileMode keeps stored credentials readable by the owner only
+const tokenFileMode = 0600
+
+// ErrReadOnlyTokenStore is returned when saving to a store that cannot persist tokens
+var ErrReadOnlyTokenStore = errors.New("token store is read-only")
+
+// TokenStore persists Google OAuth tokens
+type TokenStore interface {
+	Load() (*oauth2.Token, error)
+	Save(token *oauth2.Token) error
+	Delete() error
+}
+
+// NewTokenStore builds the token store selected in the Drive config for an account.
+// The default account uses tokenStore.path; named accounts get their own file
+// under tokenStore.dir or their own environment variable.
+func NewTokenStore(fs FileIO, cfg configs.DriveConfig, account string) (TokenStore, error) {
+	account = normalizeAccount(account)
+	if err := validateAccountName(account); err != nil {
+		return nil, err
+	}
+
+	ts := cfg.TokenStore
+	path := ts.Path
+	if path == "" {
+		path = DefaultTokenPath
+	}
+	if account != DefaultAccount {
+		dir := ts.Dir
+		if dir == "" {
+			dir = DefaultTokenDir
+		}
+		path = filepath.Join(dir, account+".json")
+	}
+
+	switch ts.Type {
+	case "", TokenStoreFile:
+		return &FileTokenStore{fs: fs, path: path}, nil
+	case TokenStoreEncryptedFile:
+		envName := ts.PassphraseEnv
+		if envName == "" {
+			envName = DefaultPassphraseEnv
+		}
+		passphrase := os.Getenv(envName)
+		if passphrase == "" {
+			return nil, fmt.Errorf("token store %q requires a passphrase in $%s", ts.Type, envName)
+		}
+		return &EncryptedFileTokenStore{fs: fs, path: path, passphrase: passphrase}, nil
+	case TokenStoreEnv:
+		envName := ts.EnvVar
+		if envName == "" {
+			envName = DefaultTokenEnv
+		}
+		if account != DefaultAccount {
+			envName += "_" + strings.ToUpper(strings.NewReplacer("-", "_", ".", "_").Replace(account))
+		}
+		return &EnvTokenStore{name: envName}, nil
+	case TokenStoreConfig:
+		if account != DefaultAccount {
+			return nil, fmt.Errorf("token store %q only holds the %s account", ts.Type, DefaultAccount)
+		}
+		return &ConfigTokenStore{refreshToken: cfg.RefreshToken}, nil
+	default:
+		return nil, fmt.Errorf("unknown token store type %q", ts.Type)
+	}
+}
+
+// decodeToken parses a stored token; a bare string is treated as a legacy refresh token
+func decodeToken(data []byte) (*oauth2.Token, error) {
+	raw := strings.TrimSpace(string(data))
+	if raw == "" {
+		return nil, errors.New("stored token is empty")
+	}
+	if !strings.HasPrefix(raw, "{") {
+		return &oauth2.Token{RefreshToken: raw}, nil
+	}
+	var token oauth2.Token
+	if err := json.Unmarshal([]byte(raw), &token); err != nil {
+		return nil, fmt.Errorf("failed to decode stored token: %w", err)
+	}
+	return &token, nil
+}
+
+// FileTokenStore keeps the token as JSON in a file with mode 0600
+type FileTokenStore struct {
+	fs   FileIO
+	path string
+}
+
+func (s *FileTokenStore) Load() (*oauth2.Token, error) {
+	data, err := s.fs.ReadFile(s.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", s.path, err)
+	}
+	return decodeToken(data)
+}
+
+func (s *FileTokenStore) Save(token *oauth2.Token) error {
+	data, err := json.Marshal(token)
+	if err != nil {
+		return err
+	}
+	return s.fs.WriteFile(s.path, data, tokenFileMode)
+}
+
+func (s *FileTokenStore) Delete() error {
+	return s.fs.Remove(s.path)
+}
+
+// encryptedToken is the on-disk envelope of EncryptedFileTokenStore
+type encryptedToken struct {
+	Version    int    `json:"v"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"data"`
+}
+
+const (
+	encryptedTokenVersion = 1
+	pbkdf2Iterations      = 600000
+)
+
+// EncryptedFileTokenStore encrypts the token with AES-256-GCM using a key derived from a passphrase
+type EncryptedFileTokenStore struct {
+	fs         FileIO
+	path       string
+	passphrase string
+}
+
+func (s *EncryptedFileTokenStore) gcm(salt []byte) (cipher.AEAD, error) {
+	key, err := pbkdf2.Key(sha256.New, s.passphrase, salt, pbkdf2Iterations, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func (s *EncryptedFileTokenStore) Load() (*oauth2.Token, error) {
+	data, err := s.fs.ReadFile(s.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", s.path, err)
+	}
+	var env encryptedToken
+	if err := json.Unmarshal(data, &env); err != nil || env.Version != encryptedTokenVersion {
+		return nil, fmt.Errorf("%s is not an encrypted token file", s.path)
+	}
+	aead, err := s.gcm(env.Salt)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := aead.Open(nil, env.Nonce, env.Ciphertext, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt %s: wrong passphrase or corrupted file", s.path)
+	}
+	return decodeToken(plain)
+}
+
+func (s *EncryptedFileTokenStore) Save(token *oauth2.Token) error {
+	plain, err := json.Marshal(token)
+	if err != nil {
+		return err
+	}
+	env := encryptedToken{Version: encryptedTokenVersion, Salt: make([]byte, 16)}
+	if _, err := rand.Read(env.Salt); err != nil {
+		return err
+	}
+	aead, err := s.gcm(env.Salt)
+	if err != nil {
+		return err
+	}
+	env.Nonce = make([]byte, aead.NonceSize())
+	if _, err := rand.Read(env.Nonce); err != nil {
+		return err
+	}
+	env.Ciphertext = aead.Seal(nil, env.Nonce, plain, nil)
+
+	data, err := json.Marshal(env)
+	if err != nil {
+		return err
+	}
+	return s.fs.WriteFile(s.path, data, tokenFileMode)
+}
+
+func (s *EncryptedFileTokenStore) Delete() error {
+	return s.fs.Remove(s.path)
+}
+
+// EnvTokenStore reads a refresh token or token JSON from an environment variable
+type EnvTokenStore struct {
+	name string
+}
+
+func (s *EnvTokenStore) Load() (*oauth2.Token, error) {
+	value := os.Getenv(s.name)
+	if value == "" {
+		return nil, fmt.Errorf("$%s is not set", s.name)
+	}
+	return decodeToken([]byte(value))
+}
+
+func (s *EnvTokenStore) Save(token *oauth2.Token) error {
+	return fmt.Errorf("$%s: %w", s.name, ErrReadOnlyTokenStore)
+}
+
+func (s *EnvTokenStore) Delete() error {
+	return fmt.Errorf("$%s: %w", s.name, ErrReadOnlyTokenStore)
+}
+
+// ConfigTokenStore reads the refresh token from Drive.refresh_token in the config file
+type ConfigTokenStore struct {
+	refreshToken string
+}
+
+func (s *ConfigTokenStore) Load() (*oauth2.Token, error) {
+	if s.refreshToken == "" {
+		return nil, errors.New("Drive.refresh_token is empty")
+	}
+	return &oauth2.Token{RefreshToken: s.refreshToken}, nil
+}
+
+func (s *ConfigTokenStore) Save(token *oauth2.Token) error {
+	return fmt.Errorf("Drive.refresh_token: %w", ErrReadOnlyTokenStore)
+}
+
+func (s *ConfigTokenStore) Delete() error {
+	return fmt.Errorf("Drive.refresh_token: %w", ErrReadOnlyTokenStore)
+}
+
+// persistingTokenSource saves every new token, so refreshed access tokens
+// and rotated refresh tokens survive restarts
+type persistingTokenSource struct {
+	base  oauth2.TokenSource
+	store TokenStore
+	mu    sync.Mutex
+	last  *oauth2.Token
+	// logger reports tokens that cannot be saved (defaults to slog.Default())
+	logger *slog.Logger
+}
+
+func newPersistingTokenSource(base oauth2.TokenSource, store TokenStore, initial *oauth2.Token) *persistingTokenSource {
+	return &persistingTokenSource{base: base, store: store, last: initial}
+}
+
+func (p *persistingTokenSource) Token() (*oauth2.Token, error) {
+	token, err := p.base.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.last != nil && token.AccessToken == p.last.AccessToken && token.RefreshToken == p.last.RefreshToken {
+		return token, nil
+	}
+	rotated := p.last != nil && token.RefreshToken != p.last.RefreshToken
+	p.last = token
+	if err := p.store.Save(token); err != nil {
+		switch {
+		case errors.Is(err, ErrReadOnlyTokenStore) && rotated:
+			logging.OrDefault(p.logger).Warn("Google rotated the refresh token but it cannot be saved; re-run auth login", logging.Err(err))
+		case errors.Is(err, ErrReadOnlyTokenStore):
+			// Access tokens are short-lived; nothing is lost
+		default:
+			logging.OrDefault(p.logger).Warn("Failed to persist refreshed token", logging.Err(err))
+		}
+	}
+	return token, nil
+}
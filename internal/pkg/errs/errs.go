@@ -0,0 +1,62 @@
+// Package errs defines the error kinds shared by the S3, Drive and Google auth
+// packages, so callers can decide what is fatal without knowing which API failed.
+package errs
+
+import "errors"
+
+// Error kinds; test for them with errors.Is
+var (
+	ErrAuth        = errors.New("authentication failed")
+	ErrPermission  = errors.New("permission denied")
+	ErrNotFound    = errors.New("not found")
+	ErrQuota       = errors.New("quota exceeded")
+	ErrRateLimit   = errors.New("rate limited")
+	ErrUnavailable = errors.New("service unavailable")
+	ErrInvalid     = errors.New("invalid request")
+)
+
+// Error is a failed operation annotated with its kind. It unwraps to both the
+// kind and the underlying error, so errors.As still reaches API error types.
+type Error struct {
+	Kind error
+	Op   string
+	Err  error
+}
+
+func (e *Error) Error() string {
+	if e.Kind == nil {
+		return e.Op + ": " + e.Err.Error()
+	}
+	return e.Op + ": " + e.Kind.Error() + ": " + e.Err.Error()
+}
+
+func (e *Error) Unwrap() []error {
+	if e.Kind == nil {
+		return []error{e.Err}
+	}
+	return []error{e.Kind, e.Err}
+}
+
+// Wrap annotates err with op and kind; kind may be nil when it is unknown.
+// A nil err returns nil.
+func Wrap(kind error, op string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{Kind: kind, Op: op, Err: err}
+}
+
+// Kind returns the kind of err, or nil when it has none
+func Kind(err error) error {
+	for _, kind := range []error{ErrAuth, ErrPermission, ErrNotFound, ErrQuota, ErrRateLimit, ErrUnavailable, ErrInvalid} {
+		if errors.Is(err, kind) {
+			return kind
+		}
+	}
+	return nil
+}
+
+// Temporary reports whether retrying err later may succeed
+func Temporary(err error) bool {
+	return errors.Is(err, ErrRateLimit) || errors.Is(err, ErrUnavailable)
+}
@@ -0,0 +1,60 @@
+package errs
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+type apiError struct{ code int }
+
+func (e *apiError) Error() string { return fmt.Sprintf("api error %d", e.code) }
+
+func TestWrap(t *testing.T) {
+	cause := &apiError{code: 403}
+	err := fmt.Errorf("upload report.pdf: %w", Wrap(ErrQuota, "create file", cause))
+
+	if !errors.Is(err, ErrQuota) {
+		t.Error("errors.Is(err, ErrQuota) = false")
+	}
+	if errors.Is(err, ErrAuth) {
+		t.Error("errors.Is(err, ErrAuth) = true")
+	}
+	var api *apiError
+	if !errors.As(err, &api) || api.code != 403 {
+		t.Errorf("errors.As did not reach the API error: %v", api)
+	}
+	if Kind(err) != ErrQuota {
+		t.Errorf("Kind = %v, want ErrQuota", Kind(err))
+	}
+	if want := "upload report.pdf: create file: quota exceeded: api error 403"; err.Error() != want {
+		t.Errorf("Error() = %q, want %q", err.Error(), want)
+	}
+}
+
+func TestWrapWithoutKind(t *testing.T) {
+	err := Wrap(nil, "list", errors.New("boom"))
+	if Kind(err) != nil {
+		t.Errorf("Kind = %v, want nil", Kind(err))
+	}
+	if err.Error() != "list: boom" {
+		t.Errorf("Error() = %q", err.Error())
+	}
+	if Wrap(ErrAuth, "list", nil) != nil {
+		t.Error("Wrap(nil error) should be nil")
+	}
+}
+
+func TestTemporary(t *testing.T) {
+	cases := map[error]bool{
+		ErrRateLimit:   true,
+		ErrUnavailable: true,
+		ErrQuota:       false,
+		ErrAuth:        false,
+	}
+	for kind, want := range cases {
+		if got := Temporary(Wrap(kind, "op", errors.New("x"))); got != want {
+			t.Errorf("Temporary(%v) = %v, want %v", kind, got, want)
+		}
+	}
+}
@@ -0,0 +1,271 @@
+// Package journal keeps an append-only record of the state transitions of
+// every file in a sync run, one JSON object per line, so that an interrupted
+// run can be resumed without listing S3 or querying Drive for finished files.
+package journal
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// State is a step in the life of a run or of one of its files
+type State string
+
+const (
+	// Started opens the journal of a new run and carries its options
+	Started State = "started"
+	// Resumed marks a later process continuing the run
+	Resumed State = "resumed"
+
+	// Queued files were listed and wait for a worker; the record carries the S3 object
+	Queued State = "queued"
+	// Uploading files were picked up by a worker
+	Uploading State = "uploading"
+	// Done files are in Drive, uploaded or found with the same ETag
+	Done State = "done"
+	// Pending files are archived and wait for an S3 restore
+	Pending State = "pending"
+	// Failed files could not be copied
+	Failed State = "failed"
+)
+
+// Run is the sync a journal belongs to, with the options needed to resume it
+type Run struct {
+	ID          string `json:"id"`
+	Prefix      string `json:"prefix"`
+	RootID      string `json:"root_id"`
+	AsOf        string `json:"as_of,omitempty"`
+	AllVersions bool   `json:"all_versions,omitempty"`
+	Account     string `json:"account,omitempty"`
+}
+
+// Record is one line of a journal
+type Record struct {
+	Time  time.Time `json:"time"`
+	State State     `json:"state"`
+	// Run is set on Started and Resumed records
+	Run *Run `json:"run,omitempty"`
+
+	S3Key     string `json:"s3_key,omitempty"`
+	VersionID string `json:"version_id,omitempty"`
+	// ETag, StorageClass, Size and LastModified are set on Queued records
+	ETag         string    `json:"etag,omitempty"`
+	StorageClass string    `json:"storage_class,omitempty"`
+	Size         int64     `json:"size,omitempty"`
+	LastModified time.Time `json:"last_modified,omitzero"`
+	// DriveID is the uploaded file of a Done record, when known
+	DriveID string `json:"drive_id,omitempty"`
+	// Error is the reason of a Failed or Pending record
+	Error string `json:"error,omitempty"`
+}
+
+// Path returns the journal file of runID in dir
+func Path(dir, runID string) string {
+	return filepath.Join(dir, runID+".jsonl")
+}
+
+// checkRunID rejects IDs that would point outside the journal directory
+func checkRunID(runID string) error {
+	if runID == "" || runID != filepath.Base(runID) || runID == "." || runID == ".." {
+		return fmt.Errorf("invalid run ID %q", runID)
+	}
+	return nil
+}
+
+// Writer appends records to a journal. It is safe for concurrent use, and a
+// nil *Writer records nothing.
+type Writer struct {
+	mu  sync.Mutex
+	f   *os.File
+	buf *bufio.Writer
+	enc *json.Encoder
+	err error
+	now func() time.Time
+}
+
+// Create starts the journal of a new run in dir
+func Create(dir, runID string) (*Writer, error) {
+	if err := checkRunID(runID); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("create journal directory: %w", err)
+	}
+	return open(Path(dir, runID), os.O_CREATE|os.O_EXCL|os.O_WRONLY)
+}
+
+// Append continues the journal of runID in dir. A last record cut short by a
+// crash is terminated first, so the new records start on their own line.
+func Append(dir, runID string) (*Writer, error) {
+	if err := checkRunID(runID); err != nil {
+		return nil, err
+	}
+	w, err := open(Path(dir, runID), os.O_APPEND|os.O_RDWR)
+	if err != nil {
+		return nil, err
+	}
+	if info, err := w.f.Stat(); err == nil && info.Size() > 0 {
+		last := make([]byte, 1)
+		if _, err := w.f.ReadAt(last, info.Size()-1); err == nil && last[0] != '\n' {
+			w.buf.WriteByte('\n')
+		}
+	}
+	return w, nil
+}
+
+func open(path string, flag int) (*Writer, error) {
+	f, err := os.OpenFile(path, flag, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("open journal: %w", err)
+	}
+	buf := bufio.NewWriter(f)
+	return &Writer{f: f, buf: buf, enc: json.NewEncoder(buf), now: time.Now}, nil
+}
+
+// Write appends records and flushes them to the file, so they survive the
+// process being killed. After the first error nothing more is written and
+// that error is returned.
+func (w *Writer) Write(records ...Record) error {
+	if w == nil {
+		return nil
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err != nil {
+		return w.err
+	}
+	now := w.now()
+	for _, r := range records {
+		if r.Time.IsZero() {
+			r.Time = now
+		}
+		if err := w.enc.Encode(r); err != nil {
+			w.err = fmt.Errorf("write journal: %w", err)
+			return w.err
+		}
+	}
+	if err := w.buf.Flush(); err != nil {
+		w.err = fmt.Errorf("write journal: %w", err)
+	}
+	return w.err
+}
+
+// Close flushes and closes the journal, returning the first write error
+func (w *Writer) Close() error {
+	if w == nil {
+		return nil
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.buf.Flush(); err != nil && w.err == nil {
+		w.err = fmt.Errorf("write journal: %w", err)
+	}
+	if err := w.f.Close(); err != nil && w.err == nil {
+		w.err = fmt.Errorf("close journal: %w", err)
+	}
+	return w.err
+}
+
+// Replay is a journal read back to resume its run
+type Replay struct {
+	Run Run
+	// Files are the queued files in queue order; State, DriveID and Error
+	// come from the last record of each
+	Files []Record
+}
+
+// Load reads the journal of runID in dir. A last line cut short by a crash is ignored.
+func Load(dir, runID string) (*Replay, error) {
+	if err := checkRunID(runID); err != nil {
+		return nil, err
+	}
+	f, err := os.Open(Path(dir, runID))
+	if err != nil {
+		return nil, fmt.Errorf("open journal: %w", err)
+	}
+	defer f.Close()
+	replay, err := Read(f)
+	if err != nil {
+		return nil, fmt.Errorf("journal of run %s: %w", runID, err)
+	}
+	return replay, nil
+}
+
+// Read replays the records in r
+func Read(r io.Reader) (*Replay, error) {
+	var replay Replay
+	var started bool
+	var torn error
+	index := make(map[string]int)
+
+	br := bufio.NewReader(r)
+	for line := 1; ; line++ {
+		data, readErr := br.ReadBytes('\n')
+		if readErr != nil && !errors.Is(readErr, io.EOF) {
+			return nil, readErr
+		}
+		if len(bytes.TrimSpace(data)) == 0 {
+			if readErr != nil {
+				break
+			}
+			continue
+		}
+		var rec Record
+		if err := json.Unmarshal(data, &rec); err != nil {
+			if readErr != nil {
+				break // the final record was cut short
+			}
+			// A record cut short by a crash is followed by the Resumed record
+			// of the next process; anywhere else the journal is corrupt
+			torn = fmt.Errorf("line %d: %w", line, err)
+			continue
+		}
+		if torn != nil {
+			if rec.State != Resumed {
+				return nil, torn
+			}
+			torn = nil
+		}
+
+		switch rec.State {
+		case Started:
+			if rec.Run == nil {
+				return nil, fmt.Errorf("line %d: %s record without run", line, rec.State)
+			}
+			replay.Run, started = *rec.Run, true
+		case Resumed:
+		case Queued:
+			key := fileKey(rec.S3Key, rec.VersionID)
+			if _, ok := index[key]; !ok {
+				index[key] = len(replay.Files)
+				replay.Files = append(replay.Files, rec)
+			}
+		default:
+			i, ok := index[fileKey(rec.S3Key, rec.VersionID)]
+			if !ok {
+				return nil, fmt.Errorf("line %d: %s record for %s, which was not queued", line, rec.State, rec.S3Key)
+			}
+			file := &replay.Files[i]
+			file.Time, file.State, file.DriveID, file.Error = rec.Time, rec.State, rec.DriveID, rec.Error
+		}
+		if readErr != nil {
+			break
+		}
+	}
+	if !started {
+		return nil, errors.New("no started record")
+	}
+	return &replay, nil
+}
+
+func fileKey(s3Key, versionID string) string {
+	return s3Key + "\x00" + versionID
+}
@@ -0,0 +1,149 @@
+package journal
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeRun(t *testing.T, dir string) {
+	t.Helper()
+	w, err := Create(dir, "run1")
+	if err != nil {
+		t.Fatalf("Create() = %v", err)
+	}
+	modified := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	must := func(err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatalf("Write() = %v", err)
+		}
+	}
+	must(w.Write(Record{State: Started, Run: &Run{ID: "run1", Prefix: "photos/", RootID: "root", AllVersions: true}}))
+	must(w.Write(
+		Record{State: Queued, S3Key: "photos/a.jpg", VersionID: "v1", ETag: "e1", Size: 10, LastModified: modified},
+		Record{State: Queued, S3Key: "photos/a.jpg", VersionID: "v2", ETag: "e2", Size: 11, LastModified: modified},
+		Record{State: Queued, S3Key: "photos/b.jpg", ETag: "e3", StorageClass: "GLACIER", Size: 12},
+		Record{State: Queued, S3Key: "photos/c.jpg", ETag: "e4", Size: 13},
+	))
+	must(w.Write(Record{State: Uploading, S3Key: "photos/a.jpg", VersionID: "v1"}))
+	must(w.Write(Record{State: Done, S3Key: "photos/a.jpg", VersionID: "v1", DriveID: "drive-a1"}))
+	must(w.Write(Record{State: Uploading, S3Key: "photos/a.jpg", VersionID: "v2"}))
+	must(w.Write(Record{State: Pending, S3Key: "photos/b.jpg", Error: "GLACIER, restore in progress"}))
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close() = %v", err)
+	}
+}
+
+func TestWriteAndLoad(t *testing.T) {
+	dir := t.TempDir()
+	writeRun(t, dir)
+
+	replay, err := Load(dir, "run1")
+	if err != nil {
+		t.Fatalf("Load() = %v", err)
+	}
+	if replay.Run.Prefix != "photos/" || !replay.Run.AllVersions {
+		t.Errorf("Run = %+v", replay.Run)
+	}
+	want := []struct {
+		key, version string
+		state        State
+		driveID      string
+	}{
+		{"photos/a.jpg", "v1", Done, "drive-a1"},
+		{"photos/a.jpg", "v2", Uploading, ""},
+		{"photos/b.jpg", "", Pending, ""},
+		{"photos/c.jpg", "", Queued, ""},
+	}
+	if len(replay.Files) != len(want) {
+		t.Fatalf("Files = %+v", replay.Files)
+	}
+	for i, w := range want {
+		f := replay.Files[i]
+		if f.S3Key != w.key || f.VersionID != w.version || f.State != w.state || f.DriveID != w.driveID {
+			t.Errorf("Files[%d] = %+v, want %+v", i, f, w)
+		}
+	}
+	// The queued object survives later transitions
+	if f := replay.Files[1]; f.ETag != "e2" || f.Size != 11 || !f.LastModified.Equal(time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)) {
+		t.Errorf("Files[1] lost its object: %+v", f)
+	}
+	if f := replay.Files[2]; f.StorageClass != "GLACIER" || f.Error != "GLACIER, restore in progress" {
+		t.Errorf("Files[2] = %+v", f)
+	}
+}
+
+func TestResumeAfterTornRecord(t *testing.T) {
+	dir := t.TempDir()
+	writeRun(t, dir)
+	f, err := os.OpenFile(Path(dir, "run1"), os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"time":"2026-01-02T03:04:05Z","state":"done","s3_key":"photos/a.j`)
+	f.Close()
+
+	if _, err := Load(dir, "run1"); err != nil {
+		t.Fatalf("Load() with a torn last record = %v", err)
+	}
+
+	w, err := Append(dir, "run1")
+	if err != nil {
+		t.Fatalf("Append() = %v", err)
+	}
+	w.Write(Record{State: Resumed, Run: &Run{ID: "run1"}})
+	w.Write(Record{State: Done, S3Key: "photos/c.jpg", DriveID: "drive-c"})
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close() = %v", err)
+	}
+
+	replay, err := Load(dir, "run1")
+	if err != nil {
+		t.Fatalf("Load() after resume = %v", err)
+	}
+	if f := replay.Files[3]; f.State != Done || f.DriveID != "drive-c" {
+		t.Errorf("Files[3] = %+v, want done", f)
+	}
+}
+
+func TestLoadCorrupt(t *testing.T) {
+	data := `{"state":"started","run":{"id":"r"}}
+not json
+{"state":"queued","s3_key":"a"}
+`
+	if _, err := Read(strings.NewReader(data)); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("Read() = %v, want an error at line 2", err)
+	}
+	if _, err := Read(strings.NewReader(`{"state":"queued","s3_key":"a"}` + "\n")); err == nil {
+		t.Error("Read() accepted a journal without a started record")
+	}
+	if _, err := Read(strings.NewReader(`{"state":"started","run":{"id":"r"}}` + "\n" + `{"state":"done","s3_key":"a"}` + "\n")); err == nil {
+		t.Error("Read() accepted a record for a file that was not queued")
+	}
+}
+
+func TestCreateExisting(t *testing.T) {
+	dir := t.TempDir()
+	writeRun(t, dir)
+	if _, err := Create(dir, "run1"); !errors.Is(err, os.ErrExist) {
+		t.Errorf("Create() over an existing journal = %v, want ErrExist", err)
+	}
+}
+
+func TestInvalidRunID(t *testing.T) {
+	for _, id := range []string{"", "..", "../run1", "a/b"} {
+		if _, err := Load(t.TempDir(), id); err == nil || !strings.Contains(err.Error(), "invalid run ID") {
+			t.Errorf("Load(%q) = %v, want invalid run ID", id, err)
+		}
+	}
+}
+
+func TestNilWriter(t *testing.T) {
+	var w *Writer
+	if w.Write(Record{State: Queued}) != nil || w.Close() != nil {
+		t.Error("Nil writer returned an error")
+	}
+}
@@ -0,0 +1,91 @@
+package limiter
+
+import (
+	"context"
+	"sync"
+)
+
+// Limiter bounds the number of concurrent workers. Unlike a buffered channel
+// its limit can be changed while workers hold slots: raising it admits waiters
+// immediately, lowering it lets running workers finish and admits no one new
+// until the count drops below the new limit.
+type Limiter struct {
+	mu      sync.Mutex
+	limit   int
+	active  int
+	changed chan struct{}
+}
+
+// New returns a Limiter admitting limit workers; limits below 1 are raised to 1
+func New(limit int) *Limiter {
+	return &Limiter{limit: max(limit, 1), changed: make(chan struct{})}
+}
+
+// Acquire blocks until a slot is free or ctx is done
+func (l *Limiter) Acquire(ctx context.Context) error {
+	for {
+		l.mu.Lock()
+		if l.active < l.limit {
+			l.active++
+			l.mu.Unlock()
+			return nil
+		}
+		changed := l.changed
+		l.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Release frees a slot taken by Acquire
+func (l *Limiter) Release() {
+	l.mu.Lock()
+	l.active--
+	l.broadcast()
+	l.mu.Unlock()
+}
+
+// ForEach calls fn(i) for every i below n, running at most the limit at once.
+// When ctx is done it starts no more calls, waits for the running ones and
+// returns the cause of ctx.
+func (l *Limiter) ForEach(ctx context.Context, n int, fn func(i int)) error {
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		if err := l.Acquire(ctx); err != nil {
+			break
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer l.Release()
+			fn(i)
+		}()
+	}
+	wg.Wait()
+	return context.Cause(ctx)
+}
+
+// SetLimit changes the number of concurrent workers; limits below 1 are raised to 1
+func (l *Limiter) SetLimit(limit int) {
+	l.mu.Lock()
+	l.limit = max(limit, 1)
+	l.broadcast()
+	l.mu.Unlock()
+}
+
+// Limit returns the current limit
+func (l *Limiter) Limit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.limit
+}
+
+// broadcast wakes every waiter; callers hold mu
+func (l *Limiter) broadcast() {
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
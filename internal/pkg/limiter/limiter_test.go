@@ -0,0 +1,123 @@
+package limiter
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLimiterBoundsConcurrency(t *testing.T) {
+	l := New(2)
+	var running, peak atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := l.Acquire(context.Background()); err != nil {
+				t.Error(err)
+				return
+			}
+			defer l.Release()
+			n := running.Add(1)
+			for {
+				p := peak.Load()
+				if n <= p || peak.CompareAndSwap(p, n) {
+					break
+				}
+			}
+			time.Sleep(5 * time.Millisecond)
+			running.Add(-1)
+		}()
+	}
+	wg.Wait()
+	if peak.Load() > 2 {
+		t.Errorf("peak concurrency = %d, want <= 2", peak.Load())
+	}
+}
+
+func TestLimiterSetLimit(t *testing.T) {
+	l := New(1)
+	ctx := context.Background()
+	if err := l.Acquire(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	acquired := make(chan struct{})
+	go func() {
+		if err := l.Acquire(ctx); err == nil {
+			close(acquired)
+		}
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("second Acquire succeeded above the limit")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	l.SetLimit(2)
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("raising the limit did not admit the waiter")
+	}
+
+	// Lowering below the active count admits no one until enough slots are released
+	l.SetLimit(1)
+	waitCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	l.Release()
+	if err := l.Acquire(waitCtx); err == nil {
+		t.Error("Acquire succeeded while active workers still exceed the lowered limit")
+	}
+	l.Release()
+	if err := l.Acquire(ctx); err != nil {
+		t.Errorf("Acquire after releases failed: %v", err)
+	}
+}
+
+func TestLimiterMinimum(t *testing.T) {
+	if got := New(0).Limit(); got != 1 {
+		t.Errorf("New(0).Limit() = %d, want 1", got)
+	}
+}
+
+func TestForEachStopsWhenCancelled(t *testing.T) {
+	l := New(2)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var calls atomic.Int32
+	err := l.ForEach(ctx, 100, func(i int) {
+		if calls.Add(1) == 3 {
+			cancel()
+		}
+		time.Sleep(time.Millisecond)
+	})
+	if err != context.Canceled {
+		t.Errorf("ForEach() error = %v, want context.Canceled", err)
+	}
+	if n := calls.Load(); n >= 100 {
+		t.Errorf("ForEach() made %d calls after cancel", n)
+	}
+	// Calls that never took a slot must not release one
+	l.mu.Lock()
+	active := l.active
+	l.mu.Unlock()
+	if active != 0 {
+		t.Errorf("active = %d after ForEach, want 0", active)
+	}
+}
+
+func TestForEachRunsAll(t *testing.T) {
+	l := New(3)
+	var calls atomic.Int32
+	if err := l.ForEach(context.Background(), 20, func(int) { calls.Add(1) }); err != nil {
+		t.Fatalf("ForEach() error = %v", err)
+	}
+	if calls.Load() != 20 {
+		t.Errorf("calls = %d, want 20", calls.Load())
+	}
+}
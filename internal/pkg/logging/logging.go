@@ -0,0 +1,81 @@
+// Package logging builds the structured logger shared by the S3, Drive and
+// Google auth managers and names the attributes they log.
+package logging
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+)
+
+// Attribute keys used across packages, so logs can be queried by field
+const (
+	KeyRunID    = "run_id"
+	KeyS3Key    = "s3_key"
+	KeyDriveID  = "drive_id"
+	KeyBytes    = "bytes"
+	KeyDuration = "duration"
+	KeyAttempt  = "attempt"
+	KeyError    = "error"
+)
+
+// New returns a logger writing records in format at level or above to w, as
+// named by the Log config section. Empty names default to info and text.
+// It does not import configs, so configs can log with Err and the keys above.
+func New(w io.Writer, level, format string) (*slog.Logger, error) {
+	lvl, err := ParseLevel(level)
+	if err != nil {
+		return nil, err
+	}
+	opts := &slog.HandlerOptions{Level: lvl}
+	switch format {
+	case "", "text":
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	default:
+		return nil, fmt.Errorf("unknown log format %q", format)
+	}
+}
+
+// ParseLevel converts a configs.LogLevel* name to a slog level
+func ParseLevel(name string) (slog.Level, error) {
+	switch name {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "", "info":
+		return slog.LevelInfo, nil
+	case "warn":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	default:
+		return slog.LevelInfo, fmt.Errorf("unknown log level %q", name)
+	}
+}
+
+// NewRunID returns a random identifier tying together the logs of one run
+func NewRunID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// OrDefault returns l, or slog.Default() when l is nil, so managers built
+// without a logger still log
+func OrDefault(l *slog.Logger) *slog.Logger {
+	if l == nil {
+		return slog.Default()
+	}
+	return l
+}
+
+// Err is the error attribute; nil errors are omitted from the record
+func Err(err error) slog.Attr {
+	if err == nil {
+		return slog.Attr{}
+	}
+	return slog.Any(KeyError, err)
+}
@@ -0,0 +1,85 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewJSON(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(&buf, "info", "json")
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	logger.Debug("hidden")
+	logger.With(KeyRunID, "abc").Info("Upload completed",
+		KeyS3Key, "a/b.txt", KeyBytes, int64(42), KeyDuration, 1500*time.Millisecond, Err(errors.New("boom")))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("Got %d records, want 1 (debug filtered):\n%s", len(lines), buf.String())
+	}
+	var rec map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &rec); err != nil {
+		t.Fatalf("Record is not JSON: %v", err)
+	}
+	want := map[string]any{"msg": "Upload completed", KeyRunID: "abc", KeyS3Key: "a/b.txt", KeyBytes: 42.0, KeyError: "boom"}
+	for k, v := range want {
+		if rec[k] != v {
+			t.Errorf("%s = %v, want %v", k, rec[k], v)
+		}
+	}
+}
+
+func TestNewText(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(&buf, "debug", "")
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	logger.Debug("Folder created", KeyDriveID, "f1", Err(nil))
+
+	out := buf.String()
+	if !strings.Contains(out, "level=DEBUG") || !strings.Contains(out, "drive_id=f1") {
+		t.Errorf("Unexpected text record: %s", out)
+	}
+	if strings.Contains(out, "error") {
+		t.Errorf("nil error should be omitted: %s", out)
+	}
+}
+
+func TestNewInvalid(t *testing.T) {
+	if _, err := New(&bytes.Buffer{}, "verbose", ""); err == nil {
+		t.Error("New accepted an unknown level")
+	}
+	if _, err := New(&bytes.Buffer{}, "", "xml"); err == nil {
+		t.Error("New accepted an unknown format")
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	cases := map[string]slog.Level{
+		"":      slog.LevelInfo,
+		"debug": slog.LevelDebug,
+		"warn":  slog.LevelWarn,
+		"error": slog.LevelError,
+	}
+	for name, want := range cases {
+		if got, err := ParseLevel(name); err != nil || got != want {
+			t.Errorf("ParseLevel(%q) = %v, %v, want %v", name, got, err, want)
+		}
+	}
+}
+
+func TestNewRunID(t *testing.T) {
+	a, b := NewRunID(), NewRunID()
+	if len(a) != 16 || a == b {
+		t.Errorf("NewRunID = %q, %q; want distinct 16-char IDs", a, b)
+	}
+}
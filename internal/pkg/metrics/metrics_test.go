@@ -0,0 +1,205 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/vincent119/s3syncgoogledrive/internal/pkg/errs"
+)
+
+func writeText(t *testing.T, r *Registry) string {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := r.WriteText(&buf); err != nil {
+		t.Fatalf("WriteText() = %v", err)
+	}
+	return buf.String()
+}
+
+func TestWriteText(t *testing.T) {
+	r := NewRegistry()
+	calls := r.NewCounter("calls_total", "API calls.", "method", "status")
+	inFlight := r.NewGauge("in_flight", "Running.")
+	r.NewCounter("idle_total", "Never incremented.")
+
+	calls.Inc("files.list", "200")
+	calls.Add(2, "files.create", "403")
+	calls.Inc("files.list", "200")
+	calls.Add(-5, "files.list", "200")
+	inFlight.Add(3)
+	inFlight.Add(-1)
+
+	want := `# HELP calls_total API calls.
+# TYPE calls_total counter
+calls_total{method="files.create",status="403"} 2
+calls_total{method="files.list",status="200"} 2
+# HELP in_flight Running.
+# TYPE in_flight gauge
+in_flight 2
+# HELP idle_total Never incremented.
+# TYPE idle_total counter
+idle_total 0
+`
+	if got := writeText(t, r); got != want {
+		t.Errorf("WriteText() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	r := NewRegistry()
+	h := r.NewHistogram("upload_seconds", "Uploads.", []float64{10, 1}, "kind")
+	for _, v := range []float64{0.5, 1, 7, 42} {
+		h.Observe(v, "video")
+	}
+
+	want := `# HELP upload_seconds Uploads.
+# TYPE upload_seconds histogram
+upload_seconds_bucket{kind="video",le="1"} 2
+upload_seconds_bucket{kind="video",le="10"} 3
+upload_seconds_bucket{kind="video",le="+Inf"} 4
+upload_seconds_sum{kind="video"} 50.5
+upload_seconds_count{kind="video"} 4
+`
+	if got := writeText(t, r); got != want {
+		t.Errorf("WriteText() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestEscaping(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounter("c_total", "Line one\nback\\slash", "key").Inc("a \"quoted\"\nkey\\")
+
+	got := writeText(t, r)
+	if !strings.Contains(got, `# HELP c_total Line one\nback\\slash`) {
+		t.Errorf("Help not escaped:\n%s", got)
+	}
+	if !strings.Contains(got, `c_total{key="a \"quoted\"\nkey\\"} 1`) {
+		t.Errorf("Label value not escaped:\n%s", got)
+	}
+}
+
+func TestConcurrentUpdates(t *testing.T) {
+	r := NewRegistry()
+	c := r.NewCounter("c_total", "Counter.", "worker")
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			c.Inc(fmt.Sprint(i % 2))
+		}(i)
+	}
+	wg.Wait()
+
+	got := writeText(t, r)
+	if !strings.Contains(got, `c_total{worker="0"} 25`) || !strings.Contains(got, `c_total{worker="1"} 25`) {
+		t.Errorf("WriteText() =\n%s", got)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounter("c_total", "Counter.").Inc()
+
+	rec := httptest.NewRecorder()
+	r.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); ct != ContentType {
+		t.Errorf("Content-Type = %q, want %q", ct, ContentType)
+	}
+	if !strings.Contains(rec.Body.String(), "c_total 1\n") {
+		t.Errorf("Body = %q", rec.Body.String())
+	}
+}
+
+func TestPush(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounter("c_total", "Counter.").Inc()
+
+	var gotMethod, gotPath, gotBody string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		gotMethod, gotPath = req.Method, req.URL.EscapedPath()
+		body, _ := io.ReadAll(req.Body)
+		gotBody = string(body)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	if err := r.Push(context.Background(), server.Client(), server.URL+"/", "nightly sync"); err != nil {
+		t.Fatalf("Push() = %v", err)
+	}
+	if gotMethod != http.MethodPut || gotPath != "/metrics/job/nightly%20sync" {
+		t.Errorf("Request = %s %s, want PUT /metrics/job/nightly%%20sync", gotMethod, gotPath)
+	}
+	if !strings.Contains(gotBody, "c_total 1\n") {
+		t.Errorf("Body = %q", gotBody)
+	}
+}
+
+func TestPushError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		http.Error(w, "bad metric", http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	err := NewRegistry().Push(context.Background(), server.Client(), server.URL, "s3sync")
+	if err == nil || !strings.Contains(err.Error(), "bad metric") {
+		t.Errorf("Push() = %v, want the gateway's error", err)
+	}
+}
+
+func TestSync(t *testing.T) {
+	m := NewSync()
+	m.File("uploaded", 100)
+	m.File("uploaded", 50)
+	m.Failure(errs.Wrap(errs.ErrQuota, "upload", errors.New("full")))
+	m.Failure(errors.New("boom"))
+	m.DriveCall("files.list", "200")
+	m.S3Call("HeadObject", StatusError)
+	m.Retry("files.list")
+	m.RateLimitWait(2 * time.Second)
+	done := m.StartTransfer()
+	m.StartTransfer()()
+	m.UploadDuration(3 * time.Second)
+
+	got := writeText(t, m.Registry)
+	for _, line := range []string{
+		`s3sync_files_total{status="uploaded"} 2`,
+		`s3sync_bytes_total{status="uploaded"} 150`,
+		`s3sync_failures_total{reason="quota"} 1`,
+		`s3sync_failures_total{reason="other"} 1`,
+		`s3sync_drive_api_calls_total{method="files.list",status="200"} 1`,
+		`s3sync_s3_api_calls_total{operation="HeadObject",status="error"} 1`,
+		`s3sync_retries_total{operation="files.list"} 1`,
+		`s3sync_rate_limit_waits_total 1`,
+		`s3sync_rate_limit_wait_seconds_total 2`,
+		`s3sync_transfers_in_flight 1`,
+		`s3sync_upload_duration_seconds_bucket{le="5"} 1`,
+		`s3sync_upload_duration_seconds_count 1`,
+	} {
+		if !strings.Contains(got, line+"\n") {
+			t.Errorf("Missing %q in:\n%s", line, got)
+		}
+	}
+	done()
+}
+
+func TestNilSync(t *testing.T) {
+	var m *Sync
+	m.File("uploaded", 1)
+	m.Failure(errors.New("boom"))
+	m.DriveCall("files.list", "200")
+	m.S3Call("HeadObject", "200")
+	m.Retry("files.list")
+	m.RateLimitWait(time.Second)
+	m.StartTransfer()()
+	m.UploadDuration(time.Second)
+}
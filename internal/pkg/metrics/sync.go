@@ -0,0 +1,141 @@
+package metrics
+
+import (
+	"errors"
+	"time"
+
+	"github.com/vincent119/s3syncgoogledrive/internal/pkg/errs"
+)
+
+// StatusError is the status label of API calls that got no HTTP response
+const StatusError = "error"
+
+// UploadDurationBuckets are the upper bounds, in seconds, of the upload duration histogram
+var UploadDurationBuckets = []float64{1, 5, 15, 30, 60, 300, 900, 1800, 3600, 3 * 3600, 6 * 3600}
+
+// Sync holds the metrics recorded by the S3 and Drive managers and the sync
+// loop. Every method is a no-op on a nil *Sync, so managers record
+// unconditionally and callers that do not serve metrics leave the field nil.
+type Sync struct {
+	Registry *Registry
+
+	files          *Counter
+	bytes          *Counter
+	failures       *Counter
+	driveCalls     *Counter
+	s3Calls        *Counter
+	retries        *Counter
+	rateLimitWaits *Counter
+	rateLimitWait  *Counter
+	inFlight       *Gauge
+	uploadDuration *Histogram
+}
+
+// NewSync registers the sync metrics in a new Registry
+func NewSync() *Sync {
+	r := NewRegistry()
+	return &Sync{
+		Registry:       r,
+		files:          r.NewCounter("s3sync_files_total", "Files processed, by outcome.", "status"),
+		bytes:          r.NewCounter("s3sync_bytes_total", "Bytes of the files processed, by outcome.", "status"),
+		failures:       r.NewCounter("s3sync_failures_total", "Files that failed, by error reason.", "reason"),
+		driveCalls:     r.NewCounter("s3sync_drive_api_calls_total", "Google Drive API calls, by method and HTTP status.", "method", "status"),
+		s3Calls:        r.NewCounter("s3sync_s3_api_calls_total", "S3 API calls, by operation and HTTP status.", "operation", "status"),
+		retries:        r.NewCounter("s3sync_retries_total", "Retried API calls, by operation.", "operation"),
+		rateLimitWaits: r.NewCounter("s3sync_rate_limit_waits_total", "Backoffs after a rate-limited API call."),
+		rateLimitWait:  r.NewCounter("s3sync_rate_limit_wait_seconds_total", "Time spent backing off after rate-limited API calls."),
+		inFlight:       r.NewGauge("s3sync_transfers_in_flight", "Uploads currently streaming from S3 to Drive."),
+		uploadDuration: r.NewHistogram("s3sync_upload_duration_seconds", "Duration of successful uploads.", UploadDurationBuckets),
+	}
+}
+
+// File records one file finished with status (a report status such as uploaded or skipped)
+func (m *Sync) File(status string, bytes int64) {
+	if m == nil {
+		return
+	}
+	m.files.Inc(status)
+	m.bytes.Add(float64(bytes), status)
+}
+
+// Failure records a failed file under the reason of its errs kind
+func (m *Sync) Failure(err error) {
+	if m == nil {
+		return
+	}
+	m.failures.Inc(Reason(err))
+}
+
+// DriveCall records a Drive API call; status is the HTTP status code or StatusError
+func (m *Sync) DriveCall(method, status string) {
+	if m == nil {
+		return
+	}
+	m.driveCalls.Inc(method, status)
+}
+
+// S3Call records an S3 API call; status is the HTTP status code or StatusError
+func (m *Sync) S3Call(operation, status string) {
+	if m == nil {
+		return
+	}
+	m.s3Calls.Inc(operation, status)
+}
+
+// Retry records that operation is tried again
+func (m *Sync) Retry(operation string) {
+	if m == nil {
+		return
+	}
+	m.retries.Inc(operation)
+}
+
+// RateLimitWait records a backoff of d after a rate-limited call
+func (m *Sync) RateLimitWait(d time.Duration) {
+	if m == nil {
+		return
+	}
+	m.rateLimitWaits.Inc()
+	m.rateLimitWait.Add(d.Seconds())
+}
+
+// StartTransfer marks an upload in flight until the returned func is called
+func (m *Sync) StartTransfer() (done func()) {
+	if m == nil {
+		return func() {}
+	}
+	m.inFlight.Add(1)
+	return func() { m.inFlight.Add(-1) }
+}
+
+// UploadDuration records the duration of a successful upload
+func (m *Sync) UploadDuration(d time.Duration) {
+	if m == nil {
+		return
+	}
+	m.uploadDuration.Observe(d.Seconds())
+}
+
+// reasons names the errs kinds in label values
+var reasons = []struct {
+	kind   error
+	reason string
+}{
+	{errs.ErrAuth, "auth"},
+	{errs.ErrPermission, "permission"},
+	{errs.ErrNotFound, "not_found"},
+	{errs.ErrQuota, "quota"},
+	{errs.ErrRateLimit, "rate_limit"},
+	{errs.ErrUnavailable, "unavailable"},
+	{errs.ErrInvalid, "invalid"},
+}
+
+// Reason returns the failures_total reason label of err: its errs kind, or "other"
+func Reason(err error) string {
+	for _, r := range reasons {
+		if errors.Is(err, r.kind) {
+			return r.reason
+		}
+	}
+	return "other"
+}
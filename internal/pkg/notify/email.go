@@ -0,0 +1,109 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/vincent119/s3syncgoogledrive/internal/configs"
+)
+
+// Email sends the message as a plain text mail through an SMTP server,
+// upgrading to TLS with STARTTLS when the server offers it
+type Email struct {
+	SMTP    configs.SMTPConfig
+	Subject *template.Template
+	Text    *template.Template
+	// TLSConfig is used for STARTTLS (default: verify SMTP.host)
+	TLSConfig *tls.Config
+}
+
+// Notify implements Notifier
+func (e *Email) Notify(ctx context.Context, msg Message) error {
+	subject, err := render(e.Subject, msg)
+	if err != nil {
+		return err
+	}
+	text, err := render(e.Text, msg)
+	if err != nil {
+		return err
+	}
+	return e.send(ctx, e.compose(subject, text))
+}
+
+// compose builds the RFC 5322 mail
+func (e *Email) compose(subject, text string) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", e.SMTP.From)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(e.SMTP.To, ", "))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", strings.TrimSpace(subject)))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: 8bit\r\n\r\n")
+	buf.WriteString(strings.ReplaceAll(strings.ReplaceAll(text, "\r\n", "\n"), "\n", "\r\n"))
+	buf.WriteString("\r\n")
+	return buf.Bytes()
+}
+
+// send is smtp.SendMail bounded by ctx
+func (e *Email) send(ctx context.Context, mail []byte) error {
+	host := e.SMTP.Host
+	addr := net.JoinHostPort(host, strconv.Itoa(e.SMTP.ResolvedPort()))
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		cfg := e.TLSConfig
+		if cfg == nil {
+			cfg = &tls.Config{ServerName: host}
+		}
+		if err := c.StartTLS(cfg); err != nil {
+			return fmt.Errorf("starttls: %w", err)
+		}
+	}
+	if e.SMTP.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", e.SMTP.Username, e.SMTP.Password, host)); err != nil {
+			return fmt.Errorf("auth: %w", err)
+		}
+	}
+	if err := c.Mail(e.SMTP.From); err != nil {
+		return err
+	}
+	for _, to := range e.SMTP.To {
+		if err := c.Rcpt(to); err != nil {
+			return fmt.Errorf("recipient %s: %w", to, err)
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(mail); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
@@ -0,0 +1,225 @@
+// Package notify tells Slack, Microsoft Teams, generic JSON webhooks and email
+// recipients when a sync run starts, succeeds or fails.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/vincent119/s3syncgoogledrive/internal/configs"
+	"github.com/vincent119/s3syncgoogledrive/internal/pkg/report"
+)
+
+// Event is the point of a run a message is sent at
+type Event string
+
+const (
+	// Start is sent once the run has its configuration and run ID
+	Start Event = configs.NotifyOnStart
+	// Success is sent when every file was copied, skipped or is pending a restore
+	Success Event = configs.NotifyOnSuccess
+	// Failure is sent when a file failed or the run stopped early
+	Failure Event = configs.NotifyOnFailure
+)
+
+// Message is a run event and the data its templates are rendered with
+type Message struct {
+	Event  Event  `json:"event"`
+	RunID  string `json:"run_id"`
+	Prefix string `json:"prefix"`
+	// Error is the error the run ended with, if any
+	Error string `json:"error,omitempty"`
+	// Report is the finished run; nil at Start or when the run failed before listing files
+	Report *report.Report `json:"report,omitempty"`
+}
+
+// Count returns the files and bytes with status, e.g. "uploaded"
+func (m Message) Count(status string) report.Count {
+	if m.Report == nil {
+		return report.Count{}
+	}
+	return m.Report.Counts[report.Status(status)]
+}
+
+// Failures returns at most n failed files
+func (m Message) Failures(n int) []report.Entry {
+	if m.Report == nil {
+		return nil
+	}
+	if len(m.Report.Failures) < n {
+		return m.Report.Failures
+	}
+	return m.Report.Failures[:n]
+}
+
+// DefaultTemplate is the message of a channel without a template
+const DefaultTemplate = `s3sync run {{.RunID}} {{if eq .Event "start"}}started{{else if eq .Event "failure"}}failed{{else}}succeeded{{end}} for {{.Prefix}}
+{{- with .Report}} in {{duration .Duration}}{{end}}
+{{- if .Report}}
+Uploaded {{(.Count "uploaded").Files}} ({{bytes (.Count "uploaded").Bytes}}), skipped {{(.Count "skipped").Files}}, pending restore {{(.Count "pending_restore").Files}}, failed {{(.Count "failed").Files}}
+{{- end}}
+{{- if .Error}}
+Error: {{.Error}}
+{{- end}}
+{{- range .Failures 5}}
+- {{.S3Key}}: {{.Reason}}
+{{- end}}`
+
+// DefaultSubject is the subject of an email channel without one
+const DefaultSubject = `[s3sync] {{.Prefix}} {{.Event}} ({{.RunID}})`
+
+// funcs are available to every template
+var funcs = template.FuncMap{
+	"bytes":    report.FormatBytes,
+	"duration": func(d time.Duration) time.Duration { return d.Round(time.Second) },
+}
+
+func parse(name, text, fallback string) (*template.Template, error) {
+	if text == "" {
+		text = fallback
+	}
+	t, err := template.New(name).Funcs(funcs).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("%s template: %w", name, err)
+	}
+	return t, nil
+}
+
+func render(t *template.Template, msg Message) (string, error) {
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, msg); err != nil {
+		return "", fmt.Errorf("render %s template: %w", t.Name(), err)
+	}
+	return buf.String(), nil
+}
+
+// Notifier delivers a message to one channel
+type Notifier interface {
+	Notify(ctx context.Context, msg Message) error
+}
+
+// channel is a notifier and the events it is sent
+type channel struct {
+	name     string
+	on       []string
+	notifier Notifier
+}
+
+func (c channel) accepts(event Event) bool {
+	if len(c.on) == 0 {
+		return true
+	}
+	for _, e := range c.on {
+		if Event(e) == event {
+			return true
+		}
+	}
+	return false
+}
+
+// Dispatcher sends run events to every configured channel that wants them
+type Dispatcher struct {
+	channels []channel
+}
+
+// New builds the channels in cfgs. HTTP channels use client, or
+// http.DefaultClient when it is nil.
+func New(cfgs []configs.NotifierConfig, client *http.Client) (*Dispatcher, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	d := &Dispatcher{}
+	for _, cfg := range cfgs {
+		n, err := newNotifier(cfg, client)
+		if err != nil {
+			return nil, fmt.Errorf("notifier %s: %w", cfg.ResolvedName(), err)
+		}
+		d.channels = append(d.channels, channel{name: cfg.ResolvedName(), on: cfg.On, notifier: n})
+	}
+	return d, nil
+}
+
+func newNotifier(cfg configs.NotifierConfig, client *http.Client) (Notifier, error) {
+	text, err := parse("message", cfg.Template, DefaultTemplate)
+	if err != nil {
+		return nil, err
+	}
+	switch cfg.Type {
+	case configs.NotifierTypeSlack:
+		return &Slack{URL: cfg.URL, Client: client, Text: text}, nil
+	case configs.NotifierTypeTeams:
+		return &Teams{URL: cfg.URL, Client: client, Text: text}, nil
+	case configs.NotifierTypeWebhook:
+		return &Webhook{URL: cfg.URL, Secret: cfg.Secret, Client: client, Text: text}, nil
+	case configs.NotifierTypeEmail:
+		subject, err := parse("subject", cfg.Subject, DefaultSubject)
+		if err != nil {
+			return nil, err
+		}
+		return &Email{SMTP: cfg.SMTP, Subject: subject, Text: text}, nil
+	default:
+		return nil, fmt.Errorf("unknown type %q", cfg.Type)
+	}
+}
+
+// Len is the number of channels
+func (d *Dispatcher) Len() int {
+	if d == nil {
+		return 0
+	}
+	return len(d.channels)
+}
+
+// Notify sends msg to the channels accepting its event, in parallel, and
+// returns the errors of the channels that could not be reached
+func (d *Dispatcher) Notify(ctx context.Context, msg Message) error {
+	if d == nil {
+		return nil
+	}
+	var wg sync.WaitGroup
+	errs := make([]error, len(d.channels))
+	for i, c := range d.channels {
+		if !c.accepts(msg.Event) {
+			continue
+		}
+		wg.Add(1)
+		go func(i int, c channel) {
+			defer wg.Done()
+			if err := c.notifier.Notify(ctx, msg); err != nil {
+				errs[i] = fmt.Errorf("notify %s: %w", c.name, err)
+			}
+		}(i, c)
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// post sends body to url and fails on a non-2xx answer
+func post(ctx context.Context, client *http.Client, url, contentType string, body []byte, header http.Header) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", contentType)
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("unexpected status %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
@@ -0,0 +1,334 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/vincent119/s3syncgoogledrive/internal/configs"
+	"github.com/vincent119/s3syncgoogledrive/internal/pkg/report"
+)
+
+// request is a call received by a stand-in webhook
+type request struct {
+	header http.Header
+	body   []byte
+}
+
+// newHook starts a stand-in webhook answering with status and recording requests
+func newHook(t *testing.T, status int) (*httptest.Server, func() []request) {
+	t.Helper()
+	var mu sync.Mutex
+	var got []request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		got = append(got, request{header: r.Header, body: body})
+		mu.Unlock()
+		w.WriteHeader(status)
+		if status != http.StatusOK {
+			w.Write([]byte("invalid_payload"))
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, func() []request {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]request{}, got...)
+	}
+}
+
+func finished(failed bool) Message {
+	rep := &report.Report{
+		RunID:      "run-1",
+		Prefix:     "photos/",
+		StartedAt:  time.Date(2026, 1, 2, 3, 0, 0, 0, time.UTC),
+		FinishedAt: time.Date(2026, 1, 2, 3, 2, 5, 400, time.UTC),
+		Counts: map[report.Status]report.Count{
+			report.Uploaded: {Files: 3, Bytes: 3 << 20},
+			report.Skipped:  {Files: 7, Bytes: 1024},
+		},
+	}
+	msg := Message{Event: Success, RunID: "run-1", Prefix: "photos/", Report: rep}
+	if failed {
+		rep.Counts[report.Failed] = report.Count{Files: 1, Bytes: 10}
+		rep.Failures = []report.Entry{{S3Key: "photos/a.jpg", Reason: "quota exceeded"}}
+		msg.Event = Failure
+		msg.Error = "1 of 11 files failed"
+	}
+	return msg
+}
+
+func TestDefaultTemplate(t *testing.T) {
+	tmpl, err := parse("message", "", DefaultTemplate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		msg  Message
+		want string
+	}{
+		{"start", Message{Event: Start, RunID: "run-1", Prefix: "photos/"}, "s3sync run run-1 started for photos/"},
+		{"success", finished(false), "s3sync run run-1 succeeded for photos/ in 2m5s\n" +
+			"Uploaded 3 (3.0 MiB), skipped 7, pending restore 0, failed 0"},
+		{"failure", finished(true), "s3sync run run-1 failed for photos/ in 2m5s\n" +
+			"Uploaded 3 (3.0 MiB), skipped 7, pending restore 0, failed 1\n" +
+			"Error: 1 of 11 files failed\n" +
+			"- photos/a.jpg: quota exceeded"},
+		{"failure before listing", Message{Event: Failure, RunID: "run-1", Prefix: "photos/", Error: "access denied"},
+			"s3sync run run-1 failed for photos/\nError: access denied"},
+	}
+	for _, tt := range tests {
+		got, err := render(tmpl, tt.msg)
+		if err != nil {
+			t.Fatalf("%s: render() = %v", tt.name, err)
+		}
+		if got != tt.want {
+			t.Errorf("%s: render() =\n%s\nwant\n%s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSlackAndTeams(t *testing.T) {
+	slack, slackGot := newHook(t, http.StatusOK)
+	teams, teamsGot := newHook(t, http.StatusOK)
+	d, err := New([]configs.NotifierConfig{
+		{Type: configs.NotifierTypeSlack, URL: slack.URL, Template: "{{.Event}} {{.RunID}}"},
+		{Type: configs.NotifierTypeTeams, URL: teams.URL},
+	}, nil)
+	if err != nil {
+		t.Fatalf("New() = %v", err)
+	}
+	if err := d.Notify(context.Background(), finished(true)); err != nil {
+		t.Fatalf("Notify() = %v", err)
+	}
+
+	var slackBody struct{ Text string }
+	if reqs := slackGot(); len(reqs) != 1 || json.Unmarshal(reqs[0].body, &slackBody) != nil || slackBody.Text != "failure run-1" {
+		t.Errorf("Slack got %+v", reqs)
+	}
+
+	var card struct {
+		Type        string
+		Attachments []struct {
+			ContentType string
+			Content     struct {
+				Type string
+				Body []struct{ Text, Color string }
+			}
+		}
+	}
+	reqs := teamsGot()
+	if len(reqs) != 1 || json.Unmarshal(reqs[0].body, &card) != nil || len(card.Attachments) != 1 {
+		t.Fatalf("Teams got %+v", reqs)
+	}
+	content := card.Attachments[0].Content
+	if card.Type != "message" || content.Type != "AdaptiveCard" || len(content.Body) != 1 {
+		t.Fatalf("Teams card = %+v", card)
+	}
+	if !strings.HasPrefix(content.Body[0].Text, "s3sync run run-1 failed") || content.Body[0].Color != "attention" {
+		t.Errorf("Teams text = %q, color %q", content.Body[0].Text, content.Body[0].Color)
+	}
+}
+
+func TestWebhookSignature(t *testing.T) {
+	hook, got := newHook(t, http.StatusOK)
+	d, err := New([]configs.NotifierConfig{
+		{Type: configs.NotifierTypeWebhook, URL: hook.URL, Secret: "s3cret"},
+	}, hook.Client())
+	if err != nil {
+		t.Fatalf("New() = %v", err)
+	}
+	if err := d.Notify(context.Background(), finished(false)); err != nil {
+		t.Fatalf("Notify() = %v", err)
+	}
+
+	reqs := got()
+	if len(reqs) != 1 {
+		t.Fatalf("Webhook got %d requests, want 1", len(reqs))
+	}
+	req := reqs[0]
+	if sig := req.header.Get(SignatureHeader); sig != Sign("s3cret", req.body) {
+		t.Errorf("%s = %q, want %q", SignatureHeader, sig, Sign("s3cret", req.body))
+	}
+	if event := req.header.Get(EventHeader); event != "success" {
+		t.Errorf("%s = %q, want success", EventHeader, event)
+	}
+	var payload struct {
+		Event  string
+		RunID  string `json:"run_id"`
+		Text   string
+		Report struct {
+			Counts map[string]report.Count
+		}
+	}
+	if err := json.Unmarshal(req.body, &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.Event != "success" || payload.RunID != "run-1" || payload.Report.Counts["uploaded"].Files != 3 {
+		t.Errorf("Payload = %+v", payload)
+	}
+	if !strings.HasPrefix(payload.Text, "s3sync run run-1 succeeded") {
+		t.Errorf("Text = %q", payload.Text)
+	}
+}
+
+func TestWebhookUnsigned(t *testing.T) {
+	hook, got := newHook(t, http.StatusOK)
+	d, _ := New([]configs.NotifierConfig{{Type: configs.NotifierTypeWebhook, URL: hook.URL}}, nil)
+	d.Notify(context.Background(), Message{Event: Start, RunID: "run-1"})
+	if reqs := got(); len(reqs) != 1 || reqs[0].header.Get(SignatureHeader) != "" {
+		t.Errorf("Webhook got %+v, want one unsigned request", reqs)
+	}
+}
+
+func TestFilter(t *testing.T) {
+	onFailure, failureGot := newHook(t, http.StatusOK)
+	always, alwaysGot := newHook(t, http.StatusOK)
+	d, _ := New([]configs.NotifierConfig{
+		{Type: configs.NotifierTypeSlack, URL: onFailure.URL, On: []string{configs.NotifyOnFailure}},
+		{Type: configs.NotifierTypeSlack, URL: always.URL},
+	}, nil)
+
+	for _, msg := range []Message{{Event: Start}, finished(false), finished(true)} {
+		if err := d.Notify(context.Background(), msg); err != nil {
+			t.Fatalf("Notify(%s) = %v", msg.Event, err)
+		}
+	}
+	if n := len(failureGot()); n != 1 {
+		t.Errorf("Failure-only channel got %d messages, want 1", n)
+	}
+	if n := len(alwaysGot()); n != 3 {
+		t.Errorf("Unfiltered channel got %d messages, want 3", n)
+	}
+}
+
+func TestNotifyError(t *testing.T) {
+	broken, _ := newHook(t, http.StatusBadRequest)
+	ok, got := newHook(t, http.StatusOK)
+	d, _ := New([]configs.NotifierConfig{
+		{Name: "ops-slack", Type: configs.NotifierTypeSlack, URL: broken.URL},
+		{Type: configs.NotifierTypeTeams, URL: ok.URL},
+	}, nil)
+
+	err := d.Notify(context.Background(), Message{Event: Start})
+	if err == nil || !strings.Contains(err.Error(), "notify ops-slack") || !strings.Contains(err.Error(), "invalid_payload") {
+		t.Errorf("Notify() = %v, want the ops-slack error", err)
+	}
+	if len(got()) != 1 {
+		t.Error("A failing channel stopped the others")
+	}
+}
+
+func TestNewTemplateError(t *testing.T) {
+	_, err := New([]configs.NotifierConfig{{Type: configs.NotifierTypeSlack, URL: "http://x", Template: "{{.RunID"}}, nil)
+	if err == nil || !strings.Contains(err.Error(), "notifier slack") {
+		t.Errorf("New() = %v, want a template error", err)
+	}
+}
+
+func TestNilDispatcher(t *testing.T) {
+	var d *Dispatcher
+	if d.Len() != 0 || d.Notify(context.Background(), Message{Event: Start}) != nil {
+		t.Error("Nil dispatcher did something")
+	}
+}
+
+// fakeSMTP is a stand-in mail server accepting one message without TLS or auth
+func fakeSMTP(t *testing.T) (addr string, mail <-chan string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	out := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		reply := func(line string) { io.WriteString(conn, line+"\r\n") }
+		reply("220 localhost ESMTP")
+		var transcript strings.Builder
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			transcript.WriteString(line)
+			switch cmd := strings.ToUpper(strings.TrimSpace(line)); {
+			case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+				reply("250 localhost")
+			case cmd == "DATA":
+				reply("354 go ahead")
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if line == ".\r\n" {
+						break
+					}
+					transcript.WriteString(line)
+				}
+				reply("250 queued")
+			case cmd == "QUIT":
+				reply("221 bye")
+				out <- transcript.String()
+				return
+			default:
+				reply("250 ok")
+			}
+		}
+	}()
+	return ln.Addr().String(), out
+}
+
+func TestEmail(t *testing.T) {
+	addr, mail := fakeSMTP(t)
+	host, port, _ := net.SplitHostPort(addr)
+	portNum, _ := net.LookupPort("tcp", port)
+	d, err := New([]configs.NotifierConfig{{
+		Type:    configs.NotifierTypeEmail,
+		Subject: "Sync {{.Event}} – {{.Prefix}}",
+		SMTP: configs.SMTPConfig{
+			Host: host, Port: portNum,
+			From: "s3sync@example.com", To: []string{"ops@example.com", "oncall@example.com"},
+		},
+	}}, nil)
+	if err != nil {
+		t.Fatalf("New() = %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := d.Notify(ctx, finished(true)); err != nil {
+		t.Fatalf("Notify() = %v", err)
+	}
+
+	got := <-mail
+	for _, want := range []string{
+		"MAIL FROM:<s3sync@example.com>",
+		"RCPT TO:<ops@example.com>",
+		"RCPT TO:<oncall@example.com>",
+		"To: ops@example.com, oncall@example.com\r\n",
+		"Subject: =?utf-8?q?Sync_failure_=E2=80=93_photos/?=\r\n",
+		"s3sync run run-1 failed for photos/ in 2m5s\r\n",
+		"- photos/a.jpg: quota exceeded\r\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Mail is missing %q:\n%s", want, got)
+		}
+	}
+}
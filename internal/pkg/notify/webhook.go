@@ -0,0 +1,117 @@
+package notify
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"text/template"
+)
+
+// Headers set on generic webhook requests
+const (
+	// EventHeader names the event of the request
+	EventHeader = "X-S3Sync-Event"
+	// SignatureHeader holds "sha256=" and the hex HMAC-SHA256 of the body
+	// keyed with the channel secret
+	SignatureHeader = "X-S3Sync-Signature"
+)
+
+// Slack posts the message to a Slack incoming webhook
+type Slack struct {
+	URL    string
+	Client *http.Client
+	Text   *template.Template
+}
+
+// Notify implements Notifier
+func (s *Slack) Notify(ctx context.Context, msg Message) error {
+	text, err := render(s.Text, msg)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(map[string]string{"text": text})
+	if err != nil {
+		return err
+	}
+	return post(ctx, s.Client, s.URL, "application/json", body, nil)
+}
+
+// Teams posts the message as an Adaptive Card to a Microsoft Teams incoming
+// webhook or a Workflows "when a webhook request is received" trigger
+type Teams struct {
+	URL    string
+	Client *http.Client
+	Text   *template.Template
+}
+
+// teamsColors are the Adaptive Card text colors of each event
+var teamsColors = map[Event]string{Start: "default", Success: "good", Failure: "attention"}
+
+// Notify implements Notifier
+func (t *Teams) Notify(ctx context.Context, msg Message) error {
+	text, err := render(t.Text, msg)
+	if err != nil {
+		return err
+	}
+	card := map[string]any{
+		"$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+		"type":    "AdaptiveCard",
+		"version": "1.4",
+		"body": []map[string]any{
+			{"type": "TextBlock", "text": text, "wrap": true, "color": teamsColors[msg.Event]},
+		},
+	}
+	body, err := json.Marshal(map[string]any{
+		"type": "message",
+		"attachments": []map[string]any{
+			{"contentType": "application/vnd.microsoft.card.adaptive", "content": card},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	return post(ctx, t.Client, t.URL, "application/json", body, nil)
+}
+
+// Webhook posts the message and the full run report as JSON, signed with
+// Secret when it is set
+type Webhook struct {
+	URL    string
+	Secret string
+	Client *http.Client
+	Text   *template.Template
+}
+
+// webhookPayload is the body of a generic webhook request
+type webhookPayload struct {
+	Message
+	Text string `json:"text"`
+}
+
+// Notify implements Notifier
+func (w *Webhook) Notify(ctx context.Context, msg Message) error {
+	text, err := render(w.Text, msg)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(webhookPayload{Message: msg, Text: text})
+	if err != nil {
+		return err
+	}
+	header := http.Header{EventHeader: {string(msg.Event)}}
+	if w.Secret != "" {
+		header.Set(SignatureHeader, Sign(w.Secret, body))
+	}
+	return post(ctx, w.Client, w.URL, "application/json", body, header)
+}
+
+// Sign returns the SignatureHeader value of body; receivers recompute it
+// and compare with hmac.Equal
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -7,27 +7,60 @@ import (
 )
 
 type ProgressManager struct {
-	p *mpb.Progress
+	p     *mpb.Progress
+	r     *reporter // progress lines in plain and json modes, nil otherwise
+	total *overall  // overall progress, nil in quiet mode
 }
 
 func NewProgressManager() *ProgressManager {
 	return &ProgressManager{
-		p: mpb.New(mpb.WithWidth(64)),
+		p:     mpb.New(mpb.WithWidth(64)),
+		total: newOverall(true),
 	}
 }
 
+// Wait ends the overall progress and waits for the bars; call it once every upload ended
 func (pm *ProgressManager) Wait() {
+	pm.total.stop()
 	pm.p.Wait()
+	pm.r.stop()
+}
+
+// SetTotal sets the files and bytes the overall progress counts toward
+func (pm *ProgressManager) SetTotal(files int, bytes int64) {
+	pm.total.start(pm.p, files, bytes)
+}
+
+// Done counts a finished file. The bytes of an uploaded file were counted by
+// its bar; those of a file finished without uploading are added here.
+func (pm *ProgressManager) Done(size int64, uploaded bool) {
+	pm.total.finish(size, uploaded, false)
+}
+
+// Failed counts a file that failed
+func (pm *ProgressManager) Failed() {
+	pm.total.finish(0, false, true)
+}
+
+// Discard takes the bytes an upload that failed had read through bar back out
+// of the overall progress
+func (pm *ProgressManager) Discard(bar *mpb.Bar) {
+	pm.total.discard(bar)
 }
 
 func (pm *ProgressManager) NewBar(total int64, fileName string) *mpb.Bar {
-	return pm.p.AddBar(total,
+	bar := pm.p.AddBar(total,
 		mpb.PrependDecorators(
 			decor.Name("[Uploading] "+fileName+" "),
 			decor.CountersKibiByte("% .2f / % .2f"),
 		),
 		mpb.AppendDecorators(decor.Percentage()),
+		// Finished bars leave the screen, their bytes stay in the overall bar
+		mpb.BarRemoveOnComplete(),
 	)
+	pm.total.track(bar)
+	pm.r.add(fileName, total, bar)
+	return bar
 }
 
 func (pm *ProgressManager) WrapReader(bar *mpb.Bar, r io.Reader) io.ReadCloser {
@@ -2,8 +2,10 @@ package progressReader
 
 import (
 	"bytes"
+	"encoding/json"
 	"io"
 	"testing"
+	"time"
 )
 
 func TestNewProgressManager(t *testing.T) {
@@ -63,4 +65,184 @@ func TestWrapReader(t *testing.T) {
 	wrapped.Close()
 }
 
+func TestNewJSON(t *testing.T) {
+	var out bytes.Buffer
+	pm, err := New(ModeJSON, &out, time.Millisecond)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	content := []byte("test content")
+	bar := pm.NewBar(int64(len(content)), "test.txt")
+	wrapped := pm.WrapReader(bar, bytes.NewReader(content))
+	if _, err := io.ReadAll(wrapped); err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	wrapped.Close()
+	pm.Wait()
+
+	var events []Event
+	dec := json.NewDecoder(&out)
+	for dec.More() {
+		var e Event
+		if err := dec.Decode(&e); err != nil {
+			t.Fatalf("decode event: %v", err)
+		}
+		events = append(events, e)
+	}
+	if len(events) < 2 {
+		t.Fatalf("got %d events, want start and done", len(events))
+	}
+	if first := events[0]; first.Event != EventStart || first.File != "test.txt" || first.Total != int64(len(content)) {
+		t.Errorf("first event = %+v", first)
+	}
+	if last := events[len(events)-1]; last.Event != EventDone || last.Current != int64(len(content)) || last.Percent != 100 {
+		t.Errorf("last event = %+v", last)
+	}
+}
+
+func TestNewPlainAborted(t *testing.T) {
+	var out bytes.Buffer
+	pm, err := New(ModePlain, &out, time.Hour)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	bar := pm.NewBar(2048, "big.bin")
+	bar.IncrBy(1024)
+	bar.Abort(true)
+	pm.Wait()
+
+	want := "[Uploading] big.bin 2.00 KiB\n[Aborted] big.bin at 1.00 KiB / 2.00 KiB\n"
+	if out.String() != want {
+		t.Errorf("output = %q, want %q", out.String(), want)
+	}
+}
+
+func TestNewAutoAndQuiet(t *testing.T) {
+	var out bytes.Buffer
+	// A buffer is not a terminal, so auto picks plain lines
+	pm, err := New(ModeAuto, &out, time.Hour)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if pm.r == nil || pm.r.json {
+		t.Error("auto on a non-terminal should write plain lines")
+	}
+	pm.Wait()
+
+	out.Reset()
+	pm, err = New(ModeQuiet, &out, 0)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	bar := pm.NewBar(4, "quiet.txt")
+	bar.IncrBy(4)
+	pm.Wait()
+	if out.Len() != 0 {
+		t.Errorf("quiet mode wrote %q", out.String())
+	}
+
+	if _, err := New("fancy", &out, 0); err == nil {
+		t.Error("New() accepted an unknown mode")
+	}
+}
+
+func TestOverallJSON(t *testing.T) {
+	var out bytes.Buffer
+	pm, err := New(ModeJSON, &out, time.Millisecond)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	pm.SetTotal(3, 30)
+	content := []byte("0123456789")
+	bar := pm.NewBar(int64(len(content)), "uploaded.txt")
+	wrapped := pm.WrapReader(bar, bytes.NewReader(content))
+	if _, err := io.ReadAll(wrapped); err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	wrapped.Close()
+	pm.Done(10, true)
+	pm.Done(10, false)
+	pm.Failed()
+	pm.Wait()
 
+	var last TotalEvent
+	dec := json.NewDecoder(&out)
+	for dec.More() {
+		var e TotalEvent
+		if err := dec.Decode(&e); err != nil {
+			t.Fatalf("decode event: %v", err)
+		}
+		if e.Event == EventTotal {
+			last = e
+		}
+	}
+	want := TotalEvent{Event: EventTotal, Files: 3, FilesDone: 3, Failed: 1, Bytes: 30, BytesDone: 20}
+	last.Time, last.Rate, last.ETASeconds = time.Time{}, 0, 0
+	if last != want {
+		t.Errorf("last total = %+v, want %+v", last, want)
+	}
+}
+
+func TestOverallBars(t *testing.T) {
+	var out bytes.Buffer
+	pm, err := New(ModeBars, &out, 0)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	pm.SetTotal(1, 4)
+	bar := pm.NewBar(4, "a.txt")
+	bar.IncrBy(4)
+	pm.Done(4, true)
+
+	finished := make(chan struct{})
+	go func() {
+		pm.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Wait() did not return")
+	}
+	if got := pm.total.snapshot(); got.FilesDone != 1 || got.BytesDone != 4 {
+		t.Errorf("totals = %+v", got)
+	}
+}
+
+func TestTotalsString(t *testing.T) {
+	got := Totals{Files: 10, FilesDone: 4, Failed: 1, Bytes: 4 << 20, BytesDone: 1 << 20, Rate: 512 << 10, ETA: 6 * time.Second}.String()
+	want := "4/10 files, 1.00 MiB / 4.00 MiB, 512.00 KiB/s, ETA 6s, 1 failed"
+	if got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+	if got := (Totals{Files: 1}).String(); got != "0/1 files, 0.00 b / 0.00 b, 0.00 b/s, ETA --" {
+		t.Errorf("String() = %q", got)
+	}
+}
+
+func TestOverallDiscard(t *testing.T) {
+	var out bytes.Buffer
+	pm, err := New(ModePlain, &out, time.Hour)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	pm.SetTotal(2, 20)
+	failed := pm.NewBar(10, "failed.bin")
+	failed.IncrBy(6)
+	pm.total.sample()
+	// The upload read the whole body and then failed
+	failed.IncrBy(4)
+	pm.Discard(failed)
+	pm.Failed()
+
+	ok := pm.NewBar(10, "ok.bin")
+	ok.IncrBy(10)
+	pm.total.sample()
+	pm.Done(10, true)
+	pm.Wait()
+
+	got := pm.total.snapshot()
+	if got.BytesDone != 10 || got.FilesDone != 2 || got.Failed != 1 {
+		t.Errorf("totals = %+v, want 10 bytes done, 2 files done, 1 failed", got)
+	}
+}
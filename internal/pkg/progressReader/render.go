@@ -0,0 +1,241 @@
+package progressReader
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vbauerster/mpb/v8"
+	"github.com/vbauerster/mpb/v8/decor"
+)
+
+// Progress output modes accepted by New
+const (
+	ModeAuto  = "auto"  // bars on a terminal, plain lines otherwise
+	ModeBars  = "bars"  // redrawn progress bars
+	ModePlain = "plain" // periodic progress lines, one per file
+	ModeJSON  = "json"  // newline-delimited Event objects
+	ModeQuiet = "quiet" // no progress output
+)
+
+// Modes lists the modes accepted by New
+var Modes = []string{ModeAuto, ModeBars, ModePlain, ModeJSON, ModeQuiet}
+
+// DefaultInterval spaces the progress lines of the plain and json modes
+const DefaultInterval = 10 * time.Second
+
+// Event kinds written in json mode
+const (
+	EventStart    = "start"
+	EventProgress = "progress"
+	EventDone     = "done"
+	EventAborted  = "aborted"
+	EventTotal    = "total"
+)
+
+// Event is one line of json mode output
+type Event struct {
+	Time    time.Time `json:"time"`
+	Event   string    `json:"event"`
+	File    string    `json:"file"`
+	Current int64     `json:"current"`
+	Total   int64     `json:"total"`
+	Percent float64   `json:"percent"`
+}
+
+// TotalEvent is a line of json mode output with the overall progress
+type TotalEvent struct {
+	Time       time.Time `json:"time"`
+	Event      string    `json:"event"`
+	Files      int       `json:"files"`
+	FilesDone  int       `json:"files_done"`
+	Failed     int       `json:"failed"`
+	Bytes      int64     `json:"bytes"`
+	BytesDone  int64     `json:"bytes_done"`
+	Rate       float64   `json:"bytes_per_second"`
+	ETASeconds float64   `json:"eta_seconds"` // 0 when unknown
+}
+
+// IsTerminal reports whether w is an interactive terminal
+func IsTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0 && os.Getenv("TERM") != "dumb"
+}
+
+// New returns a ProgressManager writing to out in mode. Bars are only redrawn
+// on a terminal; in CI or under systemd auto falls back to plain lines, which
+// are written every interval for the files that made progress and once when a
+// file ends.
+func New(mode string, out io.Writer, interval time.Duration) (*ProgressManager, error) {
+	if mode == ModeAuto || mode == "" {
+		mode = ModePlain
+		if IsTerminal(out) {
+			mode = ModeBars
+		}
+	}
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	switch mode {
+	case ModeBars:
+		return &ProgressManager{p: mpb.New(mpb.WithWidth(64), mpb.WithOutput(out)), total: newOverall(true)}, nil
+	case ModeQuiet:
+		return &ProgressManager{p: mpb.New(mpb.WithOutput(io.Discard))}, nil
+	case ModePlain, ModeJSON:
+		// The bars still count the bytes read; the reporter samples them
+		total := newOverall(false)
+		return &ProgressManager{
+			p:     mpb.New(mpb.WithOutput(io.Discard)),
+			r:     newReporter(out, mode == ModeJSON, interval, total),
+			total: total,
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown progress mode %q (want %s)", mode, strings.Join(Modes, ", "))
+}
+
+// reporter writes the progress of the bars it tracks as lines
+type reporter struct {
+	out  io.Writer
+	json bool
+
+	mu         sync.Mutex
+	files      []*trackedFile
+	total      *overall
+	lastTotals Totals
+
+	stopc chan struct{}
+	donec chan struct{}
+}
+
+type trackedFile struct {
+	name     string
+	total    int64
+	bar      *mpb.Bar
+	reported int64
+}
+
+func newReporter(out io.Writer, json bool, interval time.Duration, total *overall) *reporter {
+	r := &reporter{out: out, json: json, total: total, stopc: make(chan struct{}), donec: make(chan struct{})}
+	go r.run(interval)
+	return r
+}
+
+func (r *reporter) run(interval time.Duration) {
+	defer close(r.donec)
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			r.poll()
+		case <-r.stopc:
+			return
+		}
+	}
+}
+
+// add starts tracking bar; a nil reporter does nothing
+func (r *reporter) add(name string, total int64, bar *mpb.Bar) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.files = append(r.files, &trackedFile{name: name, total: total, bar: bar})
+	r.write(EventStart, name, 0, total)
+}
+
+// stop reports the files that ended since the last poll and stops the ticker
+func (r *reporter) stop() {
+	if r == nil {
+		return
+	}
+	close(r.stopc)
+	<-r.donec
+	r.poll()
+}
+
+// poll writes a line for every file that progressed or ended since the last poll
+func (r *reporter) poll() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	running := r.files[:0]
+	for _, f := range r.files {
+		current := f.bar.Current()
+		switch {
+		case f.bar.Completed():
+			r.write(EventDone, f.name, current, f.total)
+		case f.bar.Aborted():
+			r.write(EventAborted, f.name, current, f.total)
+		default:
+			if current != f.reported {
+				f.reported = current
+				r.write(EventProgress, f.name, current, f.total)
+			}
+			running = append(running, f)
+		}
+	}
+	clear(r.files[len(running):])
+	r.files = running
+
+	if t, ok := r.total.current(); ok && t != r.lastTotals {
+		r.lastTotals = t
+		r.writeTotals(t)
+	}
+}
+
+func (r *reporter) writeTotals(t Totals) {
+	if !r.json {
+		fmt.Fprintf(r.out, "[Total] %s\n", t)
+		return
+	}
+	line, _ := json.Marshal(TotalEvent{
+		Time:       time.Now().UTC(),
+		Event:      EventTotal,
+		Files:      t.Files,
+		FilesDone:  t.FilesDone,
+		Failed:     t.Failed,
+		Bytes:      t.Bytes,
+		BytesDone:  t.BytesDone,
+		Rate:       t.Rate,
+		ETASeconds: t.ETA.Seconds(),
+	})
+	fmt.Fprintf(r.out, "%s\n", line)
+}
+
+func (r *reporter) write(event, name string, current, total int64) {
+	percent := 100.0
+	if total > 0 {
+		percent = float64(current) / float64(total) * 100
+	}
+	if r.json {
+		line, _ := json.Marshal(Event{
+			Time:    time.Now().UTC(),
+			Event:   event,
+			File:    name,
+			Current: current,
+			Total:   total,
+			Percent: percent,
+		})
+		fmt.Fprintf(r.out, "%s\n", line)
+		return
+	}
+	switch event {
+	case EventStart:
+		fmt.Fprintf(r.out, "[Uploading] %s % .2f\n", name, decor.SizeB1024(total))
+	case EventProgress:
+		fmt.Fprintf(r.out, "[Uploading] %s % .2f / % .2f %.0f%%\n", name, decor.SizeB1024(current), decor.SizeB1024(total), percent)
+	case EventDone:
+		fmt.Fprintf(r.out, "[Done] %s % .2f\n", name, decor.SizeB1024(total))
+	case EventAborted:
+		fmt.Fprintf(r.out, "[Aborted] %s at % .2f / % .2f\n", name, decor.SizeB1024(current), decor.SizeB1024(total))
+	}
+}
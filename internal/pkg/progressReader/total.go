@@ -0,0 +1,225 @@
+package progressReader
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vbauerster/mpb/v8"
+	"github.com/vbauerster/mpb/v8/decor"
+)
+
+// Overall progress is sampled this often; the throughput is averaged over rateWindow
+const (
+	sampleInterval = 250 * time.Millisecond
+	rateWindow     = 10 * time.Second
+)
+
+// Totals is a snapshot of the overall progress of a run
+type Totals struct {
+	Files     int           // files to process
+	FilesDone int           // files finished, including failed ones
+	Failed    int           // files that failed
+	Bytes     int64         // bytes of the files to process
+	BytesDone int64         // bytes uploaded or skipped so far
+	Rate      float64       // bytes per second uploaded recently
+	ETA       time.Duration // time left at Rate, 0 when unknown
+}
+
+// String formats t as the text of the overall bar and the plain progress lines
+func (t Totals) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d/%d files, % .2f / % .2f, % .2f/s, ETA ", t.FilesDone, t.Files,
+		decor.SizeB1024(t.BytesDone), decor.SizeB1024(t.Bytes), decor.SizeB1024(int64(t.Rate)))
+	if t.ETA > 0 {
+		b.WriteString(t.ETA.String())
+	} else {
+		b.WriteString("--")
+	}
+	if t.Failed > 0 {
+		fmt.Fprintf(&b, ", %d failed", t.Failed)
+	}
+	return b.String()
+}
+
+type rateSample struct {
+	at    time.Time
+	bytes int64
+}
+
+// overall adds the per-file bars up into the progress of the run
+type overall struct {
+	render bool // draw a pinned bar on the bars container
+
+	mu          sync.Mutex
+	started     bool
+	totals      Totals
+	doneBytes   int64              // bytes of files finished without uploading
+	uploaded    int64              // bytes read by the per-file bars, less those of failed uploads
+	transferred int64              // bytes read by the per-file bars, for the throughput
+	running     map[*mpb.Bar]int64 // bytes read so far by each running bar
+	samples     []rateSample
+	bar         *mpb.Bar
+	stopc, done chan struct{}
+}
+
+func newOverall(render bool) *overall {
+	return &overall{render: render, running: make(map[*mpb.Bar]int64)}
+}
+
+// start sets the totals and begins sampling; a nil overall does nothing
+func (o *overall) start(p *mpb.Progress, files int, bytes int64) {
+	if o == nil {
+		return
+	}
+	// The bar's decorator takes o.mu, so the bar is only called without it
+	o.mu.Lock()
+	o.totals.Files, o.totals.Bytes = files, bytes
+	started := o.started
+	o.started = true
+	o.mu.Unlock()
+	if started {
+		if o.bar != nil {
+			o.bar.SetTotal(bytes, false)
+		}
+		return
+	}
+
+	if o.render {
+		// Created with no total so it completes only when Wait ends it
+		o.bar = p.New(0, mpb.BarStyle(),
+			mpb.BarPriority(math.MaxInt),
+			mpb.PrependDecorators(decor.Name("[Total] ")),
+			mpb.AppendDecorators(decor.Any(func(decor.Statistics) string { return o.snapshot().String() })),
+		)
+		o.bar.SetTotal(bytes, false)
+	}
+	o.stopc, o.done = make(chan struct{}), make(chan struct{})
+	go o.run()
+}
+
+func (o *overall) run() {
+	defer close(o.done)
+	t := time.NewTicker(sampleInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			o.sample()
+		case <-o.stopc:
+			return
+		}
+	}
+}
+
+// stop takes a last sample and completes the overall bar
+func (o *overall) stop() {
+	if o == nil || !o.started {
+		return
+	}
+	close(o.stopc)
+	<-o.done
+	o.sample()
+	if o.bar != nil {
+		o.bar.SetTotal(-1, true)
+	}
+}
+
+// track counts the bytes read by bar until it ends
+func (o *overall) track(bar *mpb.Bar) {
+	if o == nil {
+		return
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.running[bar] = 0
+}
+
+// discard takes the bytes bar read back out of the bytes done
+func (o *overall) discard(bar *mpb.Bar) {
+	if o == nil {
+		return
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	counted, running := o.running[bar]
+	if running {
+		// Stop counting it; what it read since the last sample is never added
+		delete(o.running, bar)
+	} else {
+		// The sampler saw it end and counted all of it
+		counted = bar.Current()
+	}
+	o.uploaded -= counted
+}
+
+// finish counts a file as done; bytes not read through a bar are added to the bytes done
+func (o *overall) finish(size int64, uploaded, failed bool) {
+	if o == nil {
+		return
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.totals.FilesDone++
+	if failed {
+		o.totals.Failed++
+	} else if !uploaded {
+		o.doneBytes += size
+	}
+}
+
+// sample reads the running bars and updates the throughput
+func (o *overall) sample() {
+	o.mu.Lock()
+	for bar, read := range o.running {
+		// Read after checking, so an ended bar reports its final count
+		running := bar.IsRunning()
+		current := bar.Current()
+		o.uploaded += current - read
+		o.transferred += current - read
+		o.running[bar] = current
+		if !running {
+			delete(o.running, bar)
+		}
+	}
+
+	now := time.Now()
+	o.samples = append(o.samples, rateSample{now, o.transferred})
+	for len(o.samples) > 2 && now.Sub(o.samples[1].at) >= rateWindow {
+		o.samples = o.samples[1:]
+	}
+	o.totals.Rate = 0
+	if first := o.samples[0]; now.Sub(first.at) > 0 {
+		o.totals.Rate = float64(o.transferred-first.bytes) / now.Sub(first.at).Seconds()
+	}
+
+	o.totals.BytesDone = o.doneBytes + o.uploaded
+	o.totals.ETA = 0
+	if left := o.totals.Bytes - o.totals.BytesDone; left > 0 && o.totals.Rate > 0 {
+		o.totals.ETA = time.Duration(float64(left) / o.totals.Rate * float64(time.Second)).Round(time.Second)
+	}
+	done := o.totals.BytesDone
+	o.mu.Unlock()
+
+	if o.bar != nil {
+		o.bar.SetCurrent(done)
+	}
+}
+
+// current returns the totals once start was called
+func (o *overall) current() (Totals, bool) {
+	if o == nil {
+		return Totals{}, false
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.totals, o.started
+}
+
+func (o *overall) snapshot() Totals {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.totals
+}
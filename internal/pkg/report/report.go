@@ -0,0 +1,248 @@
+// Package report collects the outcome of every file in a sync run and renders
+// it as a summary table or a JSON document.
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/vincent119/s3syncgoogledrive/internal/pkg/errs"
+)
+
+// Status is the outcome of one file
+type Status string
+
+const (
+	// Uploaded files were copied to Drive in this run
+	Uploaded Status = "uploaded"
+	// Skipped files were already in Drive
+	Skipped Status = "skipped"
+	// Pending files are archived and wait for an S3 restore
+	Pending Status = "pending_restore"
+	// Excluded files are not eligible for transfer, such as folder placeholders
+	Excluded Status = "excluded"
+	// Failed files could not be copied
+	Failed Status = "failed"
+)
+
+// statuses is the order used in the table
+var statuses = []Status{Uploaded, Skipped, Pending, Excluded, Failed}
+
+// Count is the number of files and bytes with one status
+type Count struct {
+	Files int   `json:"files"`
+	Bytes int64 `json:"bytes"`
+}
+
+// Entry is a file listed in the report with the reason for its status
+type Entry struct {
+	S3Key     string `json:"s3_key"`
+	VersionID string `json:"version_id,omitempty"`
+	Bytes     int64  `json:"bytes"`
+	Reason    string `json:"reason"`
+	// Kind is the errs kind of a failure, e.g. "quota exceeded"
+	Kind string `json:"kind,omitempty"`
+}
+
+// Report is the outcome of a run
+type Report struct {
+	RunID      string    `json:"run_id"`
+	Prefix     string    `json:"prefix"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	// DurationSeconds and ThroughputBytesPerSecond are derived from the fields above
+	DurationSeconds          float64          `json:"duration_seconds"`
+	ThroughputBytesPerSecond float64          `json:"throughput_bytes_per_second"`
+	Counts                   map[Status]Count `json:"counts"`
+	Failures                 []Entry          `json:"failures"`
+	PendingRestores          []Entry          `json:"pending_restores"`
+	// Aborted holds the error that stopped the run early, if any
+	Aborted string `json:"aborted,omitempty"`
+}
+
+// Duration is the wall time of the run
+func (r *Report) Duration() time.Duration {
+	return r.FinishedAt.Sub(r.StartedAt)
+}
+
+// Total sums the counts of every status
+func (r *Report) Total() Count {
+	var total Count
+	for _, c := range r.Counts {
+		total.Files += c.Files
+		total.Bytes += c.Bytes
+	}
+	return total
+}
+
+// Failed reports whether any file failed or the run was aborted
+func (r *Report) Failed() bool {
+	return r.Counts[Failed].Files > 0 || r.Aborted != ""
+}
+
+// Recorder collects file outcomes from concurrent workers
+type Recorder struct {
+	mu     sync.Mutex
+	report Report
+	now    func() time.Time
+}
+
+// NewRecorder starts the report of a run
+func NewRecorder(runID, prefix string) *Recorder {
+	r := &Recorder{now: time.Now}
+	r.report = Report{
+		RunID:     runID,
+		Prefix:    prefix,
+		StartedAt: r.now(),
+		Counts:    make(map[Status]Count),
+	}
+	return r
+}
+
+// Add records a file that was uploaded, skipped or excluded
+func (r *Recorder) Add(status Status, bytes int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.count(status, bytes)
+}
+
+// Pend records an archived file waiting for a restore
+func (r *Recorder) Pend(s3Key, versionID string, bytes int64, reason string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.count(Pending, bytes)
+	r.report.PendingRestores = append(r.report.PendingRestores, Entry{S3Key: s3Key, VersionID: versionID, Bytes: bytes, Reason: reason})
+}
+
+// Fail records a file that could not be copied
+func (r *Recorder) Fail(s3Key, versionID string, bytes int64, err error) {
+	e := Entry{S3Key: s3Key, VersionID: versionID, Bytes: bytes, Reason: err.Error()}
+	if kind := errs.Kind(err); kind != nil {
+		e.Kind = kind.Error()
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.count(Failed, bytes)
+	r.report.Failures = append(r.report.Failures, e)
+}
+
+// Abort records the error that stopped the run
+func (r *Recorder) Abort(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.report.Aborted = err.Error()
+}
+
+func (r *Recorder) count(status Status, bytes int64) {
+	c := r.report.Counts[status]
+	c.Files++
+	c.Bytes += bytes
+	r.report.Counts[status] = c
+}
+
+// Finish stamps the end time and returns the report, with entries sorted by key
+func (r *Recorder) Finish() *Report {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rep := r.report
+	rep.FinishedAt = r.now()
+	rep.DurationSeconds = rep.Duration().Seconds()
+	if rep.DurationSeconds > 0 {
+		rep.ThroughputBytesPerSecond = float64(rep.Counts[Uploaded].Bytes) / rep.DurationSeconds
+	}
+	rep.Counts = make(map[Status]Count, len(statuses))
+	for _, s := range statuses {
+		rep.Counts[s] = r.report.Counts[s]
+	}
+	rep.Failures = sortedEntries(r.report.Failures)
+	rep.PendingRestores = sortedEntries(r.report.PendingRestores)
+	return &rep
+}
+
+func sortedEntries(entries []Entry) []Entry {
+	sorted := append([]Entry{}, entries...)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].S3Key != sorted[j].S3Key {
+			return sorted[i].S3Key < sorted[j].S3Key
+		}
+		return sorted[i].VersionID < sorted[j].VersionID
+	})
+	return sorted
+}
+
+// WriteTable renders the summary table, followed by pending restores and failures
+func (r *Report) WriteTable(w io.Writer) error {
+	fmt.Fprintf(w, "\nRun %s finished in %s\n\n", r.RunID, r.Duration().Round(time.Millisecond))
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "Status\tFiles\tBytes\t")
+	for _, s := range statuses {
+		c := r.Counts[s]
+		fmt.Fprintf(tw, "%s\t%d\t%s\t\n", s, c.Files, FormatBytes(c.Bytes))
+	}
+	total := r.Total()
+	fmt.Fprintf(tw, "total\t%d\t%s\t\n", total.Files, FormatBytes(total.Bytes))
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "\nThroughput: %s/s\n", FormatBytes(int64(r.ThroughputBytesPerSecond)))
+
+	if len(r.PendingRestores) > 0 {
+		fmt.Fprintf(w, "\nPending restores (%d), re-run once they are available:\n", len(r.PendingRestores))
+		for _, e := range r.PendingRestores {
+			fmt.Fprintf(w, "  %s [%s]\n", e.S3Key, e.Reason)
+		}
+	}
+	if len(r.Failures) > 0 {
+		fmt.Fprintf(w, "\nFailures (%d):\n", len(r.Failures))
+		for _, e := range r.Failures {
+			fmt.Fprintf(w, "  %s: %s\n", e.S3Key, e.Reason)
+		}
+	}
+	if r.Aborted != "" {
+		fmt.Fprintf(w, "\nAborted: %s\n", r.Aborted)
+	}
+	return nil
+}
+
+// WriteJSON writes the report as indented JSON
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// WriteJSONFile writes the report to path, or to stdout when path is "-"
+func (r *Report) WriteJSONFile(path string) error {
+	if path == "-" {
+		return r.WriteJSON(os.Stdout)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := r.WriteJSON(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// FormatBytes renders a byte count with binary units
+func FormatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,122 @@
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/vincent119/s3syncgoogledrive/internal/pkg/errs"
+)
+
+func fakeClock(times ...time.Time) func() time.Time {
+	i := 0
+	return func() time.Time {
+		t := times[i]
+		i++
+		return t
+	}
+}
+
+func newTestRecorder() *Recorder {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	r := NewRecorder("run-1", "photos/")
+	r.now = fakeClock(start.Add(10 * time.Second))
+	r.report.StartedAt = start
+	return r
+}
+
+func TestRecorder(t *testing.T) {
+	r := newTestRecorder()
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.Add(Uploaded, 100)
+		}()
+	}
+	wg.Wait()
+	r.Add(Skipped, 50)
+	r.Add(Excluded, 0)
+	r.Pend("b/archived.bin", "", 70, "GLACIER, restore in progress")
+	r.Fail("z.txt", "", 5, errs.Wrap(errs.ErrQuota, "upload z.txt", errors.New("storage full")))
+	r.Fail("a.txt", "v1", 7, errors.New("connection reset"))
+
+	rep := r.Finish()
+	if got := rep.Counts[Uploaded]; got != (Count{Files: 10, Bytes: 1000}) {
+		t.Errorf("Uploaded = %+v", got)
+	}
+	if got := rep.Total(); got != (Count{Files: 15, Bytes: 1132}) {
+		t.Errorf("Total = %+v", got)
+	}
+	if rep.DurationSeconds != 10 || rep.ThroughputBytesPerSecond != 100 {
+		t.Errorf("Duration = %v, throughput = %v", rep.DurationSeconds, rep.ThroughputBytesPerSecond)
+	}
+	if !rep.Failed() {
+		t.Error("Failed() = false with failures")
+	}
+	if len(rep.Failures) != 2 || rep.Failures[0].S3Key != "a.txt" || rep.Failures[1].Kind != "quota exceeded" {
+		t.Errorf("Failures not sorted or kind missing: %+v", rep.Failures)
+	}
+}
+
+func TestReportJSON(t *testing.T) {
+	r := newTestRecorder()
+	r.Add(Uploaded, 2048)
+	rep := r.Finish()
+	if rep.Failed() {
+		t.Error("Failed() = true without failures")
+	}
+
+	var buf bytes.Buffer
+	if err := rep.WriteJSON(&buf); err != nil {
+		t.Fatalf("WriteJSON failed: %v", err)
+	}
+	var decoded map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("Invalid JSON: %v", err)
+	}
+	counts := decoded["counts"].(map[string]any)
+	for _, s := range statuses {
+		if _, ok := counts[string(s)]; !ok {
+			t.Errorf("counts missing %s", s)
+		}
+	}
+	if failures, ok := decoded["failures"].([]any); !ok || len(failures) != 0 {
+		t.Errorf("failures = %v, want empty list", decoded["failures"])
+	}
+	if decoded["run_id"] != "run-1" || decoded["throughput_bytes_per_second"] != 204.8 {
+		t.Errorf("Unexpected report: %s", buf.String())
+	}
+}
+
+func TestWriteTable(t *testing.T) {
+	r := newTestRecorder()
+	r.Add(Uploaded, 3*1024*1024)
+	r.Fail("a.txt", "", 1, errors.New("boom"))
+	r.Abort(errors.New("credentials rejected"))
+
+	var buf bytes.Buffer
+	if err := r.Finish().WriteTable(&buf); err != nil {
+		t.Fatalf("WriteTable failed: %v", err)
+	}
+	out := buf.String()
+	for _, want := range []string{"Run run-1 finished in 10s", "uploaded", "3.0 MiB", "failed", "Failures (1):", "a.txt: boom", "Aborted: credentials rejected"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Table missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	cases := map[int64]string{0: "0 B", 1023: "1023 B", 1024: "1.0 KiB", 1536: "1.5 KiB", 5 << 30: "5.0 GiB"}
+	for n, want := range cases {
+		if got := FormatBytes(n); got != want {
+			t.Errorf("FormatBytes(%d) = %s, want %s", n, got, want)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+// Package tracing sets up OpenTelemetry tracing with an OTLP/HTTP exporter and
+// names the spans and attributes recorded by the sync loop and the S3 and Drive
+// managers. Without an endpoint the global no-op tracer is kept, so spans cost
+// next to nothing.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/vincent119/s3syncgoogledrive/internal/configs"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TracesPath is appended to a Tracing.endpoint given without a path
+const TracesPath = "/v1/traces"
+
+// ScopeName is the instrumentation scope of every span started here
+const ScopeName = "github.com/vincent119/s3syncgoogledrive"
+
+// Attribute keys shared by the spans of a file, matching the logging keys
+const (
+	KeyRunID        = attribute.Key("s3sync.run_id")
+	KeyS3Key        = attribute.Key("s3.key")
+	KeyVersionID    = attribute.Key("s3.version_id")
+	KeyStorageClass = attribute.Key("s3.storage_class")
+	KeySize         = attribute.Key("file.size")
+	KeyDriveID      = attribute.Key("drive.id")
+	KeyAttempt      = attribute.Key("attempt")
+	KeyStatus       = attribute.Key("s3sync.status")
+	KeyHTTPStatus   = attribute.Key("http.response.status_code")
+)
+
+// Start starts a span named name as a child of the span in ctx
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(ScopeName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End marks span failed when err is set and ends it
+func End(span trace.Span, err error) {
+	SetError(span, err)
+	span.End()
+}
+
+// EndCall ends the span of an API call answered with the status label used by
+// the metrics; labels that are not an HTTP status code are not recorded
+func EndCall(span trace.Span, status string, err error) {
+	if code, convErr := strconv.Atoi(status); convErr == nil {
+		span.SetAttributes(KeyHTTPStatus.Int(code))
+	}
+	End(span, err)
+}
+
+// SetError records err on span and marks it failed; a nil err does nothing
+func SetError(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+}
+
+// Enabled reports whether cfg or the standard OTLP environment variables name an endpoint
+func Enabled(cfg configs.TracingConfig) bool {
+	return cfg.Endpoint != "" || os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" || os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") != ""
+}
+
+// Setup installs a global tracer provider exporting to cfg.Endpoint and returns
+// the func flushing and stopping it. When tracing is not enabled it installs
+// nothing and shutdown does nothing.
+func Setup(ctx context.Context, cfg configs.TracingConfig) (shutdown func(context.Context) error, err error) {
+	if !Enabled(cfg) {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	var opts []otlptracehttp.Option
+	if cfg.Endpoint != "" {
+		opts = append(opts, otlptracehttp.WithEndpointURL(cfg.Endpoint))
+		// Like OTEL_EXPORTER_OTLP_ENDPOINT, a bare collector URL gets the traces path
+		if u, err := url.Parse(cfg.Endpoint); err == nil && strings.TrimSuffix(u.Path, "/") == "" {
+			opts = append(opts, otlptracehttp.WithURLPath(TracesPath))
+		}
+	}
+	if len(cfg.Headers) > 0 {
+		opts = append(opts, otlptracehttp.WithHeaders(cfg.Headers))
+	}
+	exporter, err := otlptracehttp.New(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("create OTLP exporter: %w", err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL,
+		semconv.ServiceName(cfg.ResolvedServiceName())))
+	if err != nil {
+		return nil, fmt.Errorf("tracing resource: %w", err)
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.ResolvedSampleRatio()))),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	return provider.Shutdown, nil
+}
+
+// HTTPDoer is an HTTP client in the shape of aws.HTTPClient
+type HTTPDoer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// WrapDoer returns a client recording a span for every request sent through c
+func WrapDoer(c HTTPDoer) HTTPDoer {
+	return doer{otelhttp.NewTransport(roundTripper{c}, otelhttp.WithSpanNameFormatter(spanName))}
+}
+
+type doer struct{ rt http.RoundTripper }
+
+func (d doer) Do(req *http.Request) (*http.Response, error) { return d.rt.RoundTrip(req) }
+
+type roundTripper struct{ c HTTPDoer }
+
+func (r roundTripper) RoundTrip(req *http.Request) (*http.Response, error) { return r.c.Do(req) }
+
+// spanName names client spans "HTTP GET <host>"; the path holds the object key
+func spanName(_ string, req *http.Request) string {
+	return "HTTP " + req.Method + " " + req.URL.Hostname()
+}
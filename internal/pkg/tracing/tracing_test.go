@@ -0,0 +1,164 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/vincent119/s3syncgoogledrive/internal/configs"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// recordSpans installs a global tracer provider recording every ended span
+// for the duration of the test
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	rec := tracetest.NewSpanRecorder()
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)))
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+	return rec
+}
+
+func attr(span sdktrace.ReadOnlySpan, key attribute.Key) (attribute.Value, bool) {
+	for _, kv := range span.Attributes() {
+		if kv.Key == key {
+			return kv.Value, true
+		}
+	}
+	return attribute.Value{}, false
+}
+
+func TestStartEnd(t *testing.T) {
+	rec := recordSpans(t)
+
+	ctx, parent := Start(context.Background(), "sync.file", KeyS3Key.String("a/b.txt"))
+	_, ok := Start(ctx, "resolve_folder")
+	End(ok, nil)
+	_, failed := Start(ctx, "upload")
+	End(failed, errors.New("quota exceeded"))
+	End(parent, nil)
+
+	spans := rec.Ended()
+	if len(spans) != 3 {
+		t.Fatalf("Ended %d spans, want 3", len(spans))
+	}
+	resolve, upload, file := spans[0], spans[1], spans[2]
+	if resolve.Parent().SpanID() != file.SpanContext().SpanID() || upload.Parent().SpanID() != file.SpanContext().SpanID() {
+		t.Error("Phase spans are not children of the file span")
+	}
+	if v, _ := attr(file, KeyS3Key); v.AsString() != "a/b.txt" {
+		t.Errorf("s3.key = %q, want a/b.txt", v.AsString())
+	}
+	if resolve.Status().Code != codes.Unset {
+		t.Errorf("Status = %v, want unset", resolve.Status())
+	}
+	if upload.Status().Code != codes.Error || upload.Status().Description != "quota exceeded" {
+		t.Errorf("Status = %v, want error", upload.Status())
+	}
+	if len(upload.Events()) != 1 || upload.Events()[0].Name != "exception" {
+		t.Errorf("Events = %v, want the recorded error", upload.Events())
+	}
+}
+
+func TestEndCall(t *testing.T) {
+	rec := recordSpans(t)
+
+	_, span := Start(context.Background(), "drive.files.list")
+	EndCall(span, "429", errors.New("rate limited"))
+	_, span = Start(context.Background(), "s3.HeadObject")
+	EndCall(span, "error", errors.New("dial tcp: timeout"))
+
+	spans := rec.Ended()
+	if v, ok := attr(spans[0], KeyHTTPStatus); !ok || v.AsInt64() != 429 {
+		t.Errorf("http.response.status_code = %v, want 429", v.Emit())
+	}
+	if _, ok := attr(spans[1], KeyHTTPStatus); ok {
+		t.Error("http.response.status_code set without a response")
+	}
+}
+
+func TestEnabled(t *testing.T) {
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "")
+	t.Setenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "")
+	if Enabled(configs.TracingConfig{}) {
+		t.Error("Enabled() = true without an endpoint")
+	}
+	if !Enabled(configs.TracingConfig{Endpoint: "http://localhost:4318"}) {
+		t.Error("Enabled() = false with Tracing.endpoint")
+	}
+	t.Setenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "http://collector:4318/v1/traces")
+	if !Enabled(configs.TracingConfig{}) {
+		t.Error("Enabled() = false with OTEL_EXPORTER_OTLP_TRACES_ENDPOINT")
+	}
+}
+
+func TestSetupExports(t *testing.T) {
+	prev := otel.GetTracerProvider()
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+
+	var gotPath, gotAuth string
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath, gotAuth = r.URL.Path, r.Header.Get("Authorization")
+		w.Header().Set("Content-Type", "application/x-protobuf")
+	}))
+	defer collector.Close()
+
+	for _, tc := range []struct{ endpoint, wantPath string }{
+		{collector.URL, TracesPath},
+		{collector.URL + "/", TracesPath},
+		{collector.URL + "/otlp/v1/traces", "/otlp/v1/traces"},
+	} {
+		gotPath, gotAuth = "", ""
+		shutdown, err := Setup(context.Background(), configs.TracingConfig{
+			Endpoint: tc.endpoint,
+			Headers:  map[string]string{"Authorization": "Bearer token"},
+		})
+		if err != nil {
+			t.Fatalf("Setup(%q) = %v", tc.endpoint, err)
+		}
+		_, span := Start(context.Background(), "sync")
+		span.End()
+		if err := shutdown(context.Background()); err != nil {
+			t.Fatalf("shutdown() = %v", err)
+		}
+		if gotPath != tc.wantPath || gotAuth != "Bearer token" {
+			t.Errorf("Setup(%q) exported to %q with Authorization %q, want %q", tc.endpoint, gotPath, gotAuth, tc.wantPath)
+		}
+	}
+}
+
+func TestWrapDoer(t *testing.T) {
+	rec := recordSpans(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	ctx, parent := Start(context.Background(), "s3.HeadObject")
+	req, _ := http.NewRequestWithContext(ctx, http.MethodHead, server.URL+"/bucket/key", nil)
+	resp, err := WrapDoer(server.Client()).Do(req)
+	if err != nil {
+		t.Fatalf("Do() = %v", err)
+	}
+	resp.Body.Close()
+	parent.End()
+
+	spans := rec.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("Ended %d spans, want 2", len(spans))
+	}
+	if spans[0].Name() != "HTTP HEAD 127.0.0.1" {
+		t.Errorf("Name = %q", spans[0].Name())
+	}
+	if spans[0].Parent().SpanID() != parent.SpanContext().SpanID() {
+		t.Error("HTTP span is not a child of the call span")
+	}
+}